@@ -0,0 +1,53 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"anbox_mgmt/pkg/loadgen"
+)
+
+func main() {
+	cfg := loadgen.Config{}
+	flag.StringVar(&cfg.BaseURL, "url", "http://0.0.0.0:6000/api/v1", "base URL of the API")
+	flag.IntVar(&cfg.Users, "users", 100, "number of synthetic users to register")
+	flag.IntVar(&cfg.Games, "games", 10, "number of games to create")
+	flag.IntVar(&cfg.Concurrency, "concurrency", 10, "number of users playing at the same time")
+	flag.Float64Var(&cfg.Rate, "rate", 0, "requests per second across all users, 0 for no limit")
+	flag.DurationVar(&cfg.Duration, "duration", time.Minute, "upper bound of the run")
+	flag.Int64Var(&cfg.Seed, "seed", 1, "seed of the user behaviour")
+	flag.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "timeout of a single request")
+	flag.Parse()
+
+	// Ctrl-C stops the run but still prints the report
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stats, err := loadgen.Run(ctx, cfg)
+	if stats != nil {
+		fmt.Println()
+		stats.Report(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -16,10 +16,15 @@ package main
 
 import (
 	"log"
+	"time"
+	_ "time/tzdata" // user time zones must resolve even without system tzdata
 
+	"anbox_mgmt/pkg/blob"
 	"anbox_mgmt/pkg/config"
+	"anbox_mgmt/pkg/leader"
 	"anbox_mgmt/pkg/postgresql"
 	"anbox_mgmt/pkg/server"
+	"anbox_mgmt/pkg/simulator"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -32,6 +37,43 @@ func main() {
 		log.Fatalf("cannot open database: %v", err)
 	}
 
-	srv := server.NewServer(db)
-	log.Fatal(srv.Run(cfg.Port, cfg.GameTrafficFreq, cfg.GameTrafficLimitPlayTimePerFreq))
+	popularity, err := simulator.ParsePopularity(cfg.GameTrafficPopularity)
+	if err != nil {
+		log.Fatalf("invalid GAME_TRAFFIC_POPULARITY: %v", err)
+	}
+
+	options := simulator.DefaultOptions()
+	options.Popularity = popularity
+	options.ChurnRate = cfg.GameTrafficChurnRate
+
+	simulatorConfig := simulator.Config{
+		Frequency: cfg.GameTrafficFreq,
+		Span:      time.Duration(cfg.GameTrafficLimitPlayTimePerFreq) * time.Minute,
+		Profile:   cfg.GameTrafficProfile,
+		Seed:      cfg.GameTrafficSeed,
+		BatchSize: cfg.GameTrafficBatchSize,
+		Options:   options,
+
+		RecordPath:  cfg.GameTrafficRecord,
+		ReplayPath:  cfg.GameTrafficReplay,
+		ReplaySpeed: cfg.GameTrafficReplaySpeed,
+	}
+
+	// only one replica runs the background jobs
+	var locker leader.Locker = postgresql.NewAdvisoryLocker(db, cfg.LeaderLockKey, leader.DefaultRetryInterval)
+	if cfg.LeaderLocker == "local" {
+		locker = leader.NewLocalLocker()
+	}
+
+	// the uploaded APKs, `file` being the only store so far
+	var blobs blob.Store
+	switch cfg.BlobStore {
+	case "file":
+		if blobs, err = blob.NewFileStore(cfg.BlobStoreDir); err != nil {
+			log.Fatalf("cannot open blob store: %v", err)
+		}
+	}
+
+	srv := server.NewServer(db, blobs, cfg.SessionHeartbeatTimeout, cfg.RecommendationsInterval)
+	log.Fatal(srv.Run(cfg.Port, simulatorConfig, locker))
 }
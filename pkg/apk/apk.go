@@ -0,0 +1,101 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apk reads the metadata of Android application packages, decoding
+// the binary AndroidManifest.xml they carry without the Android SDK.
+package apk
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxManifestSize bounds the decompressed manifest, real ones are a few KB.
+const maxManifestSize = 4 << 20
+
+var (
+	ErrNoManifest      = errors.New("apk: no AndroidManifest.xml")
+	ErrInvalidManifest = errors.New("apk: invalid binary AndroidManifest.xml")
+)
+
+// Manifest is the metadata of an APK.
+type Manifest struct {
+	Package     string
+	VersionCode uint32
+	VersionName string // empty when it is a resource reference
+	MinSDK      uint32
+	TargetSDK   uint32
+	Permissions []string
+
+	// ABIs with native libraries under lib/, none for an application
+	// without native code.
+	ABIs []string
+}
+
+// Parse reads the manifest of the APK, a zip archive of size bytes.
+func Parse(r io.ReaderAt, size int64) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("apk: %w", err)
+	}
+
+	var manifestFile *zip.File
+	abis := map[string]bool{}
+	for _, f := range zr.File {
+		if f.Name == "AndroidManifest.xml" {
+			manifestFile = f
+		}
+		// lib/<abi>/libname.so
+		if parts := strings.Split(f.Name, "/"); len(parts) == 3 && parts[0] == "lib" && parts[1] != "" && parts[2] != "" {
+			abis[parts[1]] = true
+		}
+	}
+
+	if manifestFile == nil {
+		return nil, ErrNoManifest
+	}
+	if manifestFile.UncompressedSize64 > maxManifestSize {
+		return nil, ErrInvalidManifest
+	}
+
+	rc, err := manifestFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("apk: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("apk: %w", err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, ErrInvalidManifest
+	}
+
+	manifest, err := parseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for abi := range abis {
+		manifest.ABIs = append(manifest.ABIs, abi)
+	}
+	sort.Strings(manifest.ABIs)
+
+	return manifest, nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"encoding/binary"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Chunk types of the Android binary XML format, see ResourceTypes.h in the
+// Android framework.
+const (
+	chunkStringPool   = 0x0001
+	chunkXML          = 0x0003
+	chunkStartElement = 0x0102
+	chunkResourceMap  = 0x0180
+)
+
+// Value types of the attributes.
+const (
+	typeString = 0x03
+	typeIntDec = 0x10
+	typeIntHex = 0x11
+)
+
+const (
+	noIndex        = 0xffffffff
+	stringPoolUTF8 = 1 << 8
+)
+
+// attrNames names the android: attributes by resource ID, as obfuscated
+// APKs strip the names from the string pool.
+var attrNames = map[uint32]string{
+	0x01010003: "name",
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x01010270: "targetSdkVersion",
+}
+
+type attribute struct {
+	value    string // raw string value, if any
+	dataType uint8
+	data     uint32
+}
+
+func (a attribute) uint() (uint32, bool) {
+	switch a.dataType {
+	case typeIntDec, typeIntHex:
+		return a.data, true
+	}
+	n, err := strconv.ParseUint(a.value, 10, 32)
+	return uint32(n), err == nil
+}
+
+// parseManifest decodes the binary AndroidManifest.xml, reading the
+// manifest, uses-sdk and uses-permission elements only.
+func parseManifest(data []byte) (*Manifest, error) {
+	if len(data) < 8 || u16(data, 0) != chunkXML {
+		return nil, ErrInvalidManifest
+	}
+
+	end := int(u32(data, 4))
+	if end > len(data) {
+		return nil, ErrInvalidManifest
+	}
+
+	manifest := Manifest{}
+	hasMinSDK, hasTargetSDK := false, false
+	strings, resourceIDs := []string{}, []uint32{}
+
+	for offset := int(u16(data, 2)); offset+8 <= end; {
+		chunkType, headerSize, size := u16(data, offset), int(u16(data, offset+2)), int(u32(data, offset+4))
+		if size < 8 || headerSize > size || offset+size > end {
+			return nil, ErrInvalidManifest
+		}
+		chunk := data[offset : offset+size]
+
+		switch chunkType {
+		case chunkStringPool:
+			var err error
+			if strings, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case chunkResourceMap:
+			for i := headerSize; i+4 <= size; i += 4 {
+				resourceIDs = append(resourceIDs, u32(chunk, i))
+			}
+		case chunkStartElement:
+			name, attrs, err := parseStartElement(chunk, strings, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+
+			switch name {
+			case "manifest":
+				manifest.Package = attrs["package"].value
+				manifest.VersionCode, _ = attrs["versionCode"].uint()
+				manifest.VersionName = attrs["versionName"].value
+			case "uses-sdk":
+				manifest.MinSDK, hasMinSDK = attrs["minSdkVersion"].uint()
+				manifest.TargetSDK, hasTargetSDK = attrs["targetSdkVersion"].uint()
+			case "uses-permission", "uses-permission-sdk-23":
+				if v := attrs["name"].value; v != "" {
+					manifest.Permissions = append(manifest.Permissions, v)
+				}
+			}
+		}
+
+		offset += size
+	}
+
+	if manifest.Package == "" {
+		return nil, ErrInvalidManifest
+	}
+
+	// the Android defaults
+	if !hasMinSDK {
+		manifest.MinSDK = 1
+	}
+	if !hasTargetSDK {
+		manifest.TargetSDK = manifest.MinSDK
+	}
+
+	return &manifest, nil
+}
+
+// parseStartElement returns the name of the element and its attributes by
+// name.
+func parseStartElement(chunk []byte, strings []string, resourceIDs []uint32) (string, map[string]attribute, error) {
+	ext := int(u16(chunk, 2)) // the element follows the chunk header
+	if ext+20 > len(chunk) {
+		return "", nil, ErrInvalidManifest
+	}
+
+	name := stringAt(strings, u32(chunk, ext+4))
+	attrStart, attrSize, attrCount := int(u16(chunk, ext+8)), int(u16(chunk, ext+10)), int(u16(chunk, ext+12))
+	if attrSize < 20 || ext+attrStart+attrSize*attrCount > len(chunk) {
+		return "", nil, ErrInvalidManifest
+	}
+
+	attrs := make(map[string]attribute, attrCount)
+	for i := 0; i < attrCount; i++ {
+		a := ext + attrStart + i*attrSize
+
+		nameIndex := u32(chunk, a+4)
+		attrName := stringAt(strings, nameIndex)
+		if int(nameIndex) < len(resourceIDs) {
+			if v, ok := attrNames[resourceIDs[nameIndex]]; ok {
+				attrName = v
+			}
+		}
+
+		attr := attribute{
+			value:    stringAt(strings, u32(chunk, a+8)),
+			dataType: chunk[a+15],
+			data:     u32(chunk, a+16),
+		}
+		if attr.value == "" && attr.dataType == typeString {
+			attr.value = stringAt(strings, attr.data)
+		}
+
+		attrs[attrName] = attr
+	}
+
+	return name, attrs, nil
+}
+
+// parseStringPool decodes the strings of the pool, in UTF-8 or UTF-16.
+func parseStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, ErrInvalidManifest
+	}
+
+	headerSize := int(u16(chunk, 2))
+	count := int(u32(chunk, 8))
+	utf8 := u32(chunk, 16)&stringPoolUTF8 != 0
+	stringsStart := int(u32(chunk, 20))
+	if headerSize+4*count > len(chunk) || stringsStart > len(chunk) {
+		return nil, ErrInvalidManifest
+	}
+
+	strings := make([]string, count)
+	for i := range strings {
+		offset := stringsStart + int(u32(chunk, headerSize+4*i))
+
+		var ok bool
+		if utf8 {
+			strings[i], ok = decodeUTF8(chunk, offset)
+		} else {
+			strings[i], ok = decodeUTF16(chunk, offset)
+		}
+		if !ok {
+			return nil, ErrInvalidManifest
+		}
+	}
+
+	return strings, nil
+}
+
+// decodeUTF8 reads a string prefixed by its length in UTF-16 code units then
+// in bytes, each on one byte or two when the high bit is set.
+func decodeUTF8(b []byte, offset int) (string, bool) {
+	length := func() (int, bool) {
+		if offset >= len(b) {
+			return 0, false
+		}
+		n := int(b[offset])
+		offset++
+		if n&0x80 != 0 {
+			if offset >= len(b) {
+				return 0, false
+			}
+			n = (n&0x7f)<<8 | int(b[offset])
+			offset++
+		}
+		return n, true
+	}
+
+	if _, ok := length(); !ok {
+		return "", false
+	}
+	n, ok := length()
+	if !ok || offset+n > len(b) {
+		return "", false
+	}
+	return string(b[offset : offset+n]), true
+}
+
+// decodeUTF16 reads a string prefixed by its length in code units, on two
+// bytes or four when the high bit is set.
+func decodeUTF16(b []byte, offset int) (string, bool) {
+	if offset+2 > len(b) {
+		return "", false
+	}
+	n := int(u16(b, offset))
+	offset += 2
+	if n&0x8000 != 0 {
+		if offset+2 > len(b) {
+			return "", false
+		}
+		n = (n&0x7fff)<<16 | int(u16(b, offset))
+		offset += 2
+	}
+
+	if offset+2*n > len(b) {
+		return "", false
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = u16(b, offset+2*i)
+	}
+	return string(utf16.Decode(units)), true
+}
+
+func stringAt(strings []string, index uint32) string {
+	if index == noIndex || int(index) >= len(strings) {
+		return ""
+	}
+	return strings[index]
+}
+
+func u16(b []byte, offset int) uint16 {
+	if offset < 0 || offset+2 > len(b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b[offset:])
+}
+
+func u32(b []byte, offset int) uint32 {
+	if offset < 0 || offset+4 > len(b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b[offset:])
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package blob keeps large binary objects, e.g the uploaded APKs, out of the
+// database.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by Store.Get when there is no blob for the key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for a key that is not a relative slash
+// separated path, e.g ../secret.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store keeps blobs by key, a relative slash separated path such as
+// apks/com.example.game/42.apk.
+type Store interface {
+	// Put writes the blob, replacing any blob with the same key, and returns
+	// its size.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get fails with ErrNotFound when there is no blob for the key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete does nothing when there is no blob for the key.
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey tells whether the key stays inside the store.
+func ValidKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && key != ".." && !strings.HasPrefix(key, "../")
+}
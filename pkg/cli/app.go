@@ -0,0 +1,119 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/gosimple/slug"
+	"github.com/spf13/cobra"
+)
+
+// the app command
+var appCmd = &cobra.Command{
+	Use:   "app [show|create|versions|add|upload|promote]",
+	Short: "Manage the Android application of a game",
+	Long: `Manage the Android application of a game: show it, create it with its package name,
+list its versions, add a version by hand or from an APK whose manifest gives its metadata,
+and promote a version to be the active one`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("You must provide an action: 'show', 'create', 'versions', 'add', 'upload' or 'promote' ?")
+			return
+		}
+
+		title, _ := cmd.Flags().GetString("title")
+		if len(title) == 0 {
+			fmt.Println("You must provide the title of a game with --title")
+			return
+		}
+		// the server derives the slug of a game from its title the same way
+		path := fmt.Sprintf("games/%s/application", slug.Make(title))
+
+		switch args[0] {
+		case "show":
+			apiCall("GET", path, "")
+		case "create":
+			packageName, _ := cmd.Flags().GetString("package")
+			if len(packageName) == 0 {
+				fmt.Println("--package is a mandatory flag")
+				return
+			}
+
+			payload := struct {
+				Application NewApplication `json:"application"`
+			}{
+				NewApplication{PackageName: packageName},
+			}
+			apiCallPayload("POST", path, payload)
+		case "versions":
+			apiCall("GET", path+"/versions", "")
+		case "add":
+			version := NewApplicationVersion{}
+			if version.VersionCode, _ = cmd.Flags().GetInt("code"); version.VersionCode <= 0 {
+				fmt.Println("--code is a mandatory flag")
+				return
+			}
+			if version.MinSDK, _ = cmd.Flags().GetInt("min_sdk"); version.MinSDK <= 0 {
+				fmt.Println("--min_sdk is a mandatory flag")
+				return
+			}
+			if version.ABIs, _ = cmd.Flags().GetStringArray("abi"); len(version.ABIs) == 0 {
+				fmt.Println("--abi is a mandatory flag")
+				return
+			}
+			version.VersionName, _ = cmd.Flags().GetString("name")
+			version.TargetSDK, _ = cmd.Flags().GetInt("target_sdk")
+			version.Permissions, _ = cmd.Flags().GetStringArray("permission")
+
+			payload := struct {
+				Version NewApplicationVersion `json:"version"`
+			}{
+				version,
+			}
+			apiCallPayload("POST", path+"/versions", payload)
+		case "upload":
+			file, _ := cmd.Flags().GetString("file")
+			if len(file) == 0 {
+				fmt.Println("--file is a mandatory flag")
+				return
+			}
+			apiUpload(path+"/versions/upload", "apk", file)
+		case "promote":
+			code, _ := cmd.Flags().GetInt("code")
+			if code <= 0 {
+				fmt.Println("--code is a mandatory flag")
+				return
+			}
+			apiCall("POST", fmt.Sprintf("%s/versions/%d/promote", path, code), "")
+		default:
+			fmt.Println("Action not recognized, use 'show', 'create', 'versions', 'add', 'upload' or 'promote'")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(appCmd)
+
+	appCmd.Flags().StringP("title", "t", "", "Title of a game")
+	appCmd.Flags().String("package", "", "Android package name of the application, e.g. com.example.game")
+	appCmd.Flags().Int("code", 0, "Version code")
+	appCmd.Flags().String("name", "", "Version name, e.g. 1.2.0")
+	appCmd.Flags().Int("min_sdk", 0, "Minimum Android SDK of the version")
+	appCmd.Flags().Int("target_sdk", 0, "Target Android SDK of the version")
+	appCmd.Flags().StringArray("abi", []string{}, "ABI of the version, arm64-v8a, armeabi-v7a, x86 or x86_64, can be repeated")
+	appCmd.Flags().StringArray("permission", []string{}, "Android permission of the version, e.g. android.permission.INTERNET, can be repeated")
+	appCmd.Flags().StringP("file", "f", "", "APK to upload")
+}
@@ -49,6 +49,20 @@ var createCmd = &cobra.Command{
 				if publisher, _ := cmd.Flags().GetString("publisher"); len(publisher) > 0 {
 					createGame.Publisher = publisher
 				}
+				if values, _ := cmd.Flags().GetStringArray("rating"); len(values) > 0 {
+					ratings, err := parseRatings(values)
+					if err != nil {
+						fmt.Println(err)
+						return
+					}
+					createGame.Ratings = ratings
+				}
+				if genres, _ := cmd.Flags().GetStringArray("genre"); len(genres) > 0 {
+					createGame.Genres = genres
+				}
+				if tags, _ := cmd.Flags().GetStringArray("tag"); len(tags) > 0 {
+					createGame.Tags = tags
+				}
 
 				payload := struct {
 					Game CreateGame `json:"game"`
@@ -65,13 +79,22 @@ var createCmd = &cobra.Command{
 					fmt.Println("--email is a mandatory flag")
 					return
 				}
+				birthdate, _ := cmd.Flags().GetString("birthdate")
 				age, _ := cmd.Flags().GetInt("age")
-				if age > 0 {
+				if len(birthdate) > 0 {
+					newUser.Birthdate = birthdate
+				} else if age > 0 {
 					newUser.Age = age
 				} else {
-					fmt.Println("--age is a mandatory flag")
+					fmt.Println("--birthdate (or --age) is a mandatory flag")
 					return
 				}
+				if timezone, _ := cmd.Flags().GetString("timezone"); len(timezone) > 0 {
+					newUser.Timezone = timezone
+				}
+				if region, _ := cmd.Flags().GetString("region"); len(region) > 0 {
+					newUser.Region = region
+				}
 				username, _ := cmd.Flags().GetString("username")
 				if len(username) > 0 {
 					newUser.Username = username
@@ -110,9 +133,15 @@ func init() {
 	createCmd.Flags().String("url", "", "URL of a game")
 	createCmd.Flags().Int("age_rating", 0, "Age rating of a game")
 	createCmd.Flags().String("publisher", "", "Title of a game")
+	createCmd.Flags().StringArray("rating", []string{}, "Regional rating of a game as SYSTEM=RATING (e.g PEGI=16, ESRB=T), repeatable")
+	createCmd.Flags().StringArray("genre", []string{}, "Genre of a game (name or slug of an existing genre), repeatable")
+	createCmd.Flags().StringArray("tag", []string{}, "Tag of a game, repeatable")
 
 	createCmd.Flags().StringP("email", "e", "", "Email of a user")
 	createCmd.Flags().String("username", "", "Username of a user")
-	createCmd.Flags().Int("age", 0, "Age of a user")
+	createCmd.Flags().Int("age", 0, "Age of a user (converted to a birthdate)")
+	createCmd.Flags().String("birthdate", "", "Birthdate of a user (YYYY-MM-DD)")
+	createCmd.Flags().String("timezone", "", "IANA time zone of a user (e.g Europe/Paris)")
+	createCmd.Flags().String("region", "", "Country code of a user (e.g FR), selects the rating system")
 	createCmd.Flags().String("password", "", "Password of a user")
 }
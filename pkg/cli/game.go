@@ -0,0 +1,58 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/gosimple/slug"
+	"github.com/spf13/cobra"
+)
+
+// the game command
+var gameCmd = &cobra.Command{
+	Use:   "game [publish|deprecate|retire]",
+	Short: "Move a game through its lifecycle",
+	Long: `Move a game through its lifecycle: a draft is published to be listed and linked,
+a published game is deprecated to stop listing it while its players keep it, and
+a game is retired when it is over`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("You must provide an action: 'publish', 'deprecate' or 'retire' ?")
+			return
+		}
+
+		action := args[0]
+		if action != "publish" && action != "deprecate" && action != "retire" {
+			fmt.Println("Action not recognized, use 'publish', 'deprecate' or 'retire'")
+			return
+		}
+
+		title, _ := cmd.Flags().GetString("title")
+		if len(title) == 0 {
+			fmt.Println("You must provide the title of a game with --title")
+			return
+		}
+
+		// the server derives the slug of a game from its title the same way
+		apiCall("POST", fmt.Sprintf("games/%s/%s", slug.Make(title), action), "")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gameCmd)
+
+	gameCmd.Flags().StringP("title", "t", "", "Title of a game")
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gosimple/slug"
+	"github.com/spf13/cobra"
+)
+
+// the leaderboard command
+var leaderboardCmd = &cobra.Command{
+	Use:   "leaderboard",
+	Short: "Show the top players of a game",
+	Long:  `Show the players who played a game the most, overall or over the last day, week or month`,
+	Run: func(cmd *cobra.Command, args []string) {
+		title, _ := cmd.Flags().GetString("title")
+		if len(title) == 0 {
+			fmt.Println("You must provide the title of a game with --title")
+			return
+		}
+
+		query := ""
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 {
+			query = queryBuild(query, "limit", fmt.Sprint(limit))
+		}
+		if window, _ := cmd.Flags().GetString("window"); len(window) > 0 {
+			query = queryBuild(query, "window", window)
+		}
+
+		out := struct {
+			Window      string `json:"window"`
+			Leaderboard []struct {
+				Rank     uint   `json:"rank"`
+				Username string `json:"username"`
+				PlayTime uint   `json:"playTime"`
+			} `json:"leaderboard"`
+		}{}
+		// the server derives the slug of a game from its title the same way
+		if err := apiGet(fmt.Sprintf("games/%s/leaderboard", slug.Make(title)), query, &out); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if len(out.Leaderboard) == 0 {
+			fmt.Printf("Nobody played %q yet (window: %s)\n", title, out.Window)
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "RANK\tPLAYER\tPLAY TIME")
+		for _, e := range out.Leaderboard {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", e.Rank, e.Username, formatMinutes(e.PlayTime))
+		}
+		tw.Flush()
+	},
+}
+
+// formatMinutes renders a play time in minutes as hours and minutes.
+func formatMinutes(minutes uint) string {
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+func init() {
+	rootCmd.AddCommand(leaderboardCmd)
+
+	leaderboardCmd.Flags().StringP("title", "t", "", "Title of a game")
+	leaderboardCmd.Flags().IntP("limit", "n", 10, "Number of players to show")
+	leaderboardCmd.Flags().StringP("window", "w", "all", "Play time window: all, day, week or month")
+}
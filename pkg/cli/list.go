@@ -45,7 +45,26 @@ var listCmd = &cobra.Command{
 				if publisher, _ := cmd.Flags().GetString("publisher"); len(publisher) > 0 {
 					query = queryBuild(query, "publisher", publisher)
 				}
+				genres, _ := cmd.Flags().GetStringArray("genre")
+				for _, genre := range genres {
+					query = queryBuild(query, "genre", genre)
+				}
+				tags, _ := cmd.Flags().GetStringArray("tag")
+				for _, tag := range tags {
+					query = queryBuild(query, "tag", tag)
+				}
+				if allTags, _ := cmd.Flags().GetBool("all_tags"); allTags {
+					query = queryBuild(query, "tags_match", "all")
+				}
+				if status, _ := cmd.Flags().GetString("status"); len(status) > 0 {
+					query = queryBuild(query, "status", status)
+				}
+				if showIneligible, _ := cmd.Flags().GetBool("show-ineligible"); showIneligible {
+					query = queryBuild(query, "ineligible", "flag")
+				}
 				apiCall("GET", "games", query)
+			} else if entity == "publisher" {
+				apiCall("GET", "catalog/publishers", query)
 			} else if entity == "user" {
 				if email, _ := cmd.Flags().GetString("email"); len(email) > 0 {
 					query = queryBuild(query, "email", email)
@@ -61,7 +80,7 @@ var listCmd = &cobra.Command{
 				fmt.Println("Entity not recognized")
 			}
 		} else {
-			fmt.Println("You must provide an entity to list: 'game' or 'user' ?")
+			fmt.Println("You must provide an entity to list: 'game', 'publisher' or 'user' ?")
 		}
 	},
 }
@@ -74,6 +93,11 @@ func init() {
 	listCmd.Flags().String("url", "", "URL of a game")
 	listCmd.Flags().Int("age_rating", 0, "Age rating of a game")
 	listCmd.Flags().StringP("publisher", "p", "", "Title of a game")
+	listCmd.Flags().StringArray("genre", []string{}, "Genre of a game, repeatable to list the games in any of them")
+	listCmd.Flags().StringArray("tag", []string{}, "Tag of a game, repeatable to list the games with any of them")
+	listCmd.Flags().Bool("all_tags", false, "List the games with all the tags instead")
+	listCmd.Flags().String("status", "", "Statuses of a game, comma separated, or all (published by default)")
+	listCmd.Flags().Bool("show-ineligible", false, "Also list the games you are too young for (admins only)")
 
 	listCmd.Flags().StringP("email", "e", "", "Email of a user")
 	listCmd.Flags().String("username", "", "Username of a user")
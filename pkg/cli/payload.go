@@ -14,20 +14,31 @@
 
 package cli
 
+type GameRating struct {
+	System string `json:"system"`
+	Rating string `json:"rating"`
+}
+
 type CreateGame struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	URL         string `json:"url"`
-	AgeRating   int    `json:"ageRating"`
-	Publisher   string `json:"publisher"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	URL         string       `json:"url"`
+	AgeRating   int          `json:"ageRating"`
+	Ratings     []GameRating `json:"ratings,omitempty"`
+	Publisher   string       `json:"publisher"`
+	Genres      []string     `json:"genres,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
 }
 
 type UpdateGame struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	URL         string `json:"url"`
-	AgeRating   int    `json:"ageRating"`
-	Publisher   string `json:"publisher"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	URL         string       `json:"url"`
+	AgeRating   int          `json:"ageRating"`
+	Ratings     []GameRating `json:"ratings,omitempty"`
+	Publisher   string       `json:"publisher"`
+	Genres      []string     `json:"genres,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
 }
 
 type LoginUser struct {
@@ -36,20 +47,47 @@ type LoginUser struct {
 }
 
 type NewUser struct {
-	Age      int    `json:"age"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Age       int    `json:"age,omitempty"`
+	Birthdate string `json:"birthdate,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
 }
 
 type UpdateUser struct {
-	Age      int    `json:"age"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Age       int    `json:"age,omitempty"`
+	Birthdate string `json:"birthdate,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Username  string `json:"username"`
+	Email     string `json:"email,omitempty"`
+	Password  string `json:"password,omitempty"`
 }
 
 type LinkGame struct {
 	Game CreateGame `json:"game"`
 	User UpdateUser `json:"user"`
 }
+
+type ConfigureSimulator struct {
+	Frequency *string  `json:"frequency,omitempty"`
+	Span      *string  `json:"span,omitempty"`
+	Profile   *string  `json:"profile,omitempty"`
+	Seed      *int64   `json:"seed,omitempty"`
+	ChurnRate *float64 `json:"churnRate,omitempty"`
+}
+
+type NewApplication struct {
+	PackageName string `json:"packageName"`
+}
+
+type NewApplicationVersion struct {
+	VersionCode int      `json:"versionCode"`
+	VersionName string   `json:"versionName,omitempty"`
+	MinSDK      int      `json:"minSdk"`
+	TargetSDK   int      `json:"targetSdk,omitempty"`
+	ABIs        []string `json:"abis"`
+	Permissions []string `json:"permissions,omitempty"`
+}
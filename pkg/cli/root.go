@@ -24,8 +24,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/spf13/cobra"
@@ -91,11 +95,26 @@ func writeJWT(token string) {
 func queryBuild(query string, k string, v string) string {
 	if query == "" {
 		query += "?"
+	} else {
+		query += "&"
 	}
-	query += fmt.Sprintf("%s=%s", k, v)
+	query += fmt.Sprintf("%s=%s", url.QueryEscape(k), url.QueryEscape(v))
 	return query
 }
 
+// parseRatings turns `SYSTEM=RATING` flag values (e.g PEGI=16) into game ratings.
+func parseRatings(values []string) ([]GameRating, error) {
+	ratings := []GameRating{}
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid rating %q, expected SYSTEM=RATING (e.g PEGI=16)", v)
+		}
+		ratings = append(ratings, GameRating{System: parts[0], Rating: parts[1]})
+	}
+	return ratings, nil
+}
+
 func apiCall(verb string, path string, query string, options ...ApiCallOption) {
 	req, err := http.NewRequest(verb, fmt.Sprintf("http://0.0.0.0:%s/api/v1/%s%s", cfg.Port, path, query), nil)
 	if err != nil {
@@ -128,6 +147,92 @@ func apiCall(verb string, path string, query string, options ...ApiCallOption) {
 	fmt.Println(string(prettyJSON.Bytes()))
 }
 
+// apiGet decodes the JSON response of a GET call into out. Error responses
+// are printed as is and reported as an error.
+func apiGet(path string, query string, out interface{}) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://0.0.0.0:%s/api/v1/%s%s", cfg.Port, path, query), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", readJWT()) // Once token in ctx, the calls are authenticated
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var prettyJSON bytes.Buffer
+		if err := json.Indent(&prettyJSON, b, "", "\t"); err == nil {
+			b = prettyJSON.Bytes()
+		}
+		fmt.Println(string(b))
+		return fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// apiUpload posts the file as the field of a multipart form.
+func apiUpload(path string, field string, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer f.Close()
+
+	// stream the file rather than loading it, APKs can be large
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile(field, filepath.Base(filename))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://0.0.0.0:%s/api/v1/%s", cfg.Port, path), pr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", readJWT()) // Once token in ctx, the calls are authenticated
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var prettyJSON bytes.Buffer
+	if err := json.Indent(&prettyJSON, b, "", "\t"); err != nil {
+		log.Println("JSON parse error: ", err)
+		return
+	}
+
+	fmt.Println(string(prettyJSON.Bytes()))
+}
+
 func apiCallPayload(verb string, path string, payload interface{}, options ...ApiCallOption) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -0,0 +1,79 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// the simulator command
+var simulatorCmd = &cobra.Command{
+	Use:   "simulator [status|pause|resume|step|configure]",
+	Short: "Control the game traffic simulator",
+	Long:  `Inspect, pause, resume, single-step and reconfigure the game traffic simulator of the server (admins only)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Println("You must provide an action: 'status', 'pause', 'resume', 'step' or 'configure' ?")
+			return
+		}
+
+		switch action := args[0]; action {
+		case "status":
+			apiCall("GET", "admin/simulator", "")
+		case "pause", "resume", "step":
+			apiCallPayload("POST", "admin/simulator/"+action, struct{}{})
+		case "configure":
+			configure := ConfigureSimulator{}
+			if frequency, _ := cmd.Flags().GetString("frequency"); len(frequency) > 0 {
+				configure.Frequency = &frequency
+			}
+			if span, _ := cmd.Flags().GetString("span"); len(span) > 0 {
+				configure.Span = &span
+			}
+			if profile, _ := cmd.Flags().GetString("profile"); len(profile) > 0 {
+				configure.Profile = &profile
+			}
+			if cmd.Flags().Changed("seed") {
+				seed, _ := cmd.Flags().GetInt64("seed")
+				configure.Seed = &seed
+			}
+			if cmd.Flags().Changed("churn_rate") {
+				churnRate, _ := cmd.Flags().GetFloat64("churn_rate")
+				configure.ChurnRate = &churnRate
+			}
+
+			payload := struct {
+				Simulator ConfigureSimulator `json:"simulator"`
+			}{
+				configure,
+			}
+			apiCallPayload("PUT", "admin/simulator", payload)
+		default:
+			fmt.Println("Action not recognized")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulatorCmd)
+
+	simulatorCmd.Flags().String("frequency", "", "Wall clock time between two ticks (e.g 20s)")
+	simulatorCmd.Flags().String("span", "", "Simulated play time covered by a tick (e.g 2h)")
+	simulatorCmd.Flags().String("profile", "", "Traffic profile (e.g poisson+diurnal+weekend)")
+	simulatorCmd.Flags().Int64("seed", 1, "Seed of the random source")
+	simulatorCmd.Flags().Float64("churn_rate", 0.1, "Share of players who stopped playing (churn modifier)")
+}
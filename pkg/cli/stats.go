@@ -0,0 +1,122 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+type playTimeStats struct {
+	Players         uint    `json:"players"`
+	TotalPlayTime   uint    `json:"totalPlayTime"`
+	AveragePlayTime float64 `json:"averagePlayTime"`
+	MedianPlayTime  float64 `json:"medianPlayTime"`
+	NewLinksPerWeek []struct {
+		Links uint `json:"links"`
+	} `json:"newLinksPerWeek"`
+}
+
+// newLinks renders the weekly links, oldest week first.
+func (s playTimeStats) newLinks() string {
+	links := make([]string, 0, len(s.NewLinksPerWeek))
+	for _, w := range s.NewLinksPerWeek {
+		links = append(links, fmt.Sprint(w.Links))
+	}
+	return strings.Join(links, " ")
+}
+
+// the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats [games|publishers]",
+	Short: "Show play time statistics",
+	Long:  `Show the play time statistics of the games or of the publishers: players, total, average and median play time per player, and new links per week (oldest week first)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entity := "games"
+		if len(args) > 0 {
+			entity = args[0]
+		}
+
+		query := ""
+		if publisher, _ := cmd.Flags().GetString("publisher"); len(publisher) > 0 {
+			query = queryBuild(query, "publisher", publisher)
+		}
+		if cmd.Flags().Changed("age_rating") {
+			ageRating, _ := cmd.Flags().GetInt("age_rating")
+			query = queryBuild(query, "age_rating", fmt.Sprint(ageRating))
+		}
+		if weeks, _ := cmd.Flags().GetInt("weeks"); weeks > 0 {
+			query = queryBuild(query, "weeks", fmt.Sprint(weeks))
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+
+		switch entity {
+		case "games":
+			out := struct {
+				Games []struct {
+					Title     string `json:"title"`
+					Publisher string `json:"publisher"`
+					playTimeStats
+				} `json:"games"`
+			}{}
+			if err := apiGet("stats/games", query, &out); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			fmt.Fprintln(tw, "GAME\tPUBLISHER\tPLAYERS\tTOTAL\tAVERAGE\tMEDIAN\tNEW LINKS PER WEEK")
+			for _, g := range out.Games {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", g.Title, g.Publisher, g.Players,
+					formatMinutes(g.TotalPlayTime), formatMinutes(uint(g.AveragePlayTime+0.5)),
+					formatMinutes(uint(g.MedianPlayTime+0.5)), g.newLinks())
+			}
+		case "publishers":
+			out := struct {
+				Publishers []struct {
+					Publisher string `json:"publisher"`
+					Games     uint   `json:"games"`
+					playTimeStats
+				} `json:"publishers"`
+			}{}
+			if err := apiGet("stats/publishers", query, &out); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			fmt.Fprintln(tw, "PUBLISHER\tGAMES\tPLAYERS\tTOTAL\tAVERAGE\tMEDIAN\tNEW LINKS PER WEEK")
+			for _, p := range out.Publishers {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", p.Publisher, p.Games, p.Players,
+					formatMinutes(p.TotalPlayTime), formatMinutes(uint(p.AveragePlayTime+0.5)),
+					formatMinutes(uint(p.MedianPlayTime+0.5)), p.newLinks())
+			}
+		default:
+			fmt.Println("Entity not recognized, use 'games' or 'publishers'")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringP("publisher", "p", "", "Only the games of a publisher")
+	statsCmd.Flags().Int("age_rating", 0, "Only the games with this age rating")
+	statsCmd.Flags().IntP("weeks", "w", 8, "Number of weeks of new links")
+}
@@ -46,6 +46,20 @@ var updateCmd = &cobra.Command{
 				if publisher, _ := cmd.Flags().GetString("publisher"); len(publisher) > 0 {
 					updateGame.Publisher = publisher
 				}
+				if values, _ := cmd.Flags().GetStringArray("rating"); len(values) > 0 {
+					ratings, err := parseRatings(values)
+					if err != nil {
+						fmt.Println(err)
+						return
+					}
+					updateGame.Ratings = ratings
+				}
+				if genres, _ := cmd.Flags().GetStringArray("genre"); len(genres) > 0 {
+					updateGame.Genres = genres
+				}
+				if tags, _ := cmd.Flags().GetStringArray("tag"); len(tags) > 0 {
+					updateGame.Tags = tags
+				}
 
 				payload := struct {
 					Game UpdateGame `json:"game"`
@@ -70,6 +84,15 @@ var updateCmd = &cobra.Command{
 				if age > 0 {
 					updateUser.Age = age
 				}
+				if birthdate, _ := cmd.Flags().GetString("birthdate"); len(birthdate) > 0 {
+					updateUser.Birthdate = birthdate
+				}
+				if timezone, _ := cmd.Flags().GetString("timezone"); len(timezone) > 0 {
+					updateUser.Timezone = timezone
+				}
+				if region, _ := cmd.Flags().GetString("region"); len(region) > 0 {
+					updateUser.Region = region
+				}
 
 				password, _ := cmd.Flags().GetString("password")
 				if len(password) > 0 {
@@ -99,9 +122,15 @@ func init() {
 	updateCmd.Flags().String("url", "", "URL of a game")
 	updateCmd.Flags().Int("age_rating", 0, "Age rating of a game")
 	updateCmd.Flags().String("publisher", "", "Title of a game")
+	updateCmd.Flags().StringArray("rating", []string{}, "Regional rating of a game as SYSTEM=RATING (e.g PEGI=16, ESRB=T), repeatable")
+	updateCmd.Flags().StringArray("genre", []string{}, "Genre of a game (name or slug of an existing genre), repeatable")
+	updateCmd.Flags().StringArray("tag", []string{}, "Tag of a game, repeatable")
 
 	updateCmd.Flags().StringP("email", "e", "", "Email of a user")
 	updateCmd.Flags().String("username", "", "Username of a user")
-	updateCmd.Flags().Int("age", 0, "Age of a user")
+	updateCmd.Flags().Int("age", 0, "Age of a user (converted to a birthdate)")
+	updateCmd.Flags().String("birthdate", "", "Birthdate of a user (YYYY-MM-DD)")
+	updateCmd.Flags().String("timezone", "", "IANA time zone of a user (e.g Europe/Paris)")
+	updateCmd.Flags().String("region", "", "Country code of a user (e.g FR), selects the rating system")
 	updateCmd.Flags().String("password", "", "Password of a user")
 }
@@ -24,12 +24,35 @@ import (
 
 var DEFAULT_GAME_TRAFFIC_FREQ = 1
 var DEFAULT_GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ = 30
+var DEFAULT_GAME_TRAFFIC_PROFILE = "uniform"
+var DEFAULT_GAME_TRAFFIC_SEED int64 = 1
+var DEFAULT_GAME_TRAFFIC_BATCH_SIZE = 5000
+var DEFAULT_SESSION_HEARTBEAT_TIMEOUT = 120
+var DEFAULT_RECOMMENDATIONS_INTERVAL = 3600
+var DEFAULT_LEADER_LOCKER = "postgresql"
+var DEFAULT_LEADER_LOCK_KEY int64 = 0x616e626f78 // "anbox"
+var DEFAULT_BLOB_STORE = "file"
+var DEFAULT_BLOB_STORE_DIR = "blobs"
 
 type Config struct {
 	Port                            string
 	DbURI                           string
 	GameTrafficFreq                 time.Duration
 	GameTrafficLimitPlayTimePerFreq int32
+	GameTrafficProfile              string
+	GameTrafficSeed                 int64
+	GameTrafficPopularity           string
+	GameTrafficChurnRate            float64
+	GameTrafficBatchSize            int
+	GameTrafficRecord               string
+	GameTrafficReplay               string
+	GameTrafficReplaySpeed          float64
+	SessionHeartbeatTimeout         time.Duration
+	RecommendationsInterval         time.Duration
+	LeaderLocker                    string
+	LeaderLockKey                   int64
+	BlobStore                       string
+	BlobStoreDir                    string
 	CLIJwtFile                      string
 }
 
@@ -46,40 +69,153 @@ func EnvConfig() Config {
 		panic("POSTGRESQL_URL not provided")
 	}
 
-	var gameTrafficFreq int
+	gameTrafficFreq := DEFAULT_GAME_TRAFFIC_FREQ
 	gameTrafficFreqStr, ok := os.LookupEnv("GAME_TRAFFIC_FREQUENCY")
 
 	if !ok {
 		log.Print(fmt.Sprintf("GAME_TRAFFIC_FREQUENCY not provided. Default is %d min", DEFAULT_GAME_TRAFFIC_FREQ))
-		gameTrafficFreq = DEFAULT_GAME_TRAFFIC_FREQ
+	} else {
+		var err error
+		gameTrafficFreq, err = strconv.Atoi(gameTrafficFreqStr)
+		if err != nil {
+			panic("GAME_TRAFFIC_FREQUENCY is not an integer")
+		}
 	}
 
-	gameTrafficFreq, err := strconv.Atoi(gameTrafficFreqStr)
-	if err != nil {
-		panic("GAME_TRAFFIC_FREQUENCY is not an integer")
-	}
-
-	var gameTrafficLimitPlayTimePerFreq int32
+	gameTrafficLimitPlayTimePerFreq := int32(DEFAULT_GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ)
 	gameTrafficLimitPlayTimePerFreqStr, ok := os.LookupEnv("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ")
 
 	if !ok {
 		log.Print(fmt.Sprintf("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ not provided. Default is %d", DEFAULT_GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ))
-		gameTrafficLimitPlayTimePerFreq = int32(DEFAULT_GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ)
+	} else {
+		gameTrafficLimitPlayTimePerFreqInt, err := strconv.Atoi(gameTrafficLimitPlayTimePerFreqStr)
+		if err != nil {
+			panic("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ is not an integer")
+		}
+		if gameTrafficLimitPlayTimePerFreqInt < 0 {
+			panic("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ is 0, so there will be no traffic")
+		}
+		gameTrafficLimitPlayTimePerFreq = int32(gameTrafficLimitPlayTimePerFreqInt)
 	}
 
-	gameTrafficLimitPlayTimePerFreqInt, err := strconv.Atoi(gameTrafficLimitPlayTimePerFreqStr)
-	if err != nil {
-		panic("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ is not an integer")
+	gameTrafficProfile, ok := os.LookupEnv("GAME_TRAFFIC_PROFILE")
+	if !ok {
+		gameTrafficProfile = DEFAULT_GAME_TRAFFIC_PROFILE
 	}
-	if gameTrafficLimitPlayTimePerFreqInt < 0 {
-		panic("GAME_TRAFFIC_LIMIT_PLAY_TIME_PER_FREQ is 0, so there will be no traffic")
+
+	gameTrafficSeed := DEFAULT_GAME_TRAFFIC_SEED
+	if v, ok := os.LookupEnv("GAME_TRAFFIC_SEED"); ok {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			panic("GAME_TRAFFIC_SEED is not an integer")
+		}
+		gameTrafficSeed = seed
+	}
+
+	gameTrafficPopularity := os.Getenv("GAME_TRAFFIC_POPULARITY")
+
+	gameTrafficChurnRate := 0.1
+	if v, ok := os.LookupEnv("GAME_TRAFFIC_CHURN_RATE"); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			panic("GAME_TRAFFIC_CHURN_RATE is not a number between 0 and 1")
+		}
+		gameTrafficChurnRate = rate
+	}
+
+	gameTrafficBatchSize := DEFAULT_GAME_TRAFFIC_BATCH_SIZE
+	if v, ok := os.LookupEnv("GAME_TRAFFIC_BATCH_SIZE"); ok {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			panic("GAME_TRAFFIC_BATCH_SIZE is not a positive integer")
+		}
+		gameTrafficBatchSize = size
+	}
+
+	gameTrafficRecord := os.Getenv("GAME_TRAFFIC_RECORD")
+	gameTrafficReplay := os.Getenv("GAME_TRAFFIC_REPLAY")
+
+	gameTrafficReplaySpeed := 1.0
+	if v, ok := os.LookupEnv("GAME_TRAFFIC_REPLAY_SPEED"); ok {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed < 0 {
+			panic("GAME_TRAFFIC_REPLAY_SPEED is not a positive number")
+		}
+		gameTrafficReplaySpeed = speed
+	}
+
+	sessionHeartbeatTimeout := DEFAULT_SESSION_HEARTBEAT_TIMEOUT
+	if v, ok := os.LookupEnv("SESSION_HEARTBEAT_TIMEOUT"); ok {
+		timeout, err := strconv.Atoi(v)
+		if err != nil || timeout <= 0 {
+			panic("SESSION_HEARTBEAT_TIMEOUT is not a positive integer")
+		}
+		sessionHeartbeatTimeout = timeout
+	}
+
+	recommendationsInterval := DEFAULT_RECOMMENDATIONS_INTERVAL
+	if v, ok := os.LookupEnv("RECOMMENDATIONS_INTERVAL"); ok {
+		interval, err := strconv.Atoi(v)
+		if err != nil || interval <= 0 {
+			panic("RECOMMENDATIONS_INTERVAL is not a positive integer")
+		}
+		recommendationsInterval = interval
+	}
+
+	leaderLocker := DEFAULT_LEADER_LOCKER
+	if v, ok := os.LookupEnv("LEADER_LOCKER"); ok {
+		if v != "postgresql" && v != "local" {
+			panic("LEADER_LOCKER must be postgresql or local")
+		}
+		leaderLocker = v
+	}
+
+	leaderLockKey := DEFAULT_LEADER_LOCK_KEY
+	if v, ok := os.LookupEnv("LEADER_LOCK_KEY"); ok {
+		key, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			panic("LEADER_LOCK_KEY is not an integer")
+		}
+		leaderLockKey = key
+	}
+
+	blobStore := DEFAULT_BLOB_STORE
+	if v, ok := os.LookupEnv("BLOB_STORE"); ok {
+		if v != "file" {
+			panic("BLOB_STORE must be file")
+		}
+		blobStore = v
+	}
+
+	blobStoreDir := DEFAULT_BLOB_STORE_DIR
+	if v, ok := os.LookupEnv("BLOB_STORE_DIR"); ok && v != "" {
+		blobStoreDir = v
 	}
-	gameTrafficLimitPlayTimePerFreq = int32(gameTrafficLimitPlayTimePerFreqInt)
 
 	CLIJwtFile, ok := os.LookupEnv("CLI_JWT_FILE")
 	if !ok {
 		panic("CLI_JWT_FILE not provided")
 	}
 
-	return Config{port, dbURI, time.Duration(int32(gameTrafficFreq)) * time.Second, gameTrafficLimitPlayTimePerFreq, CLIJwtFile}
+	return Config{
+		Port:                            port,
+		DbURI:                           dbURI,
+		GameTrafficFreq:                 time.Duration(int32(gameTrafficFreq)) * time.Second,
+		GameTrafficLimitPlayTimePerFreq: gameTrafficLimitPlayTimePerFreq,
+		GameTrafficProfile:              gameTrafficProfile,
+		GameTrafficSeed:                 gameTrafficSeed,
+		GameTrafficPopularity:           gameTrafficPopularity,
+		GameTrafficChurnRate:            gameTrafficChurnRate,
+		GameTrafficBatchSize:            gameTrafficBatchSize,
+		GameTrafficRecord:               gameTrafficRecord,
+		GameTrafficReplay:               gameTrafficReplay,
+		GameTrafficReplaySpeed:          gameTrafficReplaySpeed,
+		SessionHeartbeatTimeout:         time.Duration(sessionHeartbeatTimeout) * time.Second,
+		RecommendationsInterval:         time.Duration(recommendationsInterval) * time.Second,
+		LeaderLocker:                    leaderLocker,
+		LeaderLockKey:                   leaderLockKey,
+		BlobStore:                       blobStore,
+		BlobStoreDir:                    blobStoreDir,
+		CLIJwtFile:                      CLIJwtFile,
+	}
 }
@@ -0,0 +1,151 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package leader elects a single replica to run the background jobs.
+package leader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultRetryInterval is how often a follower tries to take the lead.
+const DefaultRetryInterval = 5 * time.Second
+
+// ErrNotAcquired is returned by Locker.TryLock when another replica holds the lock.
+var ErrNotAcquired = errors.New("lock held by another replica")
+
+// Locker hands out an exclusive lock shared by every replica.
+type Locker interface {
+	// TryLock returns immediately, with ErrNotAcquired when the lock is taken.
+	TryLock(ctx context.Context) (Lock, error)
+}
+
+// Lock is a held lock.
+type Lock interface {
+	// Lost is closed when the lock is no longer held, e.g the connection
+	// backing it dropped.
+	Lost() <-chan struct{}
+	Release(ctx context.Context) error
+}
+
+// Job runs until stop is closed.
+type Job func(stop <-chan struct{})
+
+// All runs the jobs concurrently, as a single job.
+func All(jobs ...Job) Job {
+	return func(stop <-chan struct{}) {
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job Job) {
+				defer wg.Done()
+				job(stop)
+			}(job)
+		}
+		wg.Wait()
+	}
+}
+
+// Elector runs a job on the replica holding the lock only, and hands it over
+// to another replica when the lock is lost.
+type Elector struct {
+	locker   Locker
+	interval time.Duration
+
+	mu     sync.Mutex
+	leader bool
+}
+
+func NewElector(locker Locker, interval time.Duration) *Elector {
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+	return &Elector{locker: locker, interval: interval}
+}
+
+// IsLeader reports whether this replica currently runs the job.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
+
+// Run campaigns until stop is closed or receives a value. Each time the lock
+// is acquired the job runs until either the lock is lost or Run is stopped.
+func (e *Elector) Run(stop <-chan struct{}, job Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	retry := time.NewTicker(e.interval)
+	defer retry.Stop()
+
+	for {
+		lock, err := e.locker.TryLock(ctx)
+		switch {
+		case err == nil:
+			if stopped := e.lead(ctx, lock, stop, job); stopped {
+				return
+			}
+		case errors.Is(err, ErrNotAcquired):
+		default:
+			log.Printf("leader election failed: %v", err)
+		}
+
+		select {
+		case <-retry.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// lead runs the job while the lock is held, and reports whether Run was stopped.
+func (e *Elector) lead(ctx context.Context, lock Lock, stop <-chan struct{}, job Job) bool {
+	log.Print("elected leader, starting background jobs")
+	e.setLeader(true)
+	defer e.setLeader(false)
+
+	jobStop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		job(jobStop)
+	}()
+
+	stopped := false
+	select {
+	case <-lock.Lost():
+		log.Print("leadership lost, stopping background jobs")
+	case <-stop:
+		stopped = true
+	}
+
+	close(jobStop)
+	<-done
+
+	if err := lock.Release(ctx); err != nil {
+		log.Printf("cannot release leader lock: %v", err)
+	}
+	return stopped
+}
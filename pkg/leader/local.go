@@ -0,0 +1,75 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"sync"
+)
+
+// LocalLocker is an in-process Locker, for a single replica or for electors
+// sharing the same process.
+type LocalLocker struct {
+	mu   sync.Mutex
+	held *localLock
+}
+
+var _ Locker = (*LocalLocker)(nil)
+
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{}
+}
+
+func (l *LocalLocker) TryLock(ctx context.Context) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held != nil {
+		return nil, ErrNotAcquired
+	}
+	l.held = &localLock{locker: l, lost: make(chan struct{})}
+	return l.held, nil
+}
+
+// Revoke takes the lock away from its holder, as a dropped connection would.
+func (l *LocalLocker) Revoke() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held != nil {
+		close(l.held.lost)
+		l.held = nil
+	}
+}
+
+type localLock struct {
+	locker *LocalLocker
+	lost   chan struct{}
+}
+
+func (l *localLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *localLock) Release(ctx context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	if l.locker.held == l {
+		close(l.lost)
+		l.locker.held = nil
+	}
+	return nil
+}
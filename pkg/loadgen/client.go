@@ -0,0 +1,175 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// client talks to the REST API as a single virtual user.
+type client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+	stats   *Stats
+}
+
+// do sends the request, records its latency under op and decodes the
+// response into out when given. Non 2xx responses are errors.
+func (c *client) do(ctx context.Context, op, verb, path string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, verb, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.stats.record(op, time.Since(start), 0)
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	c.stats.record(op, time.Since(start), resp.StatusCode)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %d %s", verb, path, resp.StatusCode, bytes.TrimSpace(b))
+	}
+	if out != nil && len(b) > 0 {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+func (c *client) register(ctx context.Context, email, username, password string) error {
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{
+			"email":    email,
+			"username": username,
+			"password": password,
+			"age":      30,
+		},
+	}
+	return c.do(ctx, "register", "POST", "/users", payload, nil)
+}
+
+func (c *client) login(ctx context.Context, email, password string) error {
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{
+			"email":    email,
+			"password": password,
+		},
+	}
+	out := struct {
+		UserWithMetadata struct {
+			User struct {
+				Token string `json:"token"`
+			} `json:"user"`
+		} `json:"userWithMetadata"`
+	}{}
+	if err := c.do(ctx, "login", "POST", "/users/login", payload, &out); err != nil {
+		return err
+	}
+	c.token = out.UserWithMetadata.User.Token
+	return nil
+}
+
+// createGame returns the slug of the new game.
+func (c *client) createGame(ctx context.Context, title string) (string, error) {
+	payload := map[string]interface{}{
+		"game": map[string]interface{}{
+			"title":       title,
+			"description": "synthetic game created by anbox-sim",
+			"publisher":   "anbox-sim",
+		},
+	}
+	out := struct {
+		Game struct {
+			Slug string `json:"slug"`
+		} `json:"game"`
+	}{}
+	if err := c.do(ctx, "create_game", "POST", "/games", payload, &out); err != nil {
+		return "", err
+	}
+	// games start as drafts, which cannot be linked
+	if err := c.do(ctx, "publish_game", "POST", "/games/"+out.Game.Slug+"/publish", nil, nil); err != nil {
+		return "", err
+	}
+	return out.Game.Slug, nil
+}
+
+func (c *client) link(ctx context.Context, username, title string) error {
+	payload := map[string]interface{}{
+		"user": map[string]interface{}{"username": username},
+		"game": map[string]interface{}{"title": title},
+	}
+	return c.do(ctx, "link", "POST", "/games/link", payload, nil)
+}
+
+func (c *client) browse(ctx context.Context) error {
+	return c.do(ctx, "browse", "GET", "/catalog/games?limit=20", nil, nil)
+}
+
+func (c *client) search(ctx context.Context, title string) error {
+	return c.do(ctx, "search", "GET", "/games?title="+url.QueryEscape(title), nil, nil)
+}
+
+func (c *client) startSession(ctx context.Context, slug string) (uint, error) {
+	payload := map[string]interface{}{
+		"session": map[string]interface{}{"game": slug},
+	}
+	out := struct {
+		Session struct {
+			ID uint `json:"id"`
+		} `json:"session"`
+	}{}
+	if err := c.do(ctx, "session_start", "POST", "/sessions", payload, &out); err != nil {
+		return 0, err
+	}
+	return out.Session.ID, nil
+}
+
+func (c *client) heartbeat(ctx context.Context, id uint) error {
+	return c.do(ctx, "session_heartbeat", "POST", fmt.Sprintf("/sessions/%d/heartbeat", id), nil, nil)
+}
+
+func (c *client) endSession(ctx context.Context, id uint) error {
+	return c.do(ctx, "session_end", "POST", fmt.Sprintf("/sessions/%d/end", id), nil, nil)
+}
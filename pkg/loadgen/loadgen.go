@@ -0,0 +1,212 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadgen drives a running server through its REST API with
+// synthetic users, to load-test it end to end.
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	BaseURL     string        // e.g http://localhost:6000/api/v1
+	Users       int           // virtual users registered by the run
+	Games       int           // games created before the users start
+	Concurrency int           // virtual users running at the same time
+	Rate        float64       // requests per second across all users, 0 for no limit
+	Duration    time.Duration // upper bound of the run once the games exist
+	Seed        int64
+	Timeout     time.Duration // per request
+}
+
+// Run creates the games, then registers the users who link, play and browse games
+// until every user played or the duration elapses. Failed requests are
+// counted in the stats, only a failed setup aborts the run.
+func Run(ctx context.Context, cfg Config) (*Stats, error) {
+	if cfg.Users <= 0 || cfg.Games <= 0 || cfg.Concurrency <= 0 {
+		return nil, errors.New("users, games and concurrency must be positive")
+	}
+
+	stats := NewStats()
+	httpClient := &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.Concurrency,
+			MaxIdleConnsPerHost: cfg.Concurrency,
+		},
+	}
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+
+	limiter, stopLimiter := newLimiter(cfg.Rate)
+	defer stopLimiter()
+
+	// names are unique per run so that runs do not collide on the same server
+	run := fmt.Sprintf("%x", time.Now().UnixNano())
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+
+	titles := make([]string, cfg.Games)
+	for i := range titles {
+		titles[i] = fmt.Sprintf("sim %s game %d", run, i)
+	}
+	slugs := map[string]string{}
+
+	// the first user also creates the games
+	owner := &client{http: httpClient, baseURL: baseURL, stats: stats}
+	if err := setupUser(ctx, owner, run, 0, limiter); err != nil {
+		return stats, fmt.Errorf("cannot set up the first user: %w", err)
+	}
+	for _, title := range titles {
+		if err := wait(ctx, limiter); err != nil {
+			return stats, err
+		}
+		slug, err := owner.createGame(ctx, title)
+		if err != nil {
+			return stats, fmt.Errorf("cannot create game %q: %w", title, err)
+		}
+		slugs[title] = slug
+	}
+	log.Printf("created %d games, starting %d users with a concurrency of %d", cfg.Games, cfg.Users, cfg.Concurrency)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	users := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		seed := rnd.Int63()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for n := range users {
+				c := &client{http: httpClient, baseURL: baseURL, stats: stats}
+				if err := setupUser(ctx, c, run, n, limiter); err != nil {
+					continue
+				}
+				play(ctx, c, fmt.Sprintf("sim%s%d", run, n), titles, slugs, r, limiter)
+			}
+		}()
+	}
+
+feed:
+	for n := 1; n <= cfg.Users; n++ {
+		select {
+		case users <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(users)
+	wg.Wait()
+
+	return stats, nil
+}
+
+func setupUser(ctx context.Context, c *client, run string, n int, limiter <-chan time.Time) error {
+	username := fmt.Sprintf("sim%s%d", run, n)
+	email := username + "@anbox-sim.test"
+	password := "anbox-sim-" + run
+
+	if err := wait(ctx, limiter); err != nil {
+		return err
+	}
+	if err := c.register(ctx, email, username, password); err != nil {
+		return err
+	}
+	if err := wait(ctx, limiter); err != nil {
+		return err
+	}
+	return c.login(ctx, email, password)
+}
+
+// play links the user to a few games, plays a session on each of them, then
+// browses the catalog and searches games. Its share of the run is one slot
+// of the pool, so users take turns when there are more users than workers.
+func play(ctx context.Context, c *client, username string, titles []string, slugs map[string]string, r *rand.Rand, limiter <-chan time.Time) {
+	linked := map[string]bool{}
+	for i := 0; i < 1+r.Intn(3); i++ {
+		title := titles[r.Intn(len(titles))]
+		if linked[title] {
+			continue
+		}
+		if err := wait(ctx, limiter); err != nil {
+			return
+		}
+		if err := c.link(ctx, username, title); err == nil {
+			linked[title] = true
+		}
+	}
+
+	for title := range linked {
+		if err := wait(ctx, limiter); err != nil {
+			return
+		}
+		id, err := c.startSession(ctx, slugs[title])
+		if err != nil {
+			continue
+		}
+		for i := 0; i < 1+r.Intn(3); i++ {
+			if err := wait(ctx, limiter); err != nil {
+				return
+			}
+			c.heartbeat(ctx, id)
+		}
+		if err := wait(ctx, limiter); err != nil {
+			return
+		}
+		c.endSession(ctx, id)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := wait(ctx, limiter); err != nil {
+			return
+		}
+		if r.Intn(2) == 0 {
+			c.browse(ctx)
+		} else {
+			c.search(ctx, titles[r.Intn(len(titles))])
+		}
+	}
+}
+
+// newLimiter returns a channel delivering one token per request, or nil
+// when the rate is unlimited.
+func newLimiter(rate float64) (<-chan time.Time, func()) {
+	if rate <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	return ticker.C, ticker.Stop
+}
+
+func wait(ctx context.Context, limiter <-chan time.Time) error {
+	if limiter == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-limiter:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats collects the latencies and outcomes of every request, per operation.
+type Stats struct {
+	mu    sync.Mutex
+	start time.Time
+	ops   map[string]*opStats
+}
+
+type opStats struct {
+	latencies []time.Duration
+	errors    int
+	codes     map[int]int // 0 stands for transport errors
+}
+
+func NewStats() *Stats {
+	return &Stats{start: time.Now(), ops: map[string]*opStats{}}
+}
+
+func (s *Stats) record(op string, latency time.Duration, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.ops[op]
+	if !ok {
+		o = &opStats{codes: map[int]int{}}
+		s.ops[op] = o
+	}
+	o.latencies = append(o.latencies, latency)
+	o.codes[code]++
+	if code < 200 || code >= 300 {
+		o.errors++
+	}
+}
+
+// percentile expects sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// Report prints one line per operation plus a total.
+func (s *Stats) Report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.start)
+	names := make([]string, 0, len(s.ops))
+	for name := range s.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OPERATION\tREQUESTS\tERRORS\tERROR RATE\tRPS\tP50\tP90\tP99\tMAX\t")
+
+	all := []time.Duration{}
+	totalErrors := 0
+	for _, name := range names {
+		o := s.ops[name]
+		s.writeLine(tw, name, o.latencies, o.errors, elapsed)
+		all = append(all, o.latencies...)
+		totalErrors += o.errors
+	}
+	s.writeLine(tw, "total", all, totalErrors, elapsed)
+	tw.Flush()
+
+	for _, name := range names {
+		o := s.ops[name]
+		if o.errors == 0 {
+			continue
+		}
+		codes := make([]int, 0, len(o.codes))
+		for code := range o.codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		fmt.Fprintf(w, "%s status codes:", name)
+		for _, code := range codes {
+			fmt.Fprintf(w, " %d=%d", code, o.codes[code])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (s *Stats) writeLine(w io.Writer, name string, latencies []time.Duration, errors int, elapsed time.Duration) {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rate := 0.0
+	if len(sorted) > 0 {
+		rate = float64(errors) / float64(len(sorted)) * 100
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%.1f\t%s\t%s\t%s\t%s\t\n",
+		name, len(sorted), errors, rate, float64(len(sorted))/elapsed.Seconds(),
+		round(percentile(sorted, 50)), round(percentile(sorted, 90)),
+		round(percentile(sorted, 99)), round(percentile(sorted, 100)))
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
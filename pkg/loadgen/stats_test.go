@@ -0,0 +1,84 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		latencies := make([]time.Duration, len(values))
+		for i, v := range values {
+			latencies[i] = time.Duration(v) * time.Millisecond
+		}
+		return latencies
+	}
+	ten := ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{"no latency", nil, 50, 0},
+		{"single latency", ms(7), 99, 7 * time.Millisecond},
+		{"median", ten, 50, 5 * time.Millisecond},
+		{"p90", ten, 90, 9 * time.Millisecond},
+		{"p99 rounds up", ten, 99, 10 * time.Millisecond},
+		{"max", ten, 100, 10 * time.Millisecond},
+		{"min", ten, 0, time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.latencies, tt.p); got != tt.want {
+				t.Errorf("percentile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		codes  []int
+		errors int
+	}{
+		{"successes", []int{200, 201, 204}, 0},
+		{"client and server errors", []int{200, 404, 422, 503}, 3},
+		{"transport errors", []int{0, 0, 200}, 2},
+		{"redirects", []int{301, 200}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStats()
+			for _, code := range tt.codes {
+				s.record("op", time.Millisecond, code)
+			}
+
+			o := s.ops["op"]
+			if len(o.latencies) != len(tt.codes) {
+				t.Errorf("recorded %d latencies, want %d", len(o.latencies), len(tt.codes))
+			}
+			if o.errors != tt.errors {
+				t.Errorf("counted %d errors, want %d", o.errors, tt.errors)
+			}
+		})
+	}
+}
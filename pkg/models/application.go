@@ -0,0 +1,103 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"regexp"
+	"time"
+)
+
+// ABIs are the Android ABIs Anbox Cloud can run.
+var ABIs = []string{"arm64-v8a", "armeabi-v7a", "x86", "x86_64"}
+
+// packageNameRegexp follows the Android rules: at least two segments made
+// of letters, digits and underscores, each starting with a letter.
+var packageNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*(\.[a-zA-Z][a-zA-Z0-9_]*)+$`)
+
+// ValidPackageName tells whether the name is a valid Android package name,
+// e.g. com.example.game.
+func ValidPackageName(name string) bool {
+	return packageNameRegexp.MatchString(name)
+}
+
+// Application is the Android application of a game. Players are served its
+// active version.
+type Application struct {
+	ID              uint                `json:"-"`
+	GameID          uint                `json:"-" db:"game_id"`
+	PackageName     string              `json:"packageName" db:"package_name"`
+	ActiveVersionID *uint               `json:"-" db:"active_version_id"`
+	ActiveVersion   *ApplicationVersion `json:"activeVersion" db:"-"`
+	CreatedAt       time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time           `json:"updatedAt" db:"updated_at"`
+}
+
+type ApplicationVersion struct {
+	ID            uint      `json:"-"`
+	ApplicationID uint      `json:"-" db:"application_id"`
+	VersionCode   uint      `json:"versionCode" db:"version_code"`
+	VersionName   string    `json:"versionName" db:"version_name"`
+	MinSDK        uint      `json:"minSdk" db:"min_sdk"`
+	TargetSDK     uint      `json:"targetSdk" db:"target_sdk"` // 0 when unknown
+	ABIs          []string  `json:"abis" db:"-"`
+	Permissions   []string  `json:"permissions" db:"-"`
+	UploadedAt    time.Time `json:"uploadedAt" db:"uploaded_at"`
+	Active        bool      `json:"active" db:"-"`
+
+	// The uploaded APK in the blob store, none for the versions added by hand
+	APKKey    string `json:"-" db:"apk_key"`
+	APKSize   int64  `json:"apkSize,omitempty" db:"apk_size"`
+	APKSHA256 string `json:"apkSha256,omitempty" db:"apk_sha256"`
+}
+
+// IsActive tells whether the version is the one players are served.
+func (app *Application) IsActive(v *ApplicationVersion) bool {
+	return app.ActiveVersionID != nil && *app.ActiveVersionID == v.ID
+}
+
+// Activate makes the version the active one, whether it is newer than the
+// active one or not.
+func (app *Application) Activate(v *ApplicationVersion) {
+	if app.ActiveVersion != nil {
+		app.ActiveVersion.Active = false
+	}
+	app.ActiveVersionID, app.ActiveVersion = &v.ID, v
+	v.Active = true
+}
+
+// HasAPK tells whether the APK of the version was uploaded.
+func (v *ApplicationVersion) HasAPK() bool {
+	return v.APKKey != ""
+}
+
+type ApplicationService interface {
+	CreateApplication(context.Context, *Application) error
+	// GameApplication fails with ErrNotFound when the game has no application.
+	GameApplication(ctx context.Context, gameID uint) (*Application, error)
+
+	// ApplicationVersions lists the versions of an application, the latest
+	// version code first.
+	ApplicationVersions(ctx context.Context, app *Application) ([]*ApplicationVersion, error)
+	// CreateApplicationVersion adds a version to the application, the first
+	// one becoming active.
+	CreateApplicationVersion(ctx context.Context, app *Application, version *ApplicationVersion) error
+	// ApplicationVersion fails with ErrNotFound when the application has no
+	// version with this code.
+	ApplicationVersion(ctx context.Context, app *Application, versionCode uint) (*ApplicationVersion, error)
+	// PromoteApplicationVersion makes the version with this code the active
+	// one, failing with ErrNotFound when there is none.
+	PromoteApplicationVersion(ctx context.Context, app *Application, versionCode uint) error
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "testing"
+
+func TestValidPackageName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"com.example.game", true},
+		{"com.Example_2.game_3", true},
+		{"a.b", true},
+		{"game", false},
+		{"com..game", false},
+		{"com.example.", false},
+		{"com.2example", false},
+		{"_com.example", false},
+		{"com.example-game", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidPackageName(tt.name); got != tt.valid {
+				t.Errorf("ValidPackageName(%q) = %v, want %v", tt.name, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestApplicationActivate(t *testing.T) {
+	v1 := &ApplicationVersion{ID: 1, VersionCode: 10}
+	v2 := &ApplicationVersion{ID: 2, VersionCode: 20}
+	v3 := &ApplicationVersion{ID: 3, VersionCode: 30}
+
+	tests := []struct {
+		name     string
+		activate *ApplicationVersion // nil activates nothing
+		active   *ApplicationVersion
+	}{
+		{"no version", nil, nil},
+		{"first version", v1, v1},
+		{"roll out", v3, v3},
+		{"roll back", v2, v2},
+		{"active again", v2, v2},
+	}
+
+	app := &Application{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.activate != nil {
+				app.Activate(tt.activate)
+			}
+			if app.ActiveVersion != tt.active {
+				t.Errorf("active version = %v, want %v", app.ActiveVersion, tt.active)
+			}
+			for _, v := range []*ApplicationVersion{v1, v2, v3} {
+				want := v == tt.active
+				if app.IsActive(v) != want || v.Active != want {
+					t.Errorf("version %d active = %v (flag %v), want %v", v.VersionCode, app.IsActive(v), v.Active, want)
+				}
+			}
+		})
+	}
+}
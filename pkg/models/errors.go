@@ -19,7 +19,33 @@ import "errors"
 var (
 	ErrDuplicateEmail    = errors.New("duplicate email")
 	ErrDuplicateUsername = errors.New("duplicate username")
+	ErrDuplicateSlug     = errors.New("duplicate slug")
 	ErrNotFound          = errors.New("record not found")
 	ErrUnAuthorized      = errors.New("unauthorized")
 	ErrInternal          = errors.New("internal error")
+
+	ErrDuplicateGuardianship = errors.New("duplicate guardianship")
+	ErrLinkRequestDecided    = errors.New("link request already decided")
+	ErrAlreadyLinked         = errors.New("game already linked")
+	ErrPlayTimeLimitReached  = errors.New("play time limit reached")
+
+	ErrTraceReplayConflict = errors.New("trace replay progressed concurrently")
+
+	ErrPlaySessionInProgress = errors.New("a play session is already in progress")
+	ErrPlaySessionEnded      = errors.New("play session already ended")
+	ErrPlaySessionExpired    = errors.New("play session expired")
+
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrUnknownGenre   = errors.New("unknown genre")
+	ErrDuplicateTag   = errors.New("duplicate tag")
+
+	ErrDuplicatePublisher = errors.New("duplicate publisher")
+	ErrPublisherHasGames  = errors.New("publisher has games")
+
+	ErrInvalidGameTransition = errors.New("invalid game status transition")
+	ErrGameNotLinkable       = errors.New("game not linkable")
+
+	ErrDuplicateApplication = errors.New("duplicate application")
+	ErrDuplicatePackageName = errors.New("duplicate package name")
+	ErrDuplicateVersion     = errors.New("duplicate application version")
 )
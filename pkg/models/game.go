@@ -16,43 +16,148 @@ package models
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
+// GameStatus is the lifecycle status of a game. Drafts are only seen by the
+// ones managing them, published games are listed and linkable, deprecated
+// games are still playable by their players but not listed and retired
+// games are over.
+type GameStatus string
+
+const (
+	GameDraft      GameStatus = "draft"
+	GamePublished  GameStatus = "published"
+	GameDeprecated GameStatus = "deprecated"
+	GameRetired    GameStatus = "retired"
+)
+
+var GameStatuses = []GameStatus{GameDraft, GamePublished, GameDeprecated, GameRetired}
+
+// gameTransitions lists the statuses a game can go to from each status.
+var gameTransitions = map[GameStatus][]GameStatus{
+	GameDraft:      {GamePublished, GameRetired},
+	GamePublished:  {GameDeprecated, GameRetired},
+	GameDeprecated: {GamePublished, GameRetired},
+}
+
+func (s GameStatus) Valid() bool {
+	for _, status := range GameStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CanBecome tells whether a game with this status can go to the other one.
+func (s GameStatus) CanBecome(to GameStatus) bool {
+	for _, status := range gameTransitions[s] {
+		if to == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Linkable tells whether players can link a game with this status.
+func (s GameStatus) Linkable() bool {
+	return s == GamePublished || s == GameDeprecated
+}
+
 type Game struct {
-	ID          uint      `json:"-"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	URL         string    `json:"url"`
-	AgeRating   uint      `json:"ageRating" db:"age_rating"`
-	Publisher   string    `json:"publisher"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+	ID          uint         `json:"-"`
+	Title       string       `json:"title"`
+	Slug        string       `json:"slug"`
+	Description string       `json:"description"`
+	URL         string       `json:"url"`
+	AgeRating   uint         `json:"ageRating" db:"age_rating"`
+	Ratings     []GameRating `json:"ratings" db:"-"`
+	PublisherID *uint        `json:"-" db:"publisher_id"`
+	Publisher   string       `json:"publisher" db:"-"` // name, a new one creates the publisher
+	Genres      []string     `json:"genres" db:"-"`    // slugs
+	Tags        []string     `json:"tags" db:"-"`
+	Status      GameStatus   `json:"status"`
+	CreatedAt   time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updatedAt" db:"updated_at"`
+
+	// When the game last entered each status
+	PublishedAt  *time.Time `json:"publishedAt" db:"published_at"`
+	DeprecatedAt *time.Time `json:"deprecatedAt" db:"deprecated_at"`
+	RetiredAt    *time.Time `json:"retiredAt" db:"retired_at"`
+
+	// Set by Localize for the region of the reader
+	RegionalRating *GameRating `json:"regionalRating,omitempty" db:"-"`
+	MinimumAge     uint        `json:"minimumAge" db:"-"`
+
+	// Set by CheckEligibility for the reader
+	Eligible          *bool  `json:"eligible,omitempty" db:"-"`
+	EligibilityReason string `json:"eligibilityReason,omitempty" db:"-"`
+}
+
+// CheckEligibility localizes the game for the user and records whether the
+// user is old enough to play it, and why not.
+func (g *Game) CheckEligibility(u *User) bool {
+	g.Localize(u.Region)
+	eligible := u.Age >= g.MinimumAge
+	g.Eligible = &eligible
+	g.EligibilityReason = ""
+
+	if !eligible {
+		if r := g.RegionalRating; r != nil {
+			g.EligibilityReason = fmt.Sprintf("rated %s %s, requires age %d", r.System, r.Rating, g.MinimumAge)
+		} else {
+			g.EligibilityReason = fmt.Sprintf("requires age %d", g.MinimumAge)
+		}
+	}
+
+	return eligible
 }
 
 type GameFilter struct {
 	ID          *uint
 	Title       *string
+	Slug        *string
+	Search      *string // matches the title or the description
 	Description *string
 	URL         *string
 	AgeRating   *uint
-	Publisher   *string
+	Publisher   *string  // name, in any spelling
+	Genres      []string // slugs, the games in any of them
+	Tags        []string // the games with any of them, or all of them with AllTags
+	AllTags     bool
+	Statuses    []GameStatus // any status when empty
+	EligibleFor *GameEligibility
 
 	Limit  int
 	Offset int
 }
 
+// GameEligibility keeps the games a player of Age may play in Region, as told
+// by Game.MinimumAgeFor.
+type GameEligibility struct {
+	Age    uint
+	Region string
+}
+
 type GamePatch struct {
 	Title       *string
 	Description *string
 	URL         *string
 	AgeRating   *uint
-	Publisher   *string
+	Ratings     *[]GameRating // replaces all the ratings of the game
+	Publisher   *string       // name, a new one creates the publisher, empty for none
+	Genres      *[]string     // replaces all the genres of the game
+	Tags        *[]string     // replaces all the tags of the game
 }
 
 type GameService interface {
 	CreateGame(context.Context, *Game) error
 	Games(context.Context, GameFilter) ([]*Game, error)
 	UpdateGame(context.Context, *Game, GamePatch) error
+	// SetGameStatus moves the game to the status, failing with
+	// ErrInvalidGameTransition when its current status does not allow it.
+	SetGameStatus(context.Context, *Game, GameStatus) error
 	DeleteGame(context.Context, uint) error
 }
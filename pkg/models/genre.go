@@ -0,0 +1,49 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Genre is a curated category of games, referred to by its slug.
+type Genre struct {
+	ID         uint      `json:"-"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	GamesCount uint      `json:"gamesCount" db:"games_count"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type GenreFilter struct {
+	ID   *uint
+	Slug *string
+
+	Limit  int
+	Offset int
+}
+
+type GenrePatch struct {
+	Name *string
+}
+
+type GenreService interface {
+	CreateGenre(context.Context, *Genre) error
+	Genres(context.Context, GenreFilter) ([]*Genre, error)
+	UpdateGenre(context.Context, *Genre, GenrePatch) error
+	DeleteGenre(context.Context, uint) error
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// AgeOfMajority is the age under which a user is considered a minor and can
+// be placed under parental controls.
+const AgeOfMajority = 18
+
+// Model the link between a guardian account and a minor account along with
+// the parental controls the guardian set on the minor.
+type Guardianship struct {
+	ID                   uint      `json:"-"`
+	GuardianID           uint      `json:"-" db:"guardian_id"`
+	Guardian             *User     `json:"guardian"`
+	MinorID              uint      `json:"-" db:"minor_id"`
+	Minor                *User     `json:"minor"`
+	ApprovalAgeThreshold uint      `json:"approvalAgeThreshold" db:"approval_age_threshold"`
+	DailyPlayTimeLimit   *uint     `json:"dailyPlayTimeLimit" db:"daily_play_time_limit"`   // in minutes, nil means unlimited
+	WeeklyPlayTimeLimit  *uint     `json:"weeklyPlayTimeLimit" db:"weekly_play_time_limit"` // in minutes, nil means unlimited
+	CreatedAt            time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt            time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// RequiresApproval reports whether linking the minor to a game with the given
+// age rating must be approved by the guardian first.
+func (g *Guardianship) RequiresApproval(ageRating uint) bool {
+	return ageRating > g.ApprovalAgeThreshold
+}
+
+type GuardianshipFilter struct {
+	ID         *uint
+	GuardianID *uint
+	MinorID    *uint
+
+	Limit  int
+	Offset int
+}
+
+type GuardianshipPatch struct {
+	ApprovalAgeThreshold *uint
+	DailyPlayTimeLimit   *uint
+	WeeklyPlayTimeLimit  *uint
+	// Unset* remove the corresponding limit
+	UnsetDailyPlayTimeLimit  bool
+	UnsetWeeklyPlayTimeLimit bool
+}
+
+type LinkRequestStatus string
+
+const (
+	LinkRequestPending  LinkRequestStatus = "pending"
+	LinkRequestApproved LinkRequestStatus = "approved"
+	LinkRequestDenied   LinkRequestStatus = "denied"
+)
+
+// LinkRequest is created when a minor is linked to a game above the approval
+// threshold of one of its guardians.
+type LinkRequest struct {
+	ID          uint              `json:"id"`
+	MinorID     uint              `json:"-" db:"minor_id"`
+	Minor       *User             `json:"minor"`
+	GameID      uint              `json:"-" db:"game_id"`
+	Game        *Game             `json:"game"`
+	Status      LinkRequestStatus `json:"status"`
+	DecidedByID *uint             `json:"-" db:"decided_by_id"`
+	CreatedAt   time.Time         `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time         `json:"updatedAt" db:"updated_at"`
+}
+
+type LinkRequestFilter struct {
+	ID         *uint
+	MinorID    *uint
+	GameID     *uint
+	GuardianID *uint
+	Status     *LinkRequestStatus
+
+	Limit  int
+	Offset int
+}
+
+type GuardianService interface {
+	CreateGuardianship(context.Context, *Guardianship) error
+	Guardianships(context.Context, GuardianshipFilter) ([]*Guardianship, error)
+	UpdateGuardianship(context.Context, *Guardianship, GuardianshipPatch) error
+	DeleteGuardianship(context.Context, uint) error
+
+	// CreateLinkRequest creates a pending link request or reopens a denied
+	// one, failing with ErrLinkRequestDecided when it is pending or approved.
+	CreateLinkRequest(context.Context, *LinkRequest) error
+	LinkRequests(context.Context, LinkRequestFilter) ([]*LinkRequest, error)
+	// DecideLinkRequest approves or denies a pending link request, failing
+	// with ErrLinkRequestDecided once decided. Approving it links the minor
+	// to the game.
+	DecideLinkRequest(ctx context.Context, lr *LinkRequest, status LinkRequestStatus, decidedByID uint) error
+}
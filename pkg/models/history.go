@@ -0,0 +1,57 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Granularity is the width of the buckets of a play time series.
+type Granularity string
+
+const (
+	GranularityDay  Granularity = "day"
+	GranularityHour Granularity = "hour"
+)
+
+// Step is the duration of a bucket, ignoring daylight saving changes.
+func (g Granularity) Step() time.Duration {
+	if g == GranularityHour {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// PlayTimePoint is the play time (in minutes) of the bucket starting at Start.
+type PlayTimePoint struct {
+	Start    time.Time `json:"start"`
+	PlayTime uint      `json:"playTime" db:"play_time"`
+}
+
+// PlayTimeSeriesFilter selects the history of a player, a game or a pair. The
+// buckets cover [From, To) in the given location, empty buckets included.
+type PlayTimeSeriesFilter struct {
+	PlayerID    *uint
+	GameID      *uint
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+	Location    *time.Location
+}
+
+type PlayTimeHistoryService interface {
+	PlayTimeSeries(context.Context, PlayTimeSeriesFilter) ([]PlayTimePoint, error)
+}
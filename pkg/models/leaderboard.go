@@ -0,0 +1,41 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultLeaderboardSize is the number of players of a leaderboard by default.
+const DefaultLeaderboardSize = 10
+
+// LeaderboardEntry is a player of a game leaderboard. Players with the same
+// play time share their rank.
+type LeaderboardEntry struct {
+	Rank     uint   `json:"rank"`
+	Username string `json:"username"`
+	PlayTime uint   `json:"playTime" db:"play_time"`
+}
+
+type LeaderboardFilter struct {
+	GameID uint
+	Since  *time.Time // only the play time since then, overall when nil
+	Limit  int
+}
+
+type LeaderboardService interface {
+	Leaderboard(context.Context, LeaderboardFilter) ([]LeaderboardEntry, error)
+}
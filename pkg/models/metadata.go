@@ -25,7 +25,7 @@ import (
 type Metadata struct {
 	ID             uint      `json:"-"`
 	PlayerID       uint      `json:"-" db:"player_id"`
-	Player         *User     `json:"player"`
+	Player         *User     `json:"-"` // PlayerUsername is exposed instead
 	PlayedGameID   uint      `json:"-" db:"played_game_id"`
 	PlayedGame     *Game     `json:"playedGame"`
 	PlayTime       uint      `json:"playTime" db:"play_time"`
@@ -50,9 +50,32 @@ type MetadataPatch struct {
 	PlayTime *uint
 }
 
+// PlayTimeIncrement adds Delta minutes to the play time of a metadata row.
+// Each applied increment is recorded as an ended play session of the given
+// source, PlaySessionImport by default, the simulator traffic of a link going
+// to a single session. The minutes count in the history as played until
+// PlayedAt, or until now when it is zero.
+type PlayTimeIncrement struct {
+	MetadataID uint
+	Delta      uint
+	Source     PlaySessionSource
+	PlayedAt   time.Time
+}
+
 type MetadataService interface {
 	CreateMetadata(context.Context, *Metadata) error
 	Metadata(context.Context, MetadataFilter) ([]*Metadata, error)
 	UpdateMetadata(context.Context, *Metadata, MetadataPatch) error
 	DeleteMetadata(context.Context, uint) error
+
+	// IncrementPlayTime atomically adds delta minutes to the play time of a
+	// metadata row, so concurrent increments are never lost.
+	IncrementPlayTime(ctx context.Context, id uint, delta uint) error
+	// IncrementPlayTimes applies many increments in a single transaction and
+	// returns the number of rows whose play time changed.
+	IncrementPlayTimes(context.Context, []PlayTimeIncrement) (int, error)
+	// SimulationTargets returns every metadata row, ordered by id, with only
+	// what the traffic simulator reads: the ids, the title of the game and
+	// the time zone of the player.
+	SimulationTargets(context.Context) ([]*Metadata, error)
 }
@@ -0,0 +1,76 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Publisher publishes games. Its accounts are the users managing its games.
+type Publisher struct {
+	ID            uint      `json:"-"`
+	Name          string    `json:"name"`
+	Key           string    `json:"-"`
+	Slug          string    `json:"slug"`
+	Website       string    `json:"website"`
+	Description   string    `json:"description"`
+	GamesCount    uint      `json:"gamesCount" db:"games_count"`
+	AccountsCount uint      `json:"accountsCount" db:"accounts_count"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// PublisherKey identifies a publisher whatever the spelling of its name: it
+// keeps the letters and digits only, lower cased, so that "Riot Games" and
+// "riotgames" are the same publisher.
+func PublisherKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+type PublisherFilter struct {
+	ID   *uint
+	Slug *string
+	Name *string // in any spelling, see PublisherKey
+
+	Limit  int
+	Offset int
+}
+
+type PublisherPatch struct {
+	Name        *string
+	Website     *string
+	Description *string
+}
+
+type PublisherService interface {
+	CreatePublisher(context.Context, *Publisher) error
+	Publishers(context.Context, PublisherFilter) ([]*Publisher, error)
+	UpdatePublisher(context.Context, *Publisher, PublisherPatch) error
+	// DeletePublisher fails with ErrPublisherHasGames while games refer to it.
+	DeletePublisher(context.Context, uint) error
+
+	PublisherAccounts(ctx context.Context, publisherID uint) ([]*User, error)
+	// SetPublisherAccount makes the user an account of the publisher, or a
+	// regular user again when publisherID is nil.
+	SetPublisherAccount(ctx context.Context, userID uint, publisherID *uint) error
+}
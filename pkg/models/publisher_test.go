@@ -0,0 +1,41 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "testing"
+
+func TestPublisherKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Riot Games", "riotgames"},
+		{"riotgames", "riotgames"},
+		{"  RIOT-games!  ", "riotgames"},
+		{"Square Enix Co., Ltd.", "squareenixcoltd"},
+		{"2K", "2k"},
+		{"Bandai Namco Éditions", "bandainamcoéditions"},
+		{"任天堂", "任天堂"},
+		{"---", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PublisherKey(tt.name); got != tt.want {
+				t.Errorf("PublisherKey(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"strings"
+)
+
+// RatingSystem is a regional age rating board.
+type RatingSystem string
+
+const (
+	PEGI RatingSystem = "PEGI" // Europe
+	ESRB RatingSystem = "ESRB" // North America
+	USK  RatingSystem = "USK"  // Germany
+	IARC RatingSystem = "IARC" // generic rating used by the app stores, fallback for every other region
+)
+
+// GameRating is the rating a game received from a rating system.
+type GameRating struct {
+	GameID uint         `json:"-" db:"game_id"`
+	System RatingSystem `json:"system"`
+	Rating string       `json:"rating"`
+}
+
+// ratingMinimumAges converts the ratings of each system to the minimum age of the player.
+var ratingMinimumAges = map[RatingSystem]map[string]uint{
+	PEGI: {"3": 3, "7": 7, "12": 12, "16": 16, "18": 18},
+	ESRB: {"E": 0, "E10+": 10, "T": 13, "M": 17, "AO": 18},
+	USK:  {"0": 0, "6": 6, "12": 12, "16": 16, "18": 18},
+	IARC: {"3+": 3, "7+": 7, "12+": 12, "16+": 16, "18+": 18},
+}
+
+// RatingAge is the minimum age of a rating of a system.
+type RatingAge struct {
+	System RatingSystem
+	Rating string
+	Age    uint
+}
+
+// RatingAges lists the minimum ages of the ratings of every system.
+func RatingAges() []RatingAge {
+	ages := []RatingAge{}
+	for system, ratings := range ratingMinimumAges {
+		for rating, age := range ratings {
+			ages = append(ages, RatingAge{System: system, Rating: rating, Age: age})
+		}
+	}
+	return ages
+}
+
+var regionRatingSystems = map[string]RatingSystem{
+	"US": ESRB, "CA": ESRB, "MX": ESRB,
+	"DE": USK,
+	"AT": PEGI, "BE": PEGI, "BG": PEGI, "CH": PEGI, "CY": PEGI, "CZ": PEGI, "DK": PEGI,
+	"EE": PEGI, "ES": PEGI, "FI": PEGI, "FR": PEGI, "GB": PEGI, "GR": PEGI, "HR": PEGI,
+	"HU": PEGI, "IE": PEGI, "IS": PEGI, "IT": PEGI, "LT": PEGI, "LU": PEGI, "LV": PEGI,
+	"MT": PEGI, "NL": PEGI, "NO": PEGI, "PL": PEGI, "PT": PEGI, "RO": PEGI, "SE": PEGI,
+	"SI": PEGI, "SK": PEGI,
+}
+
+// RatingSystemForRegion returns the rating system that applies in a region
+// (ISO 3166-1 alpha-2 country code).
+func RatingSystemForRegion(region string) RatingSystem {
+	if system, ok := regionRatingSystems[strings.ToUpper(region)]; ok {
+		return system
+	}
+	return IARC
+}
+
+// MinimumAge returns the minimum age corresponding to the rating, and false
+// when the rating is unknown to its system.
+func (r GameRating) MinimumAge() (uint, bool) {
+	age, ok := ratingMinimumAges[r.System][strings.ToUpper(r.Rating)]
+	return age, ok
+}
+
+// Valid reports whether the rating exists in its rating system.
+func (r GameRating) Valid() bool {
+	_, ok := r.MinimumAge()
+	return ok
+}
+
+// RatingFor returns the rating of the game in the rating system of a region,
+// falling back to its IARC rating. It is nil when the game has neither.
+func (g *Game) RatingFor(region string) *GameRating {
+	system := RatingSystemForRegion(region)
+	var iarc *GameRating
+	for i := range g.Ratings {
+		r := &g.Ratings[i]
+		if r.System == system {
+			return r
+		}
+		if r.System == IARC {
+			iarc = r
+		}
+	}
+	return iarc
+}
+
+// MinimumAgeFor returns the minimum age to play the game in a region. When
+// the game has no rating relevant to the region, the strictest of its
+// ratings (including the generic AgeRating) applies.
+func (g *Game) MinimumAgeFor(region string) uint {
+	if r := g.RatingFor(region); r != nil {
+		if age, ok := r.MinimumAge(); ok {
+			return age
+		}
+	}
+
+	age := g.AgeRating
+	for _, r := range g.Ratings {
+		if a, ok := r.MinimumAge(); ok && a > age {
+			age = a
+		}
+	}
+	return age
+}
+
+// Localize fills the fields of the game that depend on the region of the reader.
+func (g *Game) Localize(region string) {
+	g.RegionalRating = g.RatingFor(region)
+	g.MinimumAge = g.MinimumAgeFor(region)
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultRecommendationInterval is the period the game similarities are
+	// recomputed at.
+	DefaultRecommendationInterval = time.Hour
+	// MaxSimilarGames is the number of similar games kept per game.
+	MaxSimilarGames = 50
+)
+
+// Recommendation is a game scored for a player or for another game. Players
+// are the players the similar game has in common with the other one, Because
+// the games of the player it is recommended for, most relevant first.
+type Recommendation struct {
+	GameID  uint     `json:"-" db:"game_id"`
+	Game    *Game    `json:"game" db:"-"`
+	Score   float64  `json:"score"`
+	Players uint     `json:"players,omitempty"`
+	Because []string `json:"because,omitempty" db:"-"` // slugs
+}
+
+type RecommendationService interface {
+	// ComputeSimilarities replaces the game similarities by ones computed
+	// from the current links, returning how many were kept.
+	ComputeSimilarities(context.Context) (int, error)
+	// SimilarGames returns the games most similar to a game first.
+	SimilarGames(ctx context.Context, gameID uint) ([]*Recommendation, error)
+	// Recommendations returns the games similar to the ones of a player, that
+	// they do not have yet, best first.
+	Recommendations(ctx context.Context, playerID uint) ([]*Recommendation, error)
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// PlaySessionSource tells where a play session was reported from.
+type PlaySessionSource string
+
+// DefaultHeartbeatTimeout is how long a session stays open without heartbeats.
+const DefaultHeartbeatTimeout = 2 * time.Minute
+
+// HeartbeatRetention is how long heartbeat IDs are kept to detect retries.
+const HeartbeatRetention = 24 * time.Hour
+
+const (
+	PlaySessionSimulator PlaySessionSource = "simulator"
+	PlaySessionClient    PlaySessionSource = "client"
+	PlaySessionImport    PlaySessionSource = "import"
+	PlaySessionAPI       PlaySessionSource = "api" // play time patched through the API
+)
+
+// PlaySession is a period during which a player played a linked game. The
+// time between two heartbeats counts as played as long as it stays below the
+// heartbeat timeout, and is credited to the play time of the link when the
+// session ends.
+type PlaySession struct {
+	ID              uint              `json:"id"`
+	MetadataID      uint              `json:"-" db:"metadata_id"`
+	PlayerID        uint              `json:"-" db:"player_id"`
+	GameID          uint              `json:"-" db:"played_game_id"`
+	GameSlug        string            `json:"game" db:"game_slug"`
+	Source          PlaySessionSource `json:"source"`
+	StartedAt       time.Time         `json:"startedAt" db:"started_at"`
+	LastHeartbeatAt time.Time         `json:"lastHeartbeatAt" db:"last_heartbeat_at"`
+	EndedAt         *time.Time        `json:"endedAt,omitempty" db:"ended_at"`
+	ActiveSeconds   uint              `json:"activeSeconds" db:"active_seconds"`
+	Duration        uint              `json:"duration"` // minutes credited to the play time
+	CreatedAt       time.Time         `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time         `json:"updatedAt" db:"updated_at"`
+}
+
+// Open reports whether the session has not ended yet.
+func (s *PlaySession) Open() bool {
+	return s.EndedAt == nil
+}
+
+// Heartbeat is sent periodically by a streaming client while a game is played.
+type Heartbeat struct {
+	ID         string // generated by the client, retries reuse it
+	PlayerID   uint
+	MetadataID uint
+	ReceivedAt time.Time
+}
+
+// PlayEvent is a period of play buffered by a client and uploaded in bulk.
+type PlayEvent struct {
+	ID         string // generated by the client, uploads of the same event are ignored
+	PlayerID   uint
+	MetadataID uint
+	StartedAt  time.Time
+	EndedAt    time.Time
+}
+
+type PlaySessionFilter struct {
+	ID         *uint
+	MetadataID *uint
+	PlayerID   *uint
+	GameID     *uint
+	Source     *PlaySessionSource
+	Open       *bool
+
+	Limit  int
+	Offset int
+}
+
+type PlaySessionService interface {
+	// StartPlaySession opens a session on the metadata row of the session.
+	StartPlaySession(context.Context, *PlaySession) error
+	PlaySessions(context.Context, PlaySessionFilter) ([]*PlaySession, error)
+	// HeartbeatPlaySession tells that the session is still alive at the given
+	// time. A session whose last heartbeat is older than the timeout is ended
+	// instead, and ErrPlaySessionExpired is returned along with it.
+	HeartbeatPlaySession(ctx context.Context, id uint, at time.Time) (*PlaySession, error)
+	// EndPlaySession closes the session and credits its active time to the
+	// play time, within the play time limits of the player.
+	EndPlaySession(ctx context.Context, id uint, at time.Time) (*PlaySession, error)
+
+	// IngestHeartbeat adds a client heartbeat to the open session of the link,
+	// starting a session when there is none. Retried heartbeats are not counted
+	// again and are reported as duplicates.
+	IngestHeartbeat(context.Context, *Heartbeat) (session *PlaySession, duplicate bool, err error)
+	// IngestPlayEvents records the events as ended client sessions in a single
+	// transaction and returns the IDs of the events already ingested, which
+	// are skipped. The time an event shares with the other client sessions of
+	// its link is not counted again.
+	IngestPlayEvents(context.Context, []*PlayEvent) (duplicates []string, err error)
+	// ExpirePlaySessions ends the sessions without heartbeat for longer than the
+	// timeout and returns how many were ended.
+	ExpirePlaySessions(ctx context.Context, now time.Time) (int, error)
+}
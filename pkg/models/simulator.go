@@ -0,0 +1,62 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// SimulatorControls are the runtime controls of the game traffic simulator.
+// The leader saves them on every change so that the next leader resumes with
+// them, nil fields keep the configuration the simulator was started with.
+type SimulatorControls struct {
+	Paused     bool
+	Frequency  *time.Duration
+	Span       *time.Duration
+	Profile    *string
+	Seed       *int64
+	Popularity map[string]float64
+	ChurnRate  *float64
+	UpdatedAt  time.Time
+}
+
+// TraceReplay is the progress of the replay of a trace, identified by its
+// path and the SHA-256 of its content. Offset is the number of events, in
+// timestamp order, already applied.
+type TraceReplay struct {
+	Path        string
+	Hash        string
+	Events      int
+	Offset      int
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type SimulatorService interface {
+	// SimulatorControls returns nil when the simulator was never controlled.
+	SimulatorControls(context.Context) (*SimulatorControls, error)
+	SaveSimulatorControls(context.Context, *SimulatorControls) error
+
+	// TraceReplay returns the progress of the replay of a trace, starting
+	// it when the trace was never replayed.
+	TraceReplay(ctx context.Context, path, hash string, events int) (*TraceReplay, error)
+	// ApplyTraceReplay applies the increments of the events of a replay up
+	// to offset and moves the replay to offset in the same transaction. It
+	// fails with ErrTraceReplayConflict when the replay is no longer at
+	// tr.Offset, e.g when another leader resumed it.
+	ApplyTraceReplay(ctx context.Context, tr *TraceReplay, offset int, increments []PlayTimeIncrement) (int, error)
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultStatsWeeks is the number of weeks of new links reported by default.
+const DefaultStatsWeeks = 8
+
+// WeeklyLinks is the number of links created during the week starting on
+// Week (a Monday, UTC).
+type WeeklyLinks struct {
+	Week  time.Time `json:"week"`
+	Links uint      `json:"links"`
+}
+
+// PlayTimeStats aggregate the play time of the players of some games. The
+// average and the median are per player.
+type PlayTimeStats struct {
+	Players         uint          `json:"players"`
+	TotalPlayTime   uint          `json:"totalPlayTime" db:"total_play_time"`
+	AveragePlayTime float64       `json:"averagePlayTime" db:"average_play_time"`
+	MedianPlayTime  float64       `json:"medianPlayTime" db:"median_play_time"`
+	NewLinksPerWeek []WeeklyLinks `json:"newLinksPerWeek" db:"-"` // oldest week first
+}
+
+type GameStats struct {
+	ID        uint   `json:"-"`
+	Slug      string `json:"slug"`
+	Title     string `json:"title"`
+	Publisher string `json:"publisher"`
+	PlayTimeStats
+}
+
+type PublisherStats struct {
+	Publisher string `json:"publisher"`
+	Games     uint   `json:"games"`
+	PlayTimeStats
+}
+
+type StatsFilter struct {
+	Publisher *string
+	AgeRating *uint
+	Weeks     int // of new links, up to the current week
+}
+
+// PlayerGameStats is the play time of a player on one of their games. Share
+// is the percentage of their total play time spent on it.
+type PlayerGameStats struct {
+	Slug          string     `json:"slug"`
+	Title         string     `json:"title"`
+	Publisher     string     `json:"publisher"`
+	PlayTime      uint       `json:"playTime" db:"play_time"`
+	PlayTimeHuman string     `json:"playTimeHuman" db:"-"`
+	Share         float64    `json:"share" db:"-"`
+	LastPlayedAt  *time.Time `json:"lastPlayedAt" db:"last_played_at"`
+}
+
+// PlayerPublisherStats is the play time of a player on the games of a
+// publisher.
+type PlayerPublisherStats struct {
+	Publisher     string  `json:"publisher"`
+	Games         uint    `json:"games"`
+	PlayTime      uint    `json:"playTime"`
+	PlayTimeHuman string  `json:"playTimeHuman"`
+	Share         float64 `json:"share"`
+}
+
+// PlayerActivity is the last time a player played, and on which game.
+type PlayerActivity struct {
+	Game  string    `json:"game"` // slug
+	Title string    `json:"title"`
+	At    time.Time `json:"at"`
+}
+
+// PlayerStats sum up the play time of a player. Games are sorted by play
+// time, publishers too.
+type PlayerStats struct {
+	TotalPlayTime      uint                    `json:"totalPlayTime"`
+	TotalPlayTimeHuman string                  `json:"totalPlayTimeHuman"`
+	GamesCount         uint                    `json:"gamesCount"`
+	FavouriteGame      *PlayerGameStats        `json:"favouriteGame"`
+	LastActivity       *PlayerActivity         `json:"lastActivity"`
+	Games              []*PlayerGameStats      `json:"games"`
+	Publishers         []*PlayerPublisherStats `json:"publishers"`
+}
+
+type StatsService interface {
+	GameStats(context.Context, StatsFilter) ([]*GameStats, error)
+	PublisherStats(context.Context, StatsFilter) ([]*PublisherStats, error)
+	PlayerStats(ctx context.Context, playerID uint) (*PlayerStats, error)
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Tag is a free-form, lower case label of games.
+type Tag struct {
+	ID         uint      `json:"-"`
+	Name       string    `json:"name"`
+	GamesCount uint      `json:"gamesCount" db:"games_count"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type TagFilter struct {
+	ID     *uint
+	Name   *string
+	Search *string // prefix of the name
+
+	Limit  int
+	Offset int
+}
+
+type TagPatch struct {
+	Name *string
+}
+
+type TagService interface {
+	CreateTag(context.Context, *Tag) error
+	Tags(context.Context, TagFilter) ([]*Tag, error)
+	UpdateTag(context.Context, *Tag, TagPatch) error
+	DeleteTag(context.Context, uint) error
+}
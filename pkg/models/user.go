@@ -16,6 +16,7 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -24,8 +25,13 @@ import (
 type User struct {
 	ID           uint      `json:"-"`
 	Email        string    `json:"email,omitempty"`
-	Age          uint      `json:"age,omitempty"`
+	Birthdate    time.Time `json:"birthdate"`
+	Timezone     string    `json:"timezone,omitempty"`
+	Region       string    `json:"region,omitempty"`     // ISO 3166-1 alpha-2 country code
+	Age          uint      `json:"age,omitempty" db:"-"` // derived from Birthdate, never stored
 	Username     string    `json:"username,omitempty"`
+	IsAdmin      bool      `json:"isAdmin,omitempty" db:"is_admin"` // only granted from the database
+	PublisherID  *uint     `json:"-" db:"publisher_id"`             // set for the accounts of a publisher
 	Token        string    `json:"token,omitempty"`
 	PasswordHash string    `json:"-" db:"password_hash"`
 	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
@@ -34,6 +40,20 @@ type User struct {
 
 var AnonymousUser User
 
+// MarshalJSON writes the birthdate in BirthdateLayout, the way clients send
+// it, and leaves it out when it is not set.
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User // without the methods of User
+	out := struct {
+		user
+		Birthdate string `json:"birthdate,omitempty"`
+	}{user: user(u)}
+	if !u.Birthdate.IsZero() {
+		out.Birthdate = u.Birthdate.Format(BirthdateLayout)
+	}
+	return json.Marshal(out)
+}
+
 type UserFilter struct {
 	ID       *uint
 	Email    *string
@@ -45,10 +65,73 @@ type UserFilter struct {
 }
 
 type UserPatch struct {
-	Email        *string `json:"email"`
-	Username     *string `json:"username"`
-	Age          *uint   `json:"age"`
-	PasswordHash *string `json:"-" db:"password_hash"`
+	Email        *string    `json:"email"`
+	Username     *string    `json:"username"`
+	Birthdate    *time.Time `json:"birthdate"`
+	Timezone     *string    `json:"timezone"`
+	Region       *string    `json:"region"`
+	PasswordHash *string    `json:"-" db:"password_hash"`
+}
+
+// DefaultTimezone is used when a user did not provide one.
+const DefaultTimezone = "UTC"
+
+// BirthdateLayout is the format used to exchange birthdates with clients.
+const BirthdateLayout = "2006-01-02"
+
+// Location returns the time zone the user lives in, falling back to UTC
+// when it is unknown.
+func (u *User) Location() *time.Location {
+	return Location(u.Timezone)
+}
+
+// Location returns the time zone of the given name, falling back to UTC when
+// it is unknown.
+func Location(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// AgeAt returns the age of the user at the instant t, evaluated in the
+// user's own time zone so that birthdays start at the user's local midnight.
+func (u *User) AgeAt(t time.Time) uint {
+	return AgeOn(u.Birthdate, t.In(u.Location()))
+}
+
+// RefreshAge recomputes the derived Age field from the birthdate.
+func (u *User) RefreshAge() {
+	u.Age = u.AgeAt(time.Now())
+}
+
+// AgeOn returns the number of full years between birthdate and the calendar
+// day of now.
+func AgeOn(birthdate, now time.Time) uint {
+	if birthdate.IsZero() {
+		return 0
+	}
+	by, bm, bd := birthdate.Date()
+	ny, nm, nd := now.Date()
+	age := ny - by
+	if nm < bm || (nm == bm && nd < bd) {
+		age--
+	}
+	if age < 0 {
+		return 0
+	}
+	return uint(age)
+}
+
+// BirthdateFromAge converts an age into the latest birthdate compatible with
+// it, i.e. the user is considered to turn `age` on the calendar day of now.
+func BirthdateFromAge(age uint, now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y-int(age), m, d, 0, 0, 0, 0, time.UTC)
 }
 
 func (u *User) SetPassword(password string) error {
@@ -0,0 +1,254 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.ApplicationService = (*ApplicationService)(nil)
+
+type ApplicationService struct {
+	db *DB
+}
+
+func NewApplicationService(db *DB) *ApplicationService {
+	return &ApplicationService{db}
+}
+
+func (as *ApplicationService) CreateApplication(ctx context.Context, app *models.Application) error {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO applications (game_id, package_name)
+	VALUES ($1, $2) RETURNING id, created_at, updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, app.GameID, app.PackageName).Scan(&app.ID, &app.CreatedAt, &app.UpdatedAt); err != nil {
+		return applicationError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (as *ApplicationService) GameApplication(ctx context.Context, gameID uint) (*models.Application, error) {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	app, err := findGameApplication(ctx, tx, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app, tx.Commit()
+}
+
+func (as *ApplicationService) ApplicationVersions(ctx context.Context, app *models.Application) ([]*models.ApplicationVersion, error) {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	query := "SELECT * FROM application_versions WHERE application_id = $1 ORDER BY version_code DESC"
+	versions, err := queryApplicationVersions(ctx, tx, query, app.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		v.Active = app.IsActive(v)
+	}
+
+	return versions, tx.Commit()
+}
+
+func (as *ApplicationService) CreateApplicationVersion(ctx context.Context, app *models.Application, version *models.ApplicationVersion) error {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO application_versions (application_id, version_code, version_name, min_sdk, target_sdk, abis, permissions, apk_key, apk_size, apk_sha256)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, uploaded_at`
+
+	args := []interface{}{
+		app.ID,
+		version.VersionCode,
+		version.VersionName,
+		version.MinSDK,
+		version.TargetSDK,
+		pq.Array(version.ABIs),
+		pq.Array(version.Permissions),
+		version.APKKey,
+		version.APKSize,
+		version.APKSHA256,
+	}
+
+	version.ApplicationID = app.ID
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&version.ID, &version.UploadedAt); err != nil {
+		return applicationError(err)
+	}
+
+	if app.ActiveVersionID == nil {
+		if err := activateApplicationVersion(ctx, tx, app, version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (as *ApplicationService) ApplicationVersion(ctx context.Context, app *models.Application, versionCode uint) (*models.ApplicationVersion, error) {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	version, err := findApplicationVersion(ctx, tx, app, versionCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, tx.Commit()
+}
+
+func (as *ApplicationService) PromoteApplicationVersion(ctx context.Context, app *models.Application, versionCode uint) error {
+	tx, err := as.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	version, err := findApplicationVersion(ctx, tx, app, versionCode)
+	if err != nil {
+		return err
+	}
+
+	if err := activateApplicationVersion(ctx, tx, app, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func findGameApplication(ctx context.Context, tx *sqlx.Tx, gameID uint) (*models.Application, error) {
+	app := models.Application{}
+	if err := tx.GetContext(ctx, &app, "SELECT * FROM applications WHERE game_id = $1", gameID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNotFound
+		}
+		return nil, err
+	}
+
+	if app.ActiveVersionID != nil {
+		versions, err := queryApplicationVersions(ctx, tx, "SELECT * FROM application_versions WHERE id = $1", *app.ActiveVersionID)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			app.ActiveVersion = versions[0]
+			app.ActiveVersion.Active = true
+		}
+	}
+
+	return &app, nil
+}
+
+func findApplicationVersion(ctx context.Context, tx *sqlx.Tx, app *models.Application, versionCode uint) (*models.ApplicationVersion, error) {
+	query := "SELECT * FROM application_versions WHERE application_id = $1 AND version_code = $2"
+	versions, err := queryApplicationVersions(ctx, tx, query, app.ID, versionCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	version := versions[0]
+	version.Active = app.IsActive(version)
+	return version, nil
+}
+
+// queryApplicationVersions loads versions, scanning their ABIs and
+// permissions from text arrays.
+func queryApplicationVersions(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) ([]*models.ApplicationVersion, error) {
+	rows := []struct {
+		models.ApplicationVersion
+		ABIs        pq.StringArray `db:"abis"`
+		Permissions pq.StringArray `db:"permissions"`
+	}{}
+	if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	versions := make([]*models.ApplicationVersion, 0, len(rows))
+	for i := range rows {
+		v := rows[i].ApplicationVersion
+		v.ABIs, v.Permissions = []string(rows[i].ABIs), []string(rows[i].Permissions)
+		versions = append(versions, &v)
+	}
+
+	return versions, nil
+}
+
+func activateApplicationVersion(ctx context.Context, tx *sqlx.Tx, app *models.Application, version *models.ApplicationVersion) error {
+	query := "UPDATE applications SET active_version_id = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at"
+	if err := tx.QueryRowxContext(ctx, query, version.ID, app.ID).Scan(&app.UpdatedAt); err != nil {
+		return err
+	}
+
+	app.Activate(version)
+	return nil
+}
+
+func applicationError(err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "applications_game_id_key"`:
+		return models.ErrDuplicateApplication
+	case `pq: duplicate key value violates unique constraint "applications_package_name_key"`:
+		return models.ErrDuplicatePackageName
+	case `pq: duplicate key value violates unique constraint "application_versions_version_code_key"`:
+		return models.ErrDuplicateVersion
+	}
+	return err
+}
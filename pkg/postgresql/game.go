@@ -17,10 +17,15 @@ package postgresql
 import (
 	"anbox_mgmt/pkg/models"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/gosimple/slug"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 var _ models.GameService = (*GameService)(nil)
@@ -85,6 +90,22 @@ func (gs *GameService) UpdateGame(ctx context.Context, game *models.Game, patch
 	return tx.Commit()
 }
 
+func (gs *GameService) SetGameStatus(ctx context.Context, game *models.Game, status models.GameStatus) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := setGameStatus(ctx, tx, game, status); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (gs *GameService) DeleteGame(ctx context.Context, id uint) error {
 	tx, err := gs.db.BeginTxx(ctx, nil)
 
@@ -105,25 +126,45 @@ func (gs *GameService) DeleteGame(ctx context.Context, id uint) error {
 
 func createGame(ctx context.Context, tx *sqlx.Tx, game *models.Game) error {
 	query := `
-	INSERT INTO games (title, description, url, age_rating, publisher) 
-	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at
+	INSERT INTO games (title, slug, description, url, age_rating, publisher_id, status) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at
 	`
 
+	game.Slug = slug.Make(game.Title)
+	game.Status = models.GameDraft
+
+	if err := resolveGamePublisher(ctx, tx, game); err != nil {
+		return err
+	}
+
 	args := []interface{}{
 		game.Title,
+		game.Slug,
 		game.Description,
 		game.URL,
 		game.AgeRating,
-		game.Publisher,
+		game.PublisherID,
+		game.Status,
 	}
 
 	err := tx.QueryRowxContext(ctx, query, args...).Scan(&game.ID, &game.CreatedAt, &game.UpdatedAt)
 
 	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "games_slug_key"` {
+			return models.ErrDuplicateSlug
+		}
 		return err
 	}
 
-	if err != nil {
+	if err := replaceGameRatings(ctx, tx, game); err != nil {
+		return err
+	}
+
+	if err := replaceGameGenres(ctx, tx, game); err != nil {
+		return err
+	}
+
+	if err := replaceGameTags(ctx, tx, game); err != nil {
 		return err
 	}
 
@@ -144,6 +185,16 @@ func findGames(ctx context.Context, tx *sqlx.Tx, filter models.GameFilter) ([]*m
 		where, args = append(where, fmt.Sprintf("title = $%d", argPosition)), append(args, *v)
 	}
 
+	if v := filter.Slug; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("slug = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Search; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("(title ILIKE $%d OR description ILIKE $%d)", argPosition, argPosition)), append(args, "%"+*v+"%")
+	}
+
 	if v := filter.Description; v != nil {
 		argPosition++
 		where, args = append(where, fmt.Sprintf("description = $%d", argPosition)), append(args, *v)
@@ -161,10 +212,61 @@ func findGames(ctx context.Context, tx *sqlx.Tx, filter models.GameFilter) ([]*m
 
 	if v := filter.Publisher; v != nil {
 		argPosition++
-		where, args = append(where, fmt.Sprintf("publisher = $%d", argPosition)), append(args, *v)
+		where, args = append(where, fmt.Sprintf("publisher_id IN (SELECT id FROM publishers WHERE key = $%d)", argPosition)), append(args, models.PublisherKey(*v))
+	}
+
+	if v := filter.Genres; len(v) > 0 {
+		argPosition++
+		where, args = append(where, fmt.Sprintf(`id IN (
+			SELECT gg.game_id FROM game_genres gg JOIN genres ge ON ge.id = gg.genre_id WHERE ge.slug = ANY($%d))`, argPosition)), append(args, pq.Array(v))
+	}
+
+	if v := filter.Tags; len(v) > 0 {
+		argPosition++
+		clause := fmt.Sprintf(`id IN (
+			SELECT gt.game_id FROM game_tags gt JOIN tags t ON t.id = gt.tag_id WHERE t.name = ANY($%d)`, argPosition)
+		if filter.AllTags {
+			// every distinct tag of the filter must be on the game
+			clause += fmt.Sprintf(" GROUP BY gt.game_id HAVING COUNT(*) = (SELECT COUNT(DISTINCT x) FROM unnest($%d::text[]) x)", argPosition)
+		}
+		where, args = append(where, clause+")"), append(args, pq.Array(v))
+	}
+
+	if v := filter.Statuses; len(v) > 0 {
+		statuses := make([]string, 0, len(v))
+		for _, status := range v {
+			statuses = append(statuses, string(status))
+		}
+		argPosition++
+		where, args = append(where, fmt.Sprintf("status = ANY($%d)", argPosition)), append(args, pq.Array(statuses))
+	}
+
+	if v := filter.EligibleFor; v != nil {
+		systems, ratings, ages := []string{}, []string{}, []int64{}
+		for _, a := range models.RatingAges() {
+			systems, ratings, ages = append(systems, string(a.System)), append(ratings, a.Rating), append(ages, int64(a.Age))
+		}
+
+		// the minimum age of Game.MinimumAgeFor: the one of the rating of the
+		// region, else of the IARC rating, else the strictest of them all
+		ratingAges := fmt.Sprintf(`game_ratings r
+			JOIN unnest($%d::text[], $%d::text[], $%d::int[]) AS a(system, rating, age)
+			ON a.system = r.system AND a.rating = UPPER(r.rating)
+			WHERE r.game_id = games.id`, argPosition+1, argPosition+2, argPosition+3)
+		clause := fmt.Sprintf(`COALESCE(
+			(SELECT a.age FROM %[1]s AND r.system = $%[2]d),
+			CASE WHEN NOT EXISTS (SELECT 1 FROM game_ratings WHERE game_id = games.id AND system = $%[2]d)
+				THEN (SELECT a.age FROM %[1]s AND r.system = '%[3]s') END,
+			GREATEST(age_rating, (SELECT MAX(a.age) FROM %[1]s))
+		) <= $%[4]d`, ratingAges, argPosition+4, models.IARC, argPosition+5)
+
+		argPosition += 5
+		where = append(where, clause)
+		args = append(args, pq.Array(systems), pq.Array(ratings), pq.Array(ages), string(models.RatingSystemForRegion(v.Region)), v.Age)
 	}
 
-	query := "SELECT * from games" + formatWhereClause(where) + " ORDER BY created_at DESC"
+	query := "SELECT * from games" + formatWhereClause(where) +
+		" ORDER BY created_at DESC" + formatLimitOffset(filter.Limit, filter.Offset)
 	games, err := queryGames(ctx, tx, query, args...)
 
 	if err != nil {
@@ -200,12 +302,29 @@ func queryGames(ctx context.Context, tx *sqlx.Tx, query string, args ...interfac
 		return games, err
 	}
 
+	if err := attachGameRatings(ctx, tx, games); err != nil {
+		return nil, err
+	}
+
+	if err := attachGamePublishers(ctx, tx, games); err != nil {
+		return nil, err
+	}
+
+	if err := attachGameGenres(ctx, tx, games); err != nil {
+		return nil, err
+	}
+
+	if err := attachGameTags(ctx, tx, games); err != nil {
+		return nil, err
+	}
+
 	return games, nil
 }
 
 func updateGame(ctx context.Context, tx *sqlx.Tx, game *models.Game, patch models.GamePatch) error {
 	if v := patch.Title; v != nil {
 		game.Title = *v
+		game.Slug = slug.Make(*v)
 	}
 
 	if v := patch.Description; v != nil {
@@ -222,26 +341,150 @@ func updateGame(ctx context.Context, tx *sqlx.Tx, game *models.Game, patch model
 
 	if v := patch.Publisher; v != nil {
 		game.Publisher = *v
+		if err := resolveGamePublisher(ctx, tx, game); err != nil {
+			return err
+		}
+	}
+
+	if v := patch.Ratings; v != nil {
+		game.Ratings = *v
+		if err := replaceGameRatings(ctx, tx, game); err != nil {
+			log.Printf("error updating ratings: %v", err)
+			return models.ErrInternal
+		}
+	}
+
+	if v := patch.Genres; v != nil {
+		game.Genres = *v
+		if err := replaceGameGenres(ctx, tx, game); err != nil {
+			if errors.Is(err, models.ErrUnknownGenre) {
+				return err
+			}
+			log.Printf("error updating genres: %v", err)
+			return models.ErrInternal
+		}
+	}
+
+	if v := patch.Tags; v != nil {
+		game.Tags = *v
+		if err := replaceGameTags(ctx, tx, game); err != nil {
+			log.Printf("error updating tags: %v", err)
+			return models.ErrInternal
+		}
 	}
 
 	args := []interface{}{
 		game.Title,
+		game.Slug,
 		game.Description,
 		game.URL,
 		game.AgeRating,
-		game.Publisher,
+		game.PublisherID,
 		game.ID,
 	}
 
 	query := `
 	UPDATE games 
-	SET title = $1, description = $2, url = $3, age_rating = $4, publisher = $5, updated_at = NOW() WHERE id = $6
+	SET title = $1, slug = $2, description = $3, url = $4, age_rating = $5, publisher_id = $6, updated_at = NOW() WHERE id = $7
 	RETURNING updated_at`
 
 	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&game.UpdatedAt); err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "games_slug_key"` {
+			return models.ErrDuplicateSlug
+		}
 		log.Printf("error updating record: %v", err)
 		return models.ErrInternal
 	}
 
 	return nil
 }
+
+// gameStatusColumns are the columns recording when a game entered a status.
+var gameStatusColumns = map[models.GameStatus]string{
+	models.GamePublished:  "published_at",
+	models.GameDeprecated: "deprecated_at",
+	models.GameRetired:    "retired_at",
+}
+
+// setGameStatus moves the game to the status if the transition is allowed
+// and nobody moved it meanwhile.
+func setGameStatus(ctx context.Context, tx *sqlx.Tx, game *models.Game, status models.GameStatus) error {
+	column, ok := gameStatusColumns[status]
+	if !ok || !game.Status.CanBecome(status) {
+		return models.ErrInvalidGameTransition
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE games
+	SET status = $1, %s = NOW(), updated_at = NOW() WHERE id = $2 AND status = $3
+	RETURNING %s, updated_at`, column, column)
+
+	var at time.Time
+	if err := tx.QueryRowxContext(ctx, query, status, game.ID, game.Status).Scan(&at, &game.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrInvalidGameTransition
+		}
+		return err
+	}
+
+	game.Status = status
+	switch status {
+	case models.GamePublished:
+		game.PublishedAt = &at
+	case models.GameDeprecated:
+		game.DeprecatedAt = &at
+	case models.GameRetired:
+		game.RetiredAt = &at
+	}
+
+	return nil
+}
+
+// attachGameRatings loads the regional ratings of all the games in one query.
+func attachGameRatings(ctx context.Context, tx *sqlx.Tx, games []*models.Game) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(games))
+	byID := make(map[uint]*models.Game, len(games))
+	for _, g := range games {
+		ids = append(ids, int64(g.ID))
+		byID[g.ID] = g
+		g.Ratings = []models.GameRating{}
+	}
+
+	ratings := make([]*models.GameRating, 0)
+	query := "SELECT * FROM game_ratings WHERE game_id = ANY($1) ORDER BY system ASC"
+	if err := findMany(ctx, tx, &ratings, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, r := range ratings {
+		g := byID[r.GameID]
+		g.Ratings = append(g.Ratings, *r)
+	}
+
+	return nil
+}
+
+func replaceGameRatings(ctx context.Context, tx *sqlx.Tx, game *models.Game) error {
+	if err := execQuery(ctx, tx, "DELETE FROM game_ratings WHERE game_id = $1", game.ID); err != nil {
+		return err
+	}
+
+	for i := range game.Ratings {
+		r := &game.Ratings[i]
+		r.GameID = game.ID
+		query := "INSERT INTO game_ratings (game_id, system, rating) VALUES ($1, $2, $3)"
+		if err := execQuery(ctx, tx, query, r.GameID, r.System, r.Rating); err != nil {
+			return err
+		}
+	}
+
+	if game.Ratings == nil {
+		game.Ratings = []models.GameRating{}
+	}
+
+	return nil
+}
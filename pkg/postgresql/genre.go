@@ -0,0 +1,237 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"fmt"
+
+	"github.com/gosimple/slug"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.GenreService = (*GenreService)(nil)
+
+type GenreService struct {
+	db *DB
+}
+
+func NewGenreService(db *DB) *GenreService {
+	return &GenreService{db}
+}
+
+func (gs *GenreService) CreateGenre(ctx context.Context, genre *models.Genre) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := createGenre(ctx, tx, genre); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (gs *GenreService) Genres(ctx context.Context, filter models.GenreFilter) ([]*models.Genre, error) {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	genres, err := findGenres(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return genres, tx.Commit()
+}
+
+func (gs *GenreService) UpdateGenre(ctx context.Context, genre *models.Genre, patch models.GenrePatch) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := updateGenre(ctx, tx, genre, patch); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (gs *GenreService) DeleteGenre(ctx context.Context, id uint) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := execQuery(ctx, tx, "DELETE FROM genres WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func createGenre(ctx context.Context, tx *sqlx.Tx, genre *models.Genre) error {
+	query := `
+	INSERT INTO genres (name, slug)
+	VALUES ($1, $2) RETURNING id, created_at, updated_at`
+
+	genre.Slug = slug.Make(genre.Name)
+
+	err := tx.QueryRowxContext(ctx, query, genre.Name, genre.Slug).Scan(&genre.ID, &genre.CreatedAt, &genre.UpdatedAt)
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"` {
+			return models.ErrDuplicateGenre
+		}
+		return err
+	}
+
+	return nil
+}
+
+func findGenres(ctx context.Context, tx *sqlx.Tx, filter models.GenreFilter) ([]*models.Genre, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Slug; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("slug = $%d", argPosition)), append(args, *v)
+	}
+
+	query := `
+	SELECT *, (SELECT COUNT(*) FROM game_genres gg WHERE gg.genre_id = genres.id) AS games_count
+	FROM genres` + formatWhereClause(where) +
+		" ORDER BY name" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	genres := []*models.Genre{}
+	if err := findMany(ctx, tx, &genres, query, args...); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func updateGenre(ctx context.Context, tx *sqlx.Tx, genre *models.Genre, patch models.GenrePatch) error {
+	if v := patch.Name; v != nil {
+		genre.Name = *v
+		genre.Slug = slug.Make(*v)
+	}
+
+	query := `
+	UPDATE genres
+	SET name = $1, slug = $2, updated_at = NOW() WHERE id = $3
+	RETURNING updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, genre.Name, genre.Slug, genre.ID).Scan(&genre.UpdatedAt); err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"` {
+			return models.ErrDuplicateGenre
+		}
+		return err
+	}
+
+	return nil
+}
+
+// attachGameGenres loads the genres of all the games in one query.
+func attachGameGenres(ctx context.Context, tx *sqlx.Tx, games []*models.Game) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(games))
+	byID := make(map[uint]*models.Game, len(games))
+	for _, g := range games {
+		ids = append(ids, int64(g.ID))
+		byID[g.ID] = g
+		g.Genres = []string{}
+	}
+
+	rows := []struct {
+		GameID uint   `db:"game_id"`
+		Slug   string `db:"slug"`
+	}{}
+	query := `
+	SELECT gg.game_id, ge.slug
+	FROM game_genres gg
+	JOIN genres ge ON ge.id = gg.genre_id
+	WHERE gg.game_id = ANY($1)
+	ORDER BY ge.slug`
+	if err := tx.SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		g := byID[r.GameID]
+		g.Genres = append(g.Genres, r.Slug)
+	}
+
+	return nil
+}
+
+// replaceGameGenres puts the game in its genres only, all of them having to
+// exist.
+func replaceGameGenres(ctx context.Context, tx *sqlx.Tx, game *models.Game) error {
+	if game.Genres == nil {
+		game.Genres = []string{}
+	}
+
+	if err := execQuery(ctx, tx, "DELETE FROM game_genres WHERE game_id = $1", game.ID); err != nil {
+		return err
+	}
+
+	if len(game.Genres) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO game_genres (game_id, genre_id)
+	SELECT $1, id FROM genres WHERE slug = ANY($2)`
+
+	res, err := tx.ExecContext(ctx, query, game.ID, pq.Array(game.Genres))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(n) != len(game.Genres) {
+		return models.ErrUnknownGenre
+	}
+
+	return nil
+}
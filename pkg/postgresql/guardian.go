@@ -0,0 +1,491 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.GuardianService = (*GuardianService)(nil)
+
+type GuardianService struct {
+	db *DB
+}
+
+func NewGuardianService(db *DB) *GuardianService {
+	return &GuardianService{db}
+}
+
+func (gs *GuardianService) CreateGuardianship(ctx context.Context, g *models.Guardianship) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := createGuardianship(ctx, tx, g); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (gs *GuardianService) Guardianships(ctx context.Context, filter models.GuardianshipFilter) ([]*models.Guardianship, error) {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	guardianships, err := findGuardianships(ctx, tx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return guardianships, tx.Commit()
+}
+
+func (gs *GuardianService) UpdateGuardianship(ctx context.Context, g *models.Guardianship, patch models.GuardianshipPatch) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		log.Println(err)
+		return models.ErrInternal
+	}
+
+	defer tx.Rollback()
+
+	if err := updateGuardianship(ctx, tx, g, patch); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return models.ErrInternal
+	}
+
+	return nil
+}
+
+func (gs *GuardianService) DeleteGuardianship(ctx context.Context, id uint) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := execQuery(ctx, tx, "DELETE FROM guardianships WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (gs *GuardianService) CreateLinkRequest(ctx context.Context, lr *models.LinkRequest) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := createLinkRequest(ctx, tx, lr); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (gs *GuardianService) LinkRequests(ctx context.Context, filter models.LinkRequestFilter) ([]*models.LinkRequest, error) {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	lrs, err := findLinkRequests(ctx, tx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lrs, tx.Commit()
+}
+
+func (gs *GuardianService) DecideLinkRequest(ctx context.Context, lr *models.LinkRequest, status models.LinkRequestStatus, decidedByID uint) error {
+	tx, err := gs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		log.Println(err)
+		return models.ErrInternal
+	}
+
+	defer tx.Rollback()
+
+	// only a pending request is decided, a concurrent decision finds it
+	// decided once the row lock is released
+	query := `
+	UPDATE link_requests
+	SET status = $1, decided_by_id = $2, updated_at = NOW() WHERE id = $3 AND status = $4
+	RETURNING updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, status, decidedByID, lr.ID, models.LinkRequestPending).Scan(&lr.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrLinkRequestDecided
+		}
+		log.Printf("error updating record: %v", err)
+		return models.ErrInternal
+	}
+
+	if status == models.LinkRequestApproved {
+		query := `
+		INSERT INTO metadata (player_id, played_game_id, play_time)
+		VALUES ($1, $2, 0)
+		ON CONFLICT (player_id, played_game_id) DO NOTHING`
+
+		if err := execQuery(ctx, tx, query, lr.MinorID, lr.GameID); err != nil {
+			log.Printf("error creating link: %v", err)
+			return models.ErrInternal
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return models.ErrInternal
+	}
+
+	lr.Status, lr.DecidedByID = status, &decidedByID
+	return nil
+}
+
+func createGuardianship(ctx context.Context, tx *sqlx.Tx, g *models.Guardianship) error {
+	query := `
+	INSERT INTO guardianships (guardian_id, minor_id, approval_age_threshold, daily_play_time_limit, weekly_play_time_limit)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at
+	`
+
+	args := []interface{}{
+		g.GuardianID,
+		g.MinorID,
+		g.ApprovalAgeThreshold,
+		g.DailyPlayTimeLimit,
+		g.WeeklyPlayTimeLimit,
+	}
+
+	err := tx.QueryRowxContext(ctx, query, args...).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "guardianships_guardian_minor_key"` {
+			return models.ErrDuplicateGuardianship
+		}
+		return err
+	}
+
+	return nil
+}
+
+func findGuardianships(ctx context.Context, tx *sqlx.Tx, filter models.GuardianshipFilter) ([]*models.Guardianship, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.GuardianID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("guardian_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.MinorID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("minor_id = $%d", argPosition)), append(args, *v)
+	}
+
+	query := "SELECT * from guardianships" + formatWhereClause(where) +
+		" ORDER BY id ASC" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	guardianships := make([]*models.Guardianship, 0)
+	if err := findMany(ctx, tx, &guardianships, query, args...); err != nil {
+		return nil, err
+	}
+
+	for _, g := range guardianships {
+		guardian, err := findUserByID(ctx, tx, g.GuardianID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find guardian: %w", err)
+		}
+
+		minor, err := findUserByID(ctx, tx, g.MinorID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find minor: %w", err)
+		}
+
+		g.Guardian = guardian
+		g.Minor = minor
+	}
+
+	return guardianships, nil
+}
+
+func updateGuardianship(ctx context.Context, tx *sqlx.Tx, g *models.Guardianship, patch models.GuardianshipPatch) error {
+	if v := patch.ApprovalAgeThreshold; v != nil {
+		g.ApprovalAgeThreshold = *v
+	}
+
+	if v := patch.DailyPlayTimeLimit; v != nil {
+		g.DailyPlayTimeLimit = v
+	}
+
+	if patch.UnsetDailyPlayTimeLimit {
+		g.DailyPlayTimeLimit = nil
+	}
+
+	if v := patch.WeeklyPlayTimeLimit; v != nil {
+		g.WeeklyPlayTimeLimit = v
+	}
+
+	if patch.UnsetWeeklyPlayTimeLimit {
+		g.WeeklyPlayTimeLimit = nil
+	}
+
+	args := []interface{}{
+		g.ApprovalAgeThreshold,
+		g.DailyPlayTimeLimit,
+		g.WeeklyPlayTimeLimit,
+		g.ID,
+	}
+
+	query := `
+	UPDATE guardianships
+	SET approval_age_threshold = $1, daily_play_time_limit = $2, weekly_play_time_limit = $3, updated_at = NOW()
+	WHERE id = $4
+	RETURNING updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&g.UpdatedAt); err != nil {
+		log.Printf("error updating record: %v", err)
+		return models.ErrInternal
+	}
+
+	return nil
+}
+
+func createLinkRequest(ctx context.Context, tx *sqlx.Tx, lr *models.LinkRequest) error {
+	if lr.Status == "" {
+		lr.Status = models.LinkRequestPending
+	}
+
+	// a denied request is reopened when the minor requests the game again
+	query := `
+	INSERT INTO link_requests (minor_id, game_id, status)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (minor_id, game_id) DO UPDATE
+	SET status = EXCLUDED.status, decided_by_id = NULL, updated_at = NOW()
+	WHERE link_requests.status = $4
+	RETURNING id, created_at, updated_at
+	`
+
+	err := tx.QueryRowxContext(ctx, query, lr.MinorID, lr.GameID, lr.Status, models.LinkRequestDenied).Scan(&lr.ID, &lr.CreatedAt, &lr.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrLinkRequestDecided
+	}
+
+	return err
+}
+
+func findLinkRequests(ctx context.Context, tx *sqlx.Tx, filter models.LinkRequestFilter) ([]*models.LinkRequest, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.MinorID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("minor_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.GameID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("game_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.GuardianID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("minor_id IN (SELECT minor_id FROM guardianships WHERE guardian_id = $%d)", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Status; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("status = $%d", argPosition)), append(args, *v)
+	}
+
+	query := "SELECT * from link_requests" + formatWhereClause(where) +
+		" ORDER BY created_at DESC" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	lrs := make([]*models.LinkRequest, 0)
+	if err := findMany(ctx, tx, &lrs, query, args...); err != nil {
+		return nil, err
+	}
+
+	for _, lr := range lrs {
+		minor, err := findUserByID(ctx, tx, lr.MinorID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find link request minor: %w", err)
+		}
+
+		game, err := findGameByID(ctx, tx, lr.GameID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find link request game: %w", err)
+		}
+
+		lr.Minor = minor
+		lr.Game = game
+	}
+
+	return lrs, nil
+}
+
+// playerDay is a day of a player, in the time zone of the player.
+type playerDay struct {
+	PlayerID uint
+	Day      string // 2006-01-02
+}
+
+// allowances are the minutes the play time limits of minors leave them on
+// some days. Only the limited days are set, and the limited weeks keyed by
+// their Monday.
+type allowances struct {
+	daily  map[playerDay]uint
+	weekly map[playerDay]uint
+}
+
+// playTimeAllowances returns how many minutes the minors among the players of
+// days may still play on each of these days and in their weeks. Players
+// without limits have no allowance.
+func playTimeAllowances(ctx context.Context, tx *sqlx.Tx, days []playerDay) (*allowances, error) {
+	a := &allowances{daily: map[playerDay]uint{}, weekly: map[playerDay]uint{}}
+	if len(days) == 0 {
+		return a, nil
+	}
+
+	playerIDs, dates := make([]int64, 0, len(days)), make([]string, 0, len(days))
+	for _, d := range days {
+		playerIDs, dates = append(playerIDs, int64(d.PlayerID)), append(dates, d.Day)
+	}
+
+	query := `
+	SELECT
+		g.minor_id,
+		to_char(d.day, 'YYYY-MM-DD'),
+		to_char(date_trunc('week', d.day), 'YYYY-MM-DD'),
+		MIN(g.daily_play_time_limit) - (
+			SELECT COALESCE(SUM(p.play_time), 0) FROM daily_play_time p
+			WHERE p.player_id = g.minor_id AND p.day = d.day
+		) AS daily_remaining,
+		MIN(g.weekly_play_time_limit) - (
+			SELECT COALESCE(SUM(p.play_time), 0) FROM daily_play_time p
+			WHERE p.player_id = g.minor_id
+			AND p.day >= date_trunc('week', d.day)::date AND p.day < date_trunc('week', d.day)::date + 7
+		) AS weekly_remaining
+	FROM (SELECT DISTINCT * FROM unnest($1::int[], $2::date[])) AS d(player_id, day)
+	JOIN guardianships g ON g.minor_id = d.player_id
+	JOIN users u ON u.id = g.minor_id
+	WHERE EXTRACT(YEAR FROM age((NOW() AT TIME ZONE u.timezone)::date, u.birthdate)) < $3
+	GROUP BY g.minor_id, d.day`
+
+	rows, err := tx.QueryxContext(ctx, query, pq.Array(playerIDs), pq.Array(dates), models.AgeOfMajority)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var minorID uint
+		var day, week string
+		var dailyRemaining, weeklyRemaining *int
+		if err := rows.Scan(&minorID, &day, &week, &dailyRemaining, &weeklyRemaining); err != nil {
+			return nil, err
+		}
+
+		if remaining, limited := remainingAllowance(dailyRemaining); limited {
+			a.daily[playerDay{minorID, day}] = remaining
+		}
+		// the days of a week all see the same weekly remainder
+		if remaining, limited := remainingAllowance(weeklyRemaining); limited {
+			a.weekly[playerDay{minorID, week}] = remaining
+		}
+	}
+
+	return a, rows.Err()
+}
+
+// remainingAllowance is what a limit leaves, false when there is no such
+// limit. A limit already exceeded leaves nothing.
+func remainingAllowance(remainder *int) (uint, bool) {
+	if remainder == nil {
+		return 0, false
+	}
+	if *remainder < 0 {
+		return 0, true
+	}
+	return uint(*remainder), true
+}
+
+// consume clamps minutes played by a player on a day to what the limits of
+// the day and of its week leave, and deducts them from the allowances.
+func (a *allowances) consume(playerID uint, day, week string, minutes uint) uint {
+	d, w := playerDay{playerID, day}, playerDay{playerID, week}
+
+	daily, dailyLimited := a.daily[d]
+	if dailyLimited && minutes > daily {
+		minutes = daily
+	}
+	weekly, weeklyLimited := a.weekly[w]
+	if weeklyLimited && minutes > weekly {
+		minutes = weekly
+	}
+
+	if dailyLimited {
+		a.daily[d] = daily - minutes
+	}
+	if weeklyLimited {
+		a.weekly[w] = weekly - minutes
+	}
+
+	return minutes
+}
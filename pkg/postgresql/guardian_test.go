@@ -0,0 +1,81 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import "testing"
+
+func TestRemainingAllowance(t *testing.T) {
+	minutes := func(v int) *int { return &v }
+
+	tests := []struct {
+		name      string
+		remainder *int
+		remaining uint
+		limited   bool
+	}{
+		{"unlimited", nil, 0, false},
+		{"minutes left", minutes(30), 30, true},
+		{"used up", minutes(0), 0, true},
+		{"exceeded", minutes(-15), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, limited := remainingAllowance(tt.remainder)
+			if remaining != tt.remaining || limited != tt.limited {
+				t.Errorf("remainingAllowance() = %d, %v, want %d, %v", remaining, limited, tt.remaining, tt.limited)
+			}
+		})
+	}
+}
+
+func TestAllowancesConsume(t *testing.T) {
+	const player, day, week = 1, "2022-03-16", "2022-03-14"
+	limits := func(daily, weekly *uint) *allowances {
+		a := &allowances{daily: map[playerDay]uint{}, weekly: map[playerDay]uint{}}
+		if daily != nil {
+			a.daily[playerDay{player, day}] = *daily
+		}
+		if weekly != nil {
+			a.weekly[playerDay{player, week}] = *weekly
+		}
+		return a
+	}
+	minutes := func(v uint) *uint { return &v }
+
+	tests := []struct {
+		name          string
+		daily, weekly *uint
+		played        uint
+		want          uint
+	}{
+		{"unlimited", nil, nil, 45, 45},
+		{"within the limits", minutes(60), minutes(120), 45, 45},
+		{"daily limit", minutes(30), minutes(120), 45, 30},
+		{"weekly limit", minutes(60), minutes(20), 45, 20},
+		{"daily exceeded, weekly available", minutes(0), minutes(120), 45, 0},
+		{"weekly exceeded, daily available", minutes(60), minutes(0), 45, 0},
+		{"daily exceeded, no weekly limit", minutes(0), nil, 45, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := limits(tt.daily, tt.weekly)
+			if got := a.consume(player, day, week, tt.played); got != tt.want {
+				t.Errorf("consume() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
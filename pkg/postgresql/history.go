@@ -0,0 +1,111 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ models.PlayTimeHistoryService = (*PlayTimeHistoryService)(nil)
+
+type PlayTimeHistoryService struct {
+	db *DB
+}
+
+func NewPlayTimeHistoryService(db *DB) *PlayTimeHistoryService {
+	return &PlayTimeHistoryService{db}
+}
+
+func (hs *PlayTimeHistoryService) PlayTimeSeries(ctx context.Context, filter models.PlayTimeSeriesFilter) ([]models.PlayTimePoint, error) {
+	tx, err := hs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	points, err := findPlayTimeSeries(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return points, tx.Commit()
+}
+
+// findPlayTimeSeries sums the hourly buckets into buckets of the requested
+// granularity, aligned on the local midnights (or hours) of the location.
+func findPlayTimeSeries(ctx context.Context, tx *sqlx.Tx, filter models.PlayTimeSeriesFilter) ([]models.PlayTimePoint, error) {
+	location := filter.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	step := "1 day"
+	if filter.Granularity == models.GranularityHour {
+		step = "1 hour"
+	}
+
+	// the range is expressed in local wall clock time
+	const layout = "2006-01-02 15:04:05"
+	args := []interface{}{
+		filter.From.In(location).Format(layout),
+		filter.To.In(location).Format(layout),
+		step,
+		location.String(),
+	}
+	argPosition := len(args)
+
+	on := []string{
+		"h.hour >= ($1::timestamp AT TIME ZONE $4)",
+		"h.hour < ($2::timestamp AT TIME ZONE $4)",
+		"(h.hour AT TIME ZONE $4) >= s.start",
+		"(h.hour AT TIME ZONE $4) < s.start + $3::interval",
+	}
+
+	if v := filter.PlayerID; v != nil {
+		argPosition++
+		on, args = append(on, fmt.Sprintf("h.player_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.GameID; v != nil {
+		argPosition++
+		on, args = append(on, fmt.Sprintf("h.played_game_id = $%d", argPosition)), append(args, *v)
+	}
+
+	query := `
+	SELECT s.start AT TIME ZONE $4 AS start, COALESCE(SUM(h.play_time), 0) AS play_time
+	FROM generate_series($1::timestamp, $2::timestamp - $3::interval, $3::interval) AS s(start)
+	LEFT JOIN hourly_play_time h ON ` + strings.Join(on, " AND ") + `
+	GROUP BY s.start
+	ORDER BY s.start`
+
+	points := []models.PlayTimePoint{}
+	if err := tx.SelectContext(ctx, &points, query, args...); err != nil {
+		return nil, err
+	}
+
+	for i := range points {
+		points[i].Start = points[i].Start.In(location)
+	}
+
+	return points, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ models.LeaderboardService = (*LeaderboardService)(nil)
+
+type LeaderboardService struct {
+	db *DB
+}
+
+func NewLeaderboardService(db *DB) *LeaderboardService {
+	return &LeaderboardService{db}
+}
+
+func (ls *LeaderboardService) Leaderboard(ctx context.Context, filter models.LeaderboardFilter) ([]models.LeaderboardEntry, error) {
+	tx, err := ls.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	entries, err := findLeaderboard(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Commit()
+}
+
+func findLeaderboard(ctx context.Context, tx *sqlx.Tx, filter models.LeaderboardFilter) ([]models.LeaderboardEntry, error) {
+	query, args := leaderboardQuery(filter)
+
+	entries := []models.LeaderboardEntry{}
+	if err := tx.SelectContext(ctx, &entries, query, args...); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// leaderboardQuery ranks the players of a game by their play time, read from
+// the metadata rows overall and from the hourly buckets over a window.
+func leaderboardQuery(filter models.LeaderboardFilter) (string, []interface{}) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultLeaderboardSize
+	}
+
+	// the limit applies to the players, ties at the last rank may be cut
+	query := `
+	WITH totals AS (
+		SELECT player_id, play_time FROM metadata
+		WHERE played_game_id = $1 AND play_time > 0
+		ORDER BY play_time DESC, player_id
+		LIMIT $2
+	)`
+	args := []interface{}{filter.GameID, limit}
+
+	if filter.Since != nil {
+		query = `
+	WITH totals AS (
+		SELECT player_id, SUM(play_time) AS play_time FROM hourly_play_time
+		WHERE played_game_id = $1 AND hour >= date_trunc('hour', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+		GROUP BY player_id
+		HAVING SUM(play_time) > 0
+		ORDER BY SUM(play_time) DESC, player_id
+		LIMIT $2
+	)`
+		args = append(args, *filter.Since)
+	}
+
+	query += `
+	SELECT RANK() OVER (ORDER BY t.play_time DESC) AS rank, u.username, t.play_time
+	FROM totals t
+	JOIN users u ON u.id = t.player_id
+	ORDER BY rank, u.username`
+
+	return query, args
+}
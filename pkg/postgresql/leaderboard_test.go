@@ -0,0 +1,54 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+func TestLeaderboardQuery(t *testing.T) {
+	since := time.Date(2022, 3, 16, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter models.LeaderboardFilter
+		table  string
+		args   []interface{}
+	}{
+		{"overall", models.LeaderboardFilter{GameID: 3, Limit: 5}, "FROM metadata", []interface{}{uint(3), 5}},
+		{"default limit", models.LeaderboardFilter{GameID: 3}, "FROM metadata", []interface{}{uint(3), models.DefaultLeaderboardSize}},
+		{"window", models.LeaderboardFilter{GameID: 3, Since: &since, Limit: 5}, "FROM hourly_play_time", []interface{}{uint(3), 5, since}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := leaderboardQuery(tt.filter)
+			if !strings.Contains(query, tt.table) {
+				t.Errorf("query does not read %q:\n%s", tt.table, query)
+			}
+			if n := strings.Count(query, "WITH totals AS"); n != 1 {
+				t.Errorf("query has %d totals, want 1:\n%s", n, query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"anbox_mgmt/pkg/leader"
+)
+
+// AdvisoryLocker implements leader.Locker with a session level advisory lock.
+// The lock lives as long as the connection that took it, so PostgreSQL hands
+// it over as soon as the leader's connection drops.
+type AdvisoryLocker struct {
+	db       *DB
+	key      int64
+	interval time.Duration // between two checks of the connection
+}
+
+var _ leader.Locker = (*AdvisoryLocker)(nil)
+
+func NewAdvisoryLocker(db *DB, key int64, interval time.Duration) *AdvisoryLocker {
+	if interval <= 0 {
+		interval = leader.DefaultRetryInterval
+	}
+	return &AdvisoryLocker{db: db, key: key, interval: interval}
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context) (leader.Lock, error) {
+	// the lock belongs to the session, so it needs its own connection
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, leader.ErrNotAcquired
+	}
+
+	lock := &advisoryLock{
+		conn: conn,
+		key:  l.key,
+		lost: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go lock.watch(l.interval)
+
+	return lock, nil
+}
+
+type advisoryLock struct {
+	conn *sql.Conn
+	key  int64
+
+	once sync.Once
+	lost chan struct{}
+	done chan struct{}
+}
+
+func (l *advisoryLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// watch checks the connection periodically, the lock is gone with it.
+func (l *advisoryLock) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			_, err := l.conn.ExecContext(ctx, "SELECT 1")
+			cancel()
+			if err != nil {
+				l.once.Do(func() { close(l.lost) })
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *advisoryLock) Release(ctx context.Context) error {
+	close(l.done)
+	l.once.Do(func() { close(l.lost) })
+	defer l.conn.Close()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		// never hand a connection that may still hold the lock back to the pool
+		l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return err
+	}
+	return nil
+}
@@ -17,10 +17,14 @@ package postgresql
 import (
 	"anbox_mgmt/pkg/models"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 var _ models.MetadataService = (*MetadataService)(nil)
@@ -77,6 +81,9 @@ func (ms *MetadataService) UpdateMetadata(ctx context.Context, md *models.Metada
 	defer tx.Rollback()
 
 	if err := updateMetadata(ctx, tx, md, patch); err != nil {
+		if errors.Is(err, models.ErrPlayTimeLimitReached) {
+			return err
+		}
 		log.Println(err)
 		return models.ErrInternal
 	}
@@ -89,6 +96,64 @@ func (ms *MetadataService) UpdateMetadata(ctx context.Context, md *models.Metada
 	return nil
 }
 
+func (ms *MetadataService) IncrementPlayTime(ctx context.Context, id uint, delta uint) error {
+	if delta == 0 {
+		return nil
+	}
+
+	n, err := ms.IncrementPlayTimes(ctx, []models.PlayTimeIncrement{{MetadataID: id, Delta: delta}})
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return models.ErrPlayTimeLimitReached
+	}
+
+	return nil
+}
+
+func (ms *MetadataService) IncrementPlayTimes(ctx context.Context, increments []models.PlayTimeIncrement) (int, error) {
+	tx, err := ms.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		log.Println(err)
+		return 0, models.ErrInternal
+	}
+
+	defer tx.Rollback()
+
+	n, err := incrementPlayTimes(ctx, tx, increments)
+	if err != nil {
+		log.Println(err)
+		return 0, models.ErrInternal
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		return 0, models.ErrInternal
+	}
+
+	return n, nil
+}
+
+func (ms *MetadataService) SimulationTargets(ctx context.Context) ([]*models.Metadata, error) {
+	tx, err := ms.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	md, err := findSimulationTargets(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return md, tx.Commit()
+}
+
 func (ms *MetadataService) DeleteMetadata(ctx context.Context, id uint) error {
 	tx, err := ms.db.BeginTxx(ctx, nil)
 
@@ -122,10 +187,9 @@ func createMetadata(ctx context.Context, tx *sqlx.Tx, md *models.Metadata) error
 	err := tx.QueryRowxContext(ctx, query, args...).Scan(&md.ID, &md.CreatedAt, &md.UpdatedAt)
 
 	if err != nil {
-		return err
-	}
-
-	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "metadata_player_game_key"` {
+			return models.ErrAlreadyLinked
+		}
 		return err
 	}
 
@@ -138,7 +202,30 @@ func deleteMetadata(ctx context.Context, tx *sqlx.Tx, id uint) error {
 }
 
 func updateMetadata(ctx context.Context, tx *sqlx.Tx, md *models.Metadata, patch models.MetadataPatch) error {
+	if v := patch.PlayTime; v != nil && *v > md.PlayTime {
+		// play time increments go through the parental controls of the
+		// player, and keep the increments committed since md was read
+		credited, playTimes, err := creditPlayTime(ctx, tx, []playedTime{{MetadataID: md.ID, Minutes: *v - md.PlayTime}})
+		if err != nil {
+			return err
+		}
+		if credited[md.ID] == 0 {
+			return models.ErrPlayTimeLimitReached
+		}
+		sources := map[uint]models.PlaySessionSource{md.ID: models.PlaySessionAPI}
+		if err := insertEndedPlaySessions(ctx, tx, credited, sources, nil); err != nil {
+			return err
+		}
+		md.PlayTime = playTimes[md.ID].PlayTime
+		md.UpdatedAt = playTimes[md.ID].UpdatedAt
+		return nil
+	}
+
 	if v := patch.PlayTime; v != nil {
+		if err := trimPlaySessions(ctx, tx, md.ID, *v); err != nil {
+			log.Printf("error trimming play sessions: %v", err)
+			return models.ErrInternal
+		}
 		md.PlayTime = *v
 	}
 
@@ -160,6 +247,32 @@ func updateMetadata(ctx context.Context, tx *sqlx.Tx, md *models.Metadata, patch
 	return nil
 }
 
+// trimPlaySessions takes play time back from the latest ended sessions of a
+// link lowered to playTime, for its play time to stay the sum of their
+// durations.
+func trimPlaySessions(ctx context.Context, tx *sqlx.Tx, id uint, playTime uint) error {
+	var current uint
+	query := "SELECT play_time FROM metadata WHERE id = $1 FOR UPDATE"
+	if err := tx.QueryRowxContext(ctx, query, id).Scan(&current); err != nil {
+		return err
+	}
+	if playTime >= current {
+		return nil
+	}
+
+	query = `
+	UPDATE play_sessions p
+	SET duration = GREATEST(0, s.total - $2), updated_at = NOW()
+	FROM (
+		SELECT id, duration, SUM(duration) OVER (ORDER BY ended_at DESC, id DESC) AS total
+		FROM play_sessions
+		WHERE metadata_id = $1 AND ended_at IS NOT NULL AND duration > 0
+	) AS s
+	WHERE p.id = s.id AND s.total - s.duration < $2`
+
+	return execQuery(ctx, tx, query, id, current-playTime)
+}
+
 func findMetadata(ctx context.Context, tx *sqlx.Tx, filter models.MetadataFilter) ([]*models.Metadata, error) {
 	where, args := []string{}, []interface{}{}
 	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
@@ -184,7 +297,8 @@ func findMetadata(ctx context.Context, tx *sqlx.Tx, filter models.MetadataFilter
 		where, args = append(where, fmt.Sprintf("play_time = $%d", argPosition)), append(args, *v)
 	}
 
-	query := "SELECT * from metadata" + formatWhereClause(where) + " ORDER BY created_at DESC"
+	query := "SELECT * from metadata" + formatWhereClause(where) +
+		" ORDER BY created_at DESC" + formatLimitOffset(filter.Limit, filter.Offset)
 	md, err := queryMetadata(ctx, tx, query, args...)
 
 	if err != nil {
@@ -194,6 +308,44 @@ func findMetadata(ctx context.Context, tx *sqlx.Tx, filter models.MetadataFilter
 	return md, nil
 }
 
+// findSimulationTargets skips the associations of findMetadata, the players
+// only carry their time zone and the games their title.
+func findSimulationTargets(ctx context.Context, tx *sqlx.Tx) ([]*models.Metadata, error) {
+	query := `
+	SELECT m.id, m.player_id, m.played_game_id, g.title, u.timezone
+	FROM metadata m
+	JOIN games g ON g.id = m.played_game_id
+	JOIN users u ON u.id = m.player_id
+	ORDER BY m.id`
+
+	rows, err := tx.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	md := make([]*models.Metadata, 0)
+	players, games := map[uint]*models.User{}, map[uint]*models.Game{}
+	for rows.Next() {
+		m := &models.Metadata{}
+		var title, timezone string
+		if err := rows.Scan(&m.ID, &m.PlayerID, &m.PlayedGameID, &title, &timezone); err != nil {
+			return nil, err
+		}
+
+		if players[m.PlayerID] == nil {
+			players[m.PlayerID] = &models.User{ID: m.PlayerID, Timezone: timezone}
+		}
+		if games[m.PlayedGameID] == nil {
+			games[m.PlayedGameID] = &models.Game{ID: m.PlayedGameID, Title: title}
+		}
+		m.Player, m.PlayedGame = players[m.PlayerID], games[m.PlayedGameID]
+		md = append(md, m)
+	}
+
+	return md, rows.Err()
+}
+
 func queryMetadata(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) ([]*models.Metadata, error) {
 	md := make([]*models.Metadata, 0)
 
@@ -201,28 +353,352 @@ func queryMetadata(ctx context.Context, tx *sqlx.Tx, query string, args ...inter
 		return md, err
 	}
 
-	for _, m := range md {
-		if err := attachMetadataAssociations(ctx, tx, m); err != nil {
-			return nil, err
-		}
+	if err := attachMetadataAssociations(ctx, tx, md); err != nil {
+		return nil, err
 	}
 
 	return md, nil
 }
 
-func attachMetadataAssociations(ctx context.Context, tx *sqlx.Tx, md *models.Metadata) error {
-	user, err := findUserByID(ctx, tx, md.PlayerID)
+// attachMetadataAssociations loads the players and the games of all the
+// metadata rows with one query each.
+func attachMetadataAssociations(ctx context.Context, tx *sqlx.Tx, md []*models.Metadata) error {
+	if len(md) == 0 {
+		return nil
+	}
+
+	userIDs, gameIDs := []int64{}, []int64{}
+	seenUsers, seenGames := map[uint]bool{}, map[uint]bool{}
+	for _, m := range md {
+		if !seenUsers[m.PlayerID] {
+			seenUsers[m.PlayerID] = true
+			userIDs = append(userIDs, int64(m.PlayerID))
+		}
+		if !seenGames[m.PlayedGameID] {
+			seenGames[m.PlayedGameID] = true
+			gameIDs = append(gameIDs, int64(m.PlayedGameID))
+		}
+	}
+
+	users, err := queryUsers(ctx, tx, "SELECT * FROM users WHERE id = ANY($1)", pq.Array(userIDs))
 	if err != nil {
-		return fmt.Errorf("cannot find metadata player: %w", err)
+		return fmt.Errorf("cannot find metadata players: %w", err)
 	}
 
-	game, err := findGameByID(ctx, tx, md.PlayedGameID)
+	games, err := queryGames(ctx, tx, "SELECT * FROM games WHERE id = ANY($1)", pq.Array(gameIDs))
 	if err != nil {
-		return fmt.Errorf("cannot find metadata game: %w", err)
+		return fmt.Errorf("cannot find metadata games: %w", err)
 	}
 
-	md.Player = user
-	md.PlayedGame = game
+	usersByID := make(map[uint]*models.User, len(users))
+	for _, u := range users {
+		usersByID[u.ID] = u
+	}
+
+	gamesByID := make(map[uint]*models.Game, len(games))
+	for _, g := range games {
+		gamesByID[g.ID] = g
+	}
+
+	for _, m := range md {
+		if m.Player = usersByID[m.PlayerID]; m.Player == nil {
+			return fmt.Errorf("cannot find metadata player: %w", models.ErrNotFound)
+		}
+		if m.PlayedGame = gamesByID[m.PlayedGameID]; m.PlayedGame == nil {
+			return fmt.Errorf("cannot find metadata game: %w", models.ErrNotFound)
+		}
+	}
 
 	return nil
 }
+
+// incrementPlayTimes adds the increments to the play time of the metadata rows
+// with set-based statements, after clamping them to the parental controls.
+// Each row whose play time changed gets an ended play session.
+func incrementPlayTimes(ctx context.Context, tx *sqlx.Tx, increments []models.PlayTimeIncrement) (int, error) {
+	played := make([]playedTime, 0, len(increments))
+	sources := map[uint]models.PlaySessionSource{}
+	endedAt := map[uint]time.Time{}
+	for _, inc := range increments {
+		if inc.Delta > 0 {
+			p := playedTime{MetadataID: inc.MetadataID, Minutes: inc.Delta}
+			if !inc.PlayedAt.IsZero() {
+				p.StartedAt, p.EndedAt = inc.PlayedAt.Add(-time.Duration(inc.Delta)*time.Minute), inc.PlayedAt
+				if inc.PlayedAt.After(endedAt[inc.MetadataID]) {
+					endedAt[inc.MetadataID] = inc.PlayedAt
+				}
+			}
+			played = append(played, p)
+			if _, ok := sources[inc.MetadataID]; !ok {
+				sources[inc.MetadataID] = inc.Source
+			}
+		}
+	}
+
+	credited, _, err := creditPlayTime(ctx, tx, played)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertEndedPlaySessions(ctx, tx, credited, sources, endedAt); err != nil {
+		return 0, err
+	}
+
+	return len(credited), nil
+}
+
+// insertEndedPlaySessions records credited play time as sessions ending at the
+// given times, or now. The simulator traffic of a link accumulates in a single
+// session instead, extended on each tick.
+func insertEndedPlaySessions(ctx context.Context, tx *sqlx.Tx, credited map[uint]uint, sources map[uint]models.PlaySessionSource, endedAt map[uint]time.Time) error {
+	if len(credited) == 0 {
+		return nil
+	}
+
+	ids, creditedDeltas, creditedSources, ends := []int64{}, []int64{}, []string{}, []int64{}
+	for id, delta := range credited {
+		source := sources[id]
+		if source == "" {
+			source = models.PlaySessionImport
+		}
+		end := int64(0) // microseconds since the epoch, 0 for now
+		if t := endedAt[id]; !t.IsZero() {
+			end = t.UnixMicro()
+		}
+		ids = append(ids, int64(id))
+		creditedDeltas = append(creditedDeltas, int64(delta))
+		creditedSources = append(creditedSources, string(source))
+		ends = append(ends, end)
+	}
+
+	query := `
+	INSERT INTO play_sessions (metadata_id, source, started_at, last_heartbeat_at, ended_at, duration)
+	SELECT d.id, d.source, d.ended_at - make_interval(mins => d.delta), d.ended_at, d.ended_at, d.delta
+	FROM (
+		SELECT id, delta, source, COALESCE(to_timestamp(NULLIF(ended_at, 0) / 1e6), NOW()) AS ended_at
+		FROM unnest($1::int[], $2::int[], $3::text[], $4::bigint[]) AS d(id, delta, source, ended_at)
+	) AS d
+	ON CONFLICT (metadata_id) WHERE source = 'simulator'
+	DO UPDATE SET
+		started_at = LEAST(play_sessions.started_at, EXCLUDED.started_at),
+		last_heartbeat_at = GREATEST(play_sessions.last_heartbeat_at, EXCLUDED.last_heartbeat_at),
+		ended_at = GREATEST(play_sessions.ended_at, EXCLUDED.ended_at),
+		duration = play_sessions.duration + EXCLUDED.duration,
+		updated_at = NOW()`
+
+	return execQuery(ctx, tx, query, pq.Array(ids), pq.Array(creditedDeltas), pq.Array(creditedSources), pq.Array(ends))
+}
+
+// creditedPlayTime is the play time a metadata row reached once credited.
+type creditedPlayTime struct {
+	ID        uint      `db:"id"`
+	PlayTime  uint      `db:"play_time"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// playedTime is play time to credit to a metadata row: Minutes played between
+// StartedAt and EndedAt, or just now when EndedAt is zero.
+type playedTime struct {
+	MetadataID uint
+	Minutes    uint
+	StartedAt  time.Time
+	EndedAt    time.Time
+}
+
+// playedSlice is the part of a playedTime within a single hour and day.
+type playedSlice struct {
+	Hour    time.Time // in UTC
+	Day     string    // in the time zone of the player
+	Week    string    // Monday of Day
+	Minutes uint
+}
+
+const dayLayout = "2006-01-02"
+
+// sliceByHour splits play time at the hour boundaries and at the midnights of
+// loc, spreading its minutes evenly over the time played.
+func sliceByHour(p playedTime, now time.Time, loc *time.Location) []playedSlice {
+	if p.Minutes == 0 {
+		return nil
+	}
+
+	from, to := p.StartedAt, p.EndedAt
+	if to.IsZero() {
+		from, to = now, now
+	}
+	if !from.Before(to) {
+		from = to
+	}
+
+	slice := func(t time.Time, minutes uint) playedSlice {
+		local := t.In(loc)
+		y, m, d := local.Date()
+		monday := time.Date(y, m, d-(int(local.Weekday())+6)%7, 0, 0, 0, 0, loc)
+		return playedSlice{Hour: t.Truncate(time.Hour).UTC(), Day: local.Format(dayLayout), Week: monday.Format(dayLayout), Minutes: minutes}
+	}
+
+	if from.Equal(to) {
+		return []playedSlice{slice(to, p.Minutes)}
+	}
+
+	total := to.Sub(from)
+	slices := []playedSlice{}
+	sliced := uint(0)
+	for t := from; t.Before(to); {
+		next := t.Truncate(time.Hour).Add(time.Hour)
+		y, m, d := t.In(loc).Date()
+		if midnight := time.Date(y, m, d+1, 0, 0, 0, 0, loc); midnight.Before(next) {
+			next = midnight
+		}
+		if next.After(to) {
+			next = to
+		}
+
+		// the minutes played by next, rounded down so that the slices add up
+		upTo := uint(float64(p.Minutes) * float64(next.Sub(from)) / float64(total))
+		if next.Equal(to) {
+			upTo = p.Minutes
+		}
+		if upTo > sliced {
+			slices = append(slices, slice(t, upTo-sliced))
+			sliced = upTo
+		}
+		t = next
+	}
+
+	return slices
+}
+
+// creditPlayTime adds minutes to the play time of metadata rows, within the
+// parental controls of their players, and returns the minutes credited per row
+// with the play times the credited rows reach. The daily and hourly history
+// buckets of the time the minutes were played are updated along, and the
+// minutes count against the limits of the days they were played on.
+func creditPlayTime(ctx context.Context, tx *sqlx.Tx, played []playedTime) (map[uint]uint, map[uint]creditedPlayTime, error) {
+	credited, playTimes := map[uint]uint{}, map[uint]creditedPlayTime{}
+	if len(played) == 0 {
+		return credited, playTimes, nil
+	}
+
+	ids := make([]int64, 0, len(played))
+	seen := map[uint]bool{}
+	for _, p := range played {
+		if !seen[p.MetadataID] {
+			seen[p.MetadataID] = true
+			ids = append(ids, int64(p.MetadataID))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// lock the rows in a stable order so that concurrent batches cannot deadlock
+	type row struct {
+		ID       uint   `db:"id"`
+		PlayerID uint   `db:"player_id"`
+		Timezone string `db:"timezone"`
+	}
+	rows := []row{}
+	query := `
+	SELECT m.id, m.player_id, u.timezone FROM metadata m
+	JOIN users u ON u.id = m.player_id
+	WHERE m.id = ANY($1) ORDER BY m.id FOR UPDATE OF m`
+	if err := tx.SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[uint]row, len(rows))
+	for _, r := range rows {
+		byID[r.ID] = r
+	}
+
+	type rowSlice struct {
+		row
+		playedSlice
+	}
+	now := time.Now()
+	slices := []rowSlice{}
+	days := []playerDay{}
+	for _, p := range played {
+		r, ok := byID[p.MetadataID]
+		if !ok {
+			continue
+		}
+		for _, s := range sliceByHour(p, now, models.Location(r.Timezone)) {
+			slices = append(slices, rowSlice{r, s})
+			days = append(days, playerDay{r.PlayerID, s.Day})
+		}
+	}
+
+	// the earliest minutes are the first ones to count against the limits
+	sort.SliceStable(slices, func(i, j int) bool {
+		if !slices[i].Hour.Equal(slices[j].Hour) {
+			return slices[i].Hour.Before(slices[j].Hour)
+		}
+		return slices[i].ID < slices[j].ID
+	})
+
+	allowances, err := playTimeAllowances(ctx, tx, days)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sliceIDs, sliceDays, sliceHours, sliceDeltas := []int64{}, []string{}, []int64{}, []int64{}
+	for _, s := range slices {
+		if delta := allowances.consume(s.PlayerID, s.Day, s.Week, s.Minutes); delta > 0 {
+			sliceIDs, sliceDays = append(sliceIDs, int64(s.ID)), append(sliceDays, s.Day)
+			sliceHours, sliceDeltas = append(sliceHours, s.Hour.Unix()), append(sliceDeltas, int64(delta))
+			credited[s.ID] += delta
+		}
+	}
+
+	if len(credited) == 0 {
+		return credited, playTimes, nil
+	}
+
+	updatedIDs, updatedDeltas := make([]int64, 0, len(credited)), make([]int64, 0, len(credited))
+	for id, delta := range credited {
+		updatedIDs, updatedDeltas = append(updatedIDs, int64(id)), append(updatedDeltas, int64(delta))
+	}
+
+	query = `
+	UPDATE metadata m
+	SET play_time = m.play_time + d.delta, updated_at = NOW()
+	FROM unnest($1::int[], $2::int[]) AS d(id, delta)
+	WHERE m.id = d.id
+	RETURNING m.id, m.play_time, m.updated_at`
+
+	updated := []creditedPlayTime{}
+	if err := tx.SelectContext(ctx, &updated, query, pq.Array(updatedIDs), pq.Array(updatedDeltas)); err != nil {
+		return nil, nil, err
+	}
+	for _, u := range updated {
+		playTimes[u.ID] = u
+	}
+
+	query = `
+	INSERT INTO daily_play_time (player_id, played_game_id, day, play_time)
+	SELECT m.player_id, m.played_game_id, d.day, SUM(d.delta)
+	FROM unnest($1::int[], $2::date[], $3::int[]) AS d(id, day, delta)
+	JOIN metadata m ON m.id = d.id
+	GROUP BY m.player_id, m.played_game_id, d.day
+	ON CONFLICT (player_id, played_game_id, day)
+	DO UPDATE SET play_time = daily_play_time.play_time + EXCLUDED.play_time`
+
+	if err := execQuery(ctx, tx, query, pq.Array(sliceIDs), pq.Array(sliceDays), pq.Array(sliceDeltas)); err != nil {
+		return nil, nil, err
+	}
+
+	query = `
+	INSERT INTO hourly_play_time (player_id, played_game_id, hour, play_time)
+	SELECT m.player_id, m.played_game_id, to_timestamp(d.hour), SUM(d.delta)
+	FROM unnest($1::int[], $2::bigint[], $3::int[]) AS d(id, hour, delta)
+	JOIN metadata m ON m.id = d.id
+	GROUP BY m.player_id, m.played_game_id, d.hour
+	ON CONFLICT (player_id, played_game_id, hour)
+	DO UPDATE SET play_time = hourly_play_time.play_time + EXCLUDED.play_time`
+
+	if err := execQuery(ctx, tx, query, pq.Array(sliceIDs), pq.Array(sliceHours), pq.Array(sliceDeltas)); err != nil {
+		return nil, nil, err
+	}
+
+	return credited, playTimes, nil
+}
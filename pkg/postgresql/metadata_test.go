@@ -0,0 +1,89 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSliceByHour(t *testing.T) {
+	at := func(v string) time.Time {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := at("2022-03-16T10:20:00Z")
+
+	tests := []struct {
+		name   string
+		played playedTime
+		loc    *time.Location
+		want   []playedSlice
+	}{
+		{
+			"now",
+			playedTime{Minutes: 5},
+			time.UTC,
+			[]playedSlice{{at("2022-03-16T10:00:00Z"), "2022-03-16", "2022-03-14", 5}},
+		},
+		{
+			"within an hour",
+			playedTime{Minutes: 30, StartedAt: at("2022-03-10T08:10:00Z"), EndedAt: at("2022-03-10T08:40:00Z")},
+			time.UTC,
+			[]playedSlice{{at("2022-03-10T08:00:00Z"), "2022-03-10", "2022-03-07", 30}},
+		},
+		{
+			"across hours",
+			playedTime{Minutes: 60, StartedAt: at("2022-03-10T08:30:00Z"), EndedAt: at("2022-03-10T09:30:00Z")},
+			time.UTC,
+			[]playedSlice{
+				{at("2022-03-10T08:00:00Z"), "2022-03-10", "2022-03-07", 30},
+				{at("2022-03-10T09:00:00Z"), "2022-03-10", "2022-03-07", 30},
+			},
+		},
+		{
+			"across a local midnight",
+			playedTime{Minutes: 20, StartedAt: at("2022-03-13T22:50:00Z"), EndedAt: at("2022-03-13T23:30:00Z")},
+			paris,
+			[]playedSlice{
+				{at("2022-03-13T22:00:00Z"), "2022-03-13", "2022-03-07", 5},
+				{at("2022-03-13T23:00:00Z"), "2022-03-14", "2022-03-14", 15},
+			},
+		},
+		{
+			"fewer minutes than hours",
+			playedTime{Minutes: 1, StartedAt: at("2022-03-10T08:30:00Z"), EndedAt: at("2022-03-10T10:30:00Z")},
+			time.UTC,
+			[]playedSlice{{at("2022-03-10T10:00:00Z"), "2022-03-10", "2022-03-07", 1}},
+		},
+		{"nothing played", playedTime{}, time.UTC, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sliceByHour(tt.played, now, tt.loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sliceByHour() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
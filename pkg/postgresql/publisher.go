@@ -0,0 +1,320 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gosimple/slug"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.PublisherService = (*PublisherService)(nil)
+
+type PublisherService struct {
+	db *DB
+}
+
+func NewPublisherService(db *DB) *PublisherService {
+	return &PublisherService{db}
+}
+
+func (ps *PublisherService) CreatePublisher(ctx context.Context, publisher *models.Publisher) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := createPublisher(ctx, tx, publisher); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ps *PublisherService) Publishers(ctx context.Context, filter models.PublisherFilter) ([]*models.Publisher, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	publishers, err := findPublishers(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return publishers, tx.Commit()
+}
+
+func (ps *PublisherService) UpdatePublisher(ctx context.Context, publisher *models.Publisher, patch models.PublisherPatch) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := updatePublisher(ctx, tx, publisher, patch); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ps *PublisherService) DeletePublisher(ctx context.Context, id uint) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := execQuery(ctx, tx, "DELETE FROM publishers WHERE id = $1", id); err != nil {
+		if err.Error() == `pq: update or delete on table "publishers" violates foreign key constraint "fk_publisher" on table "games"` {
+			return models.ErrPublisherHasGames
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ps *PublisherService) PublisherAccounts(ctx context.Context, publisherID uint) ([]*models.User, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	users, err := queryUsers(ctx, tx, "SELECT * FROM users WHERE publisher_id = $1 ORDER BY username", publisherID)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, tx.Commit()
+}
+
+func (ps *PublisherService) SetPublisherAccount(ctx context.Context, userID uint, publisherID *uint) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := "UPDATE users SET publisher_id = $1, updated_at = NOW() WHERE id = $2"
+	if err := execQuery(ctx, tx, query, publisherID, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func createPublisher(ctx context.Context, tx *sqlx.Tx, publisher *models.Publisher) error {
+	query := `
+	INSERT INTO publishers (name, key, slug, website, description)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`
+
+	publisher.Key = models.PublisherKey(publisher.Name)
+	publisher.Slug = slug.Make(publisher.Name)
+
+	args := []interface{}{
+		publisher.Name,
+		publisher.Key,
+		publisher.Slug,
+		publisher.Website,
+		publisher.Description,
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&publisher.ID, &publisher.CreatedAt, &publisher.UpdatedAt); err != nil {
+		return publisherError(err)
+	}
+
+	return nil
+}
+
+func findPublishers(ctx context.Context, tx *sqlx.Tx, filter models.PublisherFilter) ([]*models.Publisher, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Slug; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("slug = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Name; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("key = $%d", argPosition)), append(args, models.PublisherKey(*v))
+	}
+
+	query := `
+	SELECT *,
+		(SELECT COUNT(*) FROM games g WHERE g.publisher_id = publishers.id) AS games_count,
+		(SELECT COUNT(*) FROM users u WHERE u.publisher_id = publishers.id) AS accounts_count
+	FROM publishers` + formatWhereClause(where) +
+		" ORDER BY name" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	publishers := []*models.Publisher{}
+	if err := findMany(ctx, tx, &publishers, query, args...); err != nil {
+		return nil, err
+	}
+
+	return publishers, nil
+}
+
+func updatePublisher(ctx context.Context, tx *sqlx.Tx, publisher *models.Publisher, patch models.PublisherPatch) error {
+	if v := patch.Name; v != nil {
+		publisher.Name = *v
+		publisher.Key = models.PublisherKey(*v)
+		publisher.Slug = slug.Make(*v)
+	}
+
+	if v := patch.Website; v != nil {
+		publisher.Website = *v
+	}
+
+	if v := patch.Description; v != nil {
+		publisher.Description = *v
+	}
+
+	args := []interface{}{
+		publisher.Name,
+		publisher.Key,
+		publisher.Slug,
+		publisher.Website,
+		publisher.Description,
+		publisher.ID,
+	}
+
+	query := `
+	UPDATE publishers
+	SET name = $1, key = $2, slug = $3, website = $4, description = $5, updated_at = NOW() WHERE id = $6
+	RETURNING updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&publisher.UpdatedAt); err != nil {
+		return publisherError(err)
+	}
+
+	return nil
+}
+
+// findOrCreatePublisher returns the publisher with this name in any spelling,
+// creating it when there is none.
+func findOrCreatePublisher(ctx context.Context, tx *sqlx.Tx, name string) (*models.Publisher, error) {
+	key := models.PublisherKey(name)
+
+	query := `
+	INSERT INTO publishers (name, key, slug)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (key) DO NOTHING`
+	if err := execQuery(ctx, tx, query, name, key, slug.Make(name)); err != nil {
+		return nil, publisherError(err)
+	}
+
+	publishers, err := findPublishers(ctx, tx, models.PublisherFilter{Name: &name})
+	if err != nil {
+		return nil, err
+	}
+	if len(publishers) == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	return publishers[0], nil
+}
+
+// resolveGamePublisher points the game to the publisher named after its
+// Publisher, creating the publisher when new. A game without publisher name
+// has no publisher.
+func resolveGamePublisher(ctx context.Context, tx *sqlx.Tx, game *models.Game) error {
+	name := strings.TrimSpace(game.Publisher)
+	if models.PublisherKey(name) == "" {
+		game.PublisherID, game.Publisher = nil, ""
+		return nil
+	}
+
+	publisher, err := findOrCreatePublisher(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+
+	game.PublisherID, game.Publisher = &publisher.ID, publisher.Name
+	return nil
+}
+
+// attachGamePublishers loads the publisher names of all the games in one
+// query.
+func attachGamePublishers(ctx context.Context, tx *sqlx.Tx, games []*models.Game) error {
+	ids := []int64{}
+	for _, g := range games {
+		g.Publisher = ""
+		if g.PublisherID != nil {
+			ids = append(ids, int64(*g.PublisherID))
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows := []struct {
+		ID   uint   `db:"id"`
+		Name string `db:"name"`
+	}{}
+	if err := tx.SelectContext(ctx, &rows, "SELECT id, name FROM publishers WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return err
+	}
+
+	names := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		names[r.ID] = r.Name
+	}
+
+	for _, g := range games {
+		if g.PublisherID != nil {
+			g.Publisher = names[*g.PublisherID]
+		}
+	}
+
+	return nil
+}
+
+func publisherError(err error) error {
+	switch err.Error() {
+	case `pq: duplicate key value violates unique constraint "publishers_key_key"`,
+		`pq: duplicate key value violates unique constraint "publishers_slug_key"`:
+		return models.ErrDuplicatePublisher
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"errors"
+	"testing"
+
+	"anbox_mgmt/pkg/models"
+)
+
+func TestPublisherError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"duplicate key", errors.New(`pq: duplicate key value violates unique constraint "publishers_key_key"`), models.ErrDuplicatePublisher},
+		{"duplicate slug", errors.New(`pq: duplicate key value violates unique constraint "publishers_slug_key"`), models.ErrDuplicatePublisher},
+		{"other constraint", errors.New(`pq: duplicate key value violates unique constraint "games_slug_key"`), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want == nil {
+				want = tt.err
+			}
+			if got := publisherError(tt.err); got != want {
+				t.Errorf("publisherError() = %v, want %v", got, want)
+			}
+		})
+	}
+}
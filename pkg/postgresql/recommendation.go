@@ -0,0 +1,213 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.RecommendationService = (*RecommendationService)(nil)
+
+type RecommendationService struct {
+	db *DB
+}
+
+func NewRecommendationService(db *DB) *RecommendationService {
+	return &RecommendationService{db}
+}
+
+func (rs *RecommendationService) ComputeSimilarities(ctx context.Context) (int, error) {
+	tx, err := rs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	n, err := computeGameSimilarities(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+func (rs *RecommendationService) SimilarGames(ctx context.Context, gameID uint) ([]*models.Recommendation, error) {
+	tx, err := rs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	recommendations, err := findSimilarGames(ctx, tx, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	return recommendations, tx.Commit()
+}
+
+func (rs *RecommendationService) Recommendations(ctx context.Context, playerID uint) ([]*models.Recommendation, error) {
+	tx, err := rs.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	recommendations, err := findRecommendations(ctx, tx, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return recommendations, tx.Commit()
+}
+
+// linkWeight is the weight of a link in the similarities: linking a game
+// counts, playing it more counts more but with diminishing returns.
+const linkWeight = "(1 + ln(1 + m.play_time))"
+
+// computeGameSimilarities scores each pair of games with the cosine of their
+// vectors of link weights per player, then keeps the most similar games of
+// each game. Readers see the previous similarities until the transaction
+// commits.
+func computeGameSimilarities(ctx context.Context, tx *sqlx.Tx) (int, error) {
+	if err := execQuery(ctx, tx, "DELETE FROM game_similarities"); err != nil {
+		return 0, err
+	}
+
+	query := `
+	WITH weights AS (
+		SELECT m.player_id, m.played_game_id AS game_id, ` + linkWeight + ` AS weight
+		FROM metadata m
+	),
+	norms AS (
+		SELECT game_id, sqrt(SUM(weight * weight)) AS norm
+		FROM weights
+		GROUP BY game_id
+	),
+	pairs AS (
+		SELECT a.game_id, b.game_id AS similar_game_id, COUNT(*) AS players, SUM(a.weight * b.weight) AS dot
+		FROM weights a
+		JOIN weights b ON b.player_id = a.player_id AND b.game_id <> a.game_id
+		GROUP BY a.game_id, b.game_id
+	),
+	scored AS (
+		SELECT p.game_id, p.similar_game_id, p.players, p.dot / (na.norm * nb.norm) AS score
+		FROM pairs p
+		JOIN norms na ON na.game_id = p.game_id
+		JOIN norms nb ON nb.game_id = p.similar_game_id
+	),
+	ranked AS (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY game_id ORDER BY score DESC, players DESC, similar_game_id) AS rank
+		FROM scored
+	)
+	INSERT INTO game_similarities (game_id, similar_game_id, score, players)
+	SELECT game_id, similar_game_id, score, players
+	FROM ranked
+	WHERE rank <= $1`
+
+	res, err := tx.ExecContext(ctx, query, models.MaxSimilarGames)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func findSimilarGames(ctx context.Context, tx *sqlx.Tx, gameID uint) ([]*models.Recommendation, error) {
+	query := `
+	SELECT similar_game_id AS game_id, score, players
+	FROM game_similarities
+	WHERE game_id = $1
+	ORDER BY score DESC, players DESC, similar_game_id`
+
+	recommendations := []*models.Recommendation{}
+	if err := findMany(ctx, tx, &recommendations, query, gameID); err != nil {
+		return nil, err
+	}
+
+	return recommendations, attachRecommendedGames(ctx, tx, recommendations)
+}
+
+// findRecommendations sums the similarities of the games of the player to the
+// games they do not have, each weighted by how much the player played theirs.
+func findRecommendations(ctx context.Context, tx *sqlx.Tx, playerID uint) ([]*models.Recommendation, error) {
+	query := `
+	SELECT s.similar_game_id AS game_id,
+		SUM(s.score * ` + linkWeight + `) AS score,
+		array_agg(g.slug ORDER BY s.score * ` + linkWeight + ` DESC) AS because
+	FROM metadata m
+	JOIN game_similarities s ON s.game_id = m.played_game_id
+	JOIN games g ON g.id = m.played_game_id
+	WHERE m.player_id = $1
+	AND NOT EXISTS (SELECT 1 FROM metadata o WHERE o.player_id = $1 AND o.played_game_id = s.similar_game_id)
+	GROUP BY s.similar_game_id
+	ORDER BY score DESC, s.similar_game_id`
+
+	rows := []struct {
+		GameID  uint           `db:"game_id"`
+		Score   float64        `db:"score"`
+		Because pq.StringArray `db:"because"`
+	}{}
+	if err := tx.SelectContext(ctx, &rows, query, playerID); err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]*models.Recommendation, 0, len(rows))
+	for _, r := range rows {
+		recommendations = append(recommendations, &models.Recommendation{GameID: r.GameID, Score: r.Score, Because: r.Because})
+	}
+
+	return recommendations, attachRecommendedGames(ctx, tx, recommendations)
+}
+
+// attachRecommendedGames loads the games of the recommendations, with their
+// ratings, in one query.
+func attachRecommendedGames(ctx context.Context, tx *sqlx.Tx, recommendations []*models.Recommendation) error {
+	if len(recommendations) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(recommendations))
+	for _, r := range recommendations {
+		ids = append(ids, int64(r.GameID))
+	}
+
+	games, err := queryGames(ctx, tx, "SELECT * FROM games WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint]*models.Game, len(games))
+	for _, g := range games {
+		byID[g.ID] = g
+	}
+
+	for _, r := range recommendations {
+		r.Game = byID[r.GameID]
+	}
+
+	return nil
+}
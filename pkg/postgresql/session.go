@@ -0,0 +1,740 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.PlaySessionService = (*PlaySessionService)(nil)
+
+type PlaySessionService struct {
+	db      *DB
+	timeout time.Duration // without heartbeat, after which a session ends
+}
+
+func NewPlaySessionService(db *DB, timeout time.Duration) *PlaySessionService {
+	if timeout <= 0 {
+		timeout = models.DefaultHeartbeatTimeout
+	}
+	return &PlaySessionService{db, timeout}
+}
+
+func (ps *PlaySessionService) StartPlaySession(ctx context.Context, session *models.PlaySession) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := startPlaySession(ctx, tx, session); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ps *PlaySessionService) PlaySessions(ctx context.Context, filter models.PlaySessionFilter) ([]*models.PlaySession, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	sessions, err := findPlaySessions(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, tx.Commit()
+}
+
+func (ps *PlaySessionService) HeartbeatPlaySession(ctx context.Context, id uint, at time.Time) (*models.PlaySession, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	session, err := heartbeatPlaySession(ctx, tx, id, at, ps.timeout)
+	if err != nil && !errors.Is(err, models.ErrPlaySessionExpired) {
+		return nil, err
+	}
+
+	// an expired session is ended, which must be committed too
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return session, err
+}
+
+func (ps *PlaySessionService) EndPlaySession(ctx context.Context, id uint, at time.Time) (*models.PlaySession, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	session, err := endPlaySession(ctx, tx, id, at, ps.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, tx.Commit()
+}
+
+func (ps *PlaySessionService) IngestHeartbeat(ctx context.Context, hb *models.Heartbeat) (*models.PlaySession, bool, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer tx.Rollback()
+
+	session, duplicate, err := ingestHeartbeat(ctx, tx, hb, ps.timeout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return session, duplicate, tx.Commit()
+}
+
+func (ps *PlaySessionService) IngestPlayEvents(ctx context.Context, events []*models.PlayEvent) ([]string, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	duplicates, err := ingestPlayEvents(ctx, tx, events)
+	if err != nil {
+		return nil, err
+	}
+
+	return duplicates, tx.Commit()
+}
+
+func (ps *PlaySessionService) ExpirePlaySessions(ctx context.Context, now time.Time) (int, error) {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	n, err := expirePlaySessions(ctx, tx, now, ps.timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+func startPlaySession(ctx context.Context, tx *sqlx.Tx, session *models.PlaySession) error {
+	query := `
+	INSERT INTO play_sessions (metadata_id, source, started_at, last_heartbeat_at)
+	VALUES ($1, $2, $3, $3) RETURNING id, last_heartbeat_at, created_at, updated_at
+	`
+
+	if session.StartedAt.IsZero() {
+		session.StartedAt = time.Now()
+	}
+
+	args := []interface{}{
+		session.MetadataID,
+		session.Source,
+		session.StartedAt,
+	}
+
+	err := tx.QueryRowxContext(ctx, query, args...).Scan(&session.ID, &session.LastHeartbeatAt, &session.CreatedAt, &session.UpdatedAt)
+
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "play_sessions_open_key"` {
+			return models.ErrPlaySessionInProgress
+		}
+		return err
+	}
+
+	return nil
+}
+
+// lockPlaySession loads a session and locks it until the end of the
+// transaction. Its metadata row is locked first, like the heartbeats do, so
+// that they cannot deadlock.
+func lockPlaySession(ctx context.Context, tx *sqlx.Tx, id uint) (*models.PlaySession, error) {
+	query := "SELECT id FROM metadata WHERE id = (SELECT metadata_id FROM play_sessions WHERE id = $1) FOR UPDATE"
+	if err := execQuery(ctx, tx, query, id); err != nil {
+		return nil, err
+	}
+
+	query = playSessionSelect + " WHERE s.id = $1 FOR UPDATE OF s"
+
+	sessions := make([]*models.PlaySession, 0)
+	if err := findMany(ctx, tx, &sessions, query, id); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	return sessions[0], nil
+}
+
+func heartbeatPlaySession(ctx context.Context, tx *sqlx.Tx, id uint, at time.Time, timeout time.Duration) (*models.PlaySession, error) {
+	session, err := lockPlaySession(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.Open() {
+		return nil, models.ErrPlaySessionEnded
+	}
+
+	// the player stopped playing at the last heartbeat
+	if at.Sub(session.LastHeartbeatAt) > timeout {
+		if err := closePlaySession(ctx, tx, session, session.LastHeartbeatAt); err != nil {
+			return nil, err
+		}
+		return session, models.ErrPlaySessionExpired
+	}
+
+	// heartbeats arriving out of order never move the session back in time
+	if at.After(session.LastHeartbeatAt) {
+		session.ActiveSeconds += uint(at.Sub(session.LastHeartbeatAt) / time.Second)
+		session.LastHeartbeatAt = at
+	}
+
+	query := `
+	UPDATE play_sessions
+	SET last_heartbeat_at = $1, active_seconds = $2, updated_at = NOW() WHERE id = $3
+	RETURNING updated_at`
+
+	args := []interface{}{
+		session.LastHeartbeatAt,
+		session.ActiveSeconds,
+		session.ID,
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&session.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func endPlaySession(ctx context.Context, tx *sqlx.Tx, id uint, at time.Time, timeout time.Duration) (*models.PlaySession, error) {
+	session, err := lockPlaySession(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.Open() {
+		return nil, models.ErrPlaySessionEnded
+	}
+
+	// the time since the last heartbeat counts up to the timeout
+	if at.Sub(session.LastHeartbeatAt) > timeout {
+		at = session.LastHeartbeatAt.Add(timeout)
+	}
+	if at.After(session.LastHeartbeatAt) {
+		session.ActiveSeconds += uint(at.Sub(session.LastHeartbeatAt) / time.Second)
+		session.LastHeartbeatAt = at
+	}
+
+	if err := closePlaySession(ctx, tx, session, session.LastHeartbeatAt); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// closePlaySession ends a locked session and credits its active time to the
+// play time of the link, within the play time limits of the player.
+func closePlaySession(ctx context.Context, tx *sqlx.Tx, session *models.PlaySession, endedAt time.Time) error {
+	credited, _, err := creditPlayTime(ctx, tx, []playedTime{{
+		MetadataID: session.MetadataID,
+		Minutes:    session.ActiveSeconds / 60,
+		StartedAt:  session.StartedAt,
+		EndedAt:    endedAt,
+	}})
+	if err != nil {
+		return err
+	}
+
+	session.EndedAt = &endedAt
+	session.Duration = credited[session.MetadataID]
+
+	query := `
+	UPDATE play_sessions
+	SET ended_at = $1, last_heartbeat_at = $2, active_seconds = $3, duration = $4, updated_at = NOW() WHERE id = $5
+	RETURNING updated_at`
+
+	args := []interface{}{
+		session.EndedAt,
+		session.LastHeartbeatAt,
+		session.ActiveSeconds,
+		session.Duration,
+		session.ID,
+	}
+
+	return tx.QueryRowxContext(ctx, query, args...).Scan(&session.UpdatedAt)
+}
+
+func ingestHeartbeat(ctx context.Context, tx *sqlx.Tx, hb *models.Heartbeat, timeout time.Duration) (*models.PlaySession, bool, error) {
+	if hb.ReceivedAt.IsZero() {
+		hb.ReceivedAt = time.Now()
+	}
+
+	// serialize the heartbeats of a link, so that only one of them opens a session
+	var playerID uint
+	query := "SELECT player_id FROM metadata WHERE id = $1 FOR UPDATE"
+	if err := tx.QueryRowxContext(ctx, query, hb.MetadataID).Scan(&playerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, models.ErrNotFound
+		}
+		return nil, false, err
+	}
+
+	query = `
+	INSERT INTO play_heartbeats (player_id, heartbeat_id, received_at)
+	VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	res, err := tx.ExecContext(ctx, query, hb.PlayerID, hb.ID, hb.ReceivedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, false, err
+	} else if n == 0 {
+		// a retry, answer with the session the heartbeat went to
+		session, err := heartbeatSession(ctx, tx, hb)
+		return session, true, err
+	}
+
+	open := true
+	sessions, err := findPlaySessions(ctx, tx, models.PlaySessionFilter{MetadataID: &hb.MetadataID, Open: &open})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var session *models.PlaySession
+	if len(sessions) > 0 {
+		session, err = heartbeatPlaySession(ctx, tx, sessions[0].ID, hb.ReceivedAt, timeout)
+		if errors.Is(err, models.ErrPlaySessionExpired) {
+			session = nil // a new session starts with this heartbeat
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if session == nil {
+		session = &models.PlaySession{
+			MetadataID: hb.MetadataID,
+			Source:     models.PlaySessionClient,
+			StartedAt:  hb.ReceivedAt,
+		}
+		if err := startPlaySession(ctx, tx, session); err != nil {
+			return nil, false, err
+		}
+		if sessions, err = findPlaySessions(ctx, tx, models.PlaySessionFilter{ID: &session.ID}); err != nil {
+			return nil, false, err
+		}
+		session = sessions[0]
+	}
+
+	query = "UPDATE play_heartbeats SET session_id = $1 WHERE player_id = $2 AND heartbeat_id = $3"
+	if err := execQuery(ctx, tx, query, session.ID, hb.PlayerID, hb.ID); err != nil {
+		return nil, false, err
+	}
+
+	return session, false, nil
+}
+
+// ingestPlayEvents copies the events into a staging table, keeps the ones never
+// ingested before and turns them into ended client sessions.
+func ingestPlayEvents(ctx context.Context, tx *sqlx.Tx, events []*models.PlayEvent) ([]string, error) {
+	duplicates := []string{}
+	if len(events) == 0 {
+		return duplicates, nil
+	}
+
+	query := `
+	CREATE TEMPORARY TABLE staging_play_events (
+		position INT NOT NULL,
+		player_id INT NOT NULL,
+		event_id TEXT NOT NULL,
+		metadata_id INT NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		ended_at TIMESTAMPTZ NOT NULL
+	) ON COMMIT DROP`
+
+	if err := execQuery(ctx, tx, query); err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("staging_play_events",
+		"position", "player_id", "event_id", "metadata_id", "started_at", "ended_at"))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, e := range events {
+		if _, err := stmt.ExecContext(ctx, i, e.PlayerID, e.ID, e.MetadataID, e.StartedAt, e.EndedAt); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+
+	// flush the COPY
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		PlayerID uint   `db:"player_id"`
+		EventID  string `db:"event_id"`
+	}
+
+	fresh := []key{}
+	query = `
+	INSERT INTO play_events (player_id, event_id)
+	SELECT DISTINCT player_id, event_id FROM staging_play_events
+	ON CONFLICT DO NOTHING
+	RETURNING player_id, event_id`
+
+	if err := tx.SelectContext(ctx, &fresh, query); err != nil {
+		return nil, err
+	}
+
+	// events seen before, in a previous upload or earlier in this one
+	isFresh := make(map[key]bool, len(fresh))
+	for _, k := range fresh {
+		isFresh[k] = true
+	}
+	accepted := make([]*models.PlayEvent, 0, len(fresh))
+	for _, e := range events {
+		k := key{e.PlayerID, e.ID}
+		if !isFresh[k] {
+			duplicates = append(duplicates, e.ID)
+		} else {
+			accepted = append(accepted, e)
+		}
+		delete(isFresh, k)
+	}
+
+	if len(accepted) == 0 {
+		return duplicates, nil
+	}
+
+	activeSeconds, err := playEventsActiveSeconds(ctx, tx, accepted)
+	if err != nil {
+		return nil, err
+	}
+
+	playerIDs, eventIDs, seconds := make([]int64, 0, len(accepted)), make([]string, 0, len(accepted)), make([]int64, 0, len(accepted))
+	for i, e := range accepted {
+		playerIDs, eventIDs = append(playerIDs, int64(e.PlayerID)), append(eventIDs, e.ID)
+		seconds = append(seconds, activeSeconds[i])
+	}
+
+	type row struct {
+		ID            uint      `db:"id"`
+		MetadataID    uint      `db:"metadata_id"`
+		ActiveSeconds uint      `db:"active_seconds"`
+		StartedAt     time.Time `db:"started_at"`
+		EndedAt       time.Time `db:"ended_at"`
+	}
+
+	sessions := []row{}
+	query = `
+	INSERT INTO play_sessions (metadata_id, source, started_at, last_heartbeat_at, ended_at, active_seconds)
+	SELECT DISTINCT ON (s.player_id, s.event_id)
+		s.metadata_id, 'client', s.started_at, s.ended_at, s.ended_at, f.active_seconds
+	FROM staging_play_events s
+	JOIN unnest($1::int[], $2::text[], $3::int[]) AS f(player_id, event_id, active_seconds) USING (player_id, event_id)
+	ORDER BY s.player_id, s.event_id, s.position
+	RETURNING id, metadata_id, active_seconds, started_at, ended_at`
+
+	if err := tx.SelectContext(ctx, &sessions, query, pq.Array(playerIDs), pq.Array(eventIDs), pq.Array(seconds)); err != nil {
+		return nil, err
+	}
+
+	played := make([]playedTime, 0, len(sessions))
+	for _, session := range sessions {
+		played = append(played, playedTime{
+			MetadataID: session.MetadataID,
+			Minutes:    session.ActiveSeconds / 60,
+			StartedAt:  session.StartedAt,
+			EndedAt:    session.EndedAt,
+		})
+	}
+
+	credited, _, err := creditPlayTime(ctx, tx, played)
+	if err != nil {
+		return nil, err
+	}
+
+	// the credited minutes of a link go to its sessions in order, until the
+	// play time limits of the player cut them
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	ids, durations := []int64{}, []int64{}
+	for _, session := range sessions {
+		duration := session.ActiveSeconds / 60
+		if duration > credited[session.MetadataID] {
+			duration = credited[session.MetadataID]
+		}
+		credited[session.MetadataID] -= duration
+		if duration > 0 {
+			ids, durations = append(ids, int64(session.ID)), append(durations, int64(duration))
+		}
+	}
+
+	query = `
+	UPDATE play_sessions s
+	SET duration = d.duration
+	FROM unnest($1::int[], $2::int[]) AS d(id, duration)
+	WHERE s.id = d.id`
+
+	if err := execQuery(ctx, tx, query, pq.Array(ids), pq.Array(durations)); err != nil {
+		return nil, err
+	}
+
+	return duplicates, nil
+}
+
+// playEventsActiveSeconds returns the seconds of each event that neither the
+// client sessions of its link nor the events before it in the upload cover, so
+// that overlapping events are only counted once. The other sessions are not
+// periods of play, only the time they credited.
+func playEventsActiveSeconds(ctx context.Context, tx *sqlx.Tx, events []*models.PlayEvent) ([]int64, error) {
+	ids := []int64{}
+	from, to := events[0].StartedAt, events[0].EndedAt
+	for _, e := range events {
+		ids = append(ids, int64(e.MetadataID))
+		if e.StartedAt.Before(from) {
+			from = e.StartedAt
+		}
+		if e.EndedAt.After(to) {
+			to = e.EndedAt
+		}
+	}
+
+	// lock the links so that concurrent uploads cannot both count a period
+	query := "SELECT id FROM metadata WHERE id = ANY($1) ORDER BY id FOR UPDATE"
+	if err := execQuery(ctx, tx, query, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	type row struct {
+		MetadataID uint      `db:"metadata_id"`
+		StartedAt  time.Time `db:"started_at"`
+		EndedAt    time.Time `db:"ended_at"`
+	}
+	rows := []row{}
+	query = `
+	SELECT metadata_id, started_at, COALESCE(ended_at, last_heartbeat_at) AS ended_at
+	FROM play_sessions
+	WHERE metadata_id = ANY($1) AND source = $4
+	AND started_at < $3 AND COALESCE(ended_at, last_heartbeat_at) > $2`
+	if err := tx.SelectContext(ctx, &rows, query, pq.Array(ids), from, to, models.PlaySessionClient); err != nil {
+		return nil, err
+	}
+
+	played := map[uint][]playSpan{}
+	for _, r := range rows {
+		played[r.MetadataID] = append(played[r.MetadataID], playSpan{r.StartedAt, r.EndedAt})
+	}
+
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return events[order[i]].StartedAt.Before(events[order[j]].StartedAt) })
+
+	seconds := make([]int64, len(events))
+	for _, i := range order {
+		e := events[i]
+		seconds[i] = int64(uncoveredTime(e.StartedAt, e.EndedAt, played[e.MetadataID]) / time.Second)
+		played[e.MetadataID] = append(played[e.MetadataID], playSpan{e.StartedAt, e.EndedAt})
+	}
+
+	return seconds, nil
+}
+
+// playSpan is a period of play.
+type playSpan struct {
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// uncoveredTime returns how much of the period between from and to none of the
+// spans covers.
+func uncoveredTime(from, to time.Time, spans []playSpan) time.Duration {
+	overlaps := []playSpan{}
+	for _, s := range spans {
+		if s.StartedAt.Before(to) && s.EndedAt.After(from) {
+			if s.StartedAt.Before(from) {
+				s.StartedAt = from
+			}
+			if s.EndedAt.After(to) {
+				s.EndedAt = to
+			}
+			overlaps = append(overlaps, s)
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].StartedAt.Before(overlaps[j].StartedAt) })
+
+	uncovered, t := time.Duration(0), from
+	for _, s := range overlaps {
+		if s.StartedAt.After(t) {
+			uncovered += s.StartedAt.Sub(t)
+		}
+		if s.EndedAt.After(t) {
+			t = s.EndedAt
+		}
+	}
+	if to.After(t) {
+		uncovered += to.Sub(t)
+	}
+
+	return uncovered
+}
+
+// heartbeatSession finds the session a heartbeat was counted in.
+func heartbeatSession(ctx context.Context, tx *sqlx.Tx, hb *models.Heartbeat) (*models.PlaySession, error) {
+	query := playSessionSelect + `
+	JOIN play_heartbeats h ON h.session_id = s.id
+	WHERE h.player_id = $1 AND h.heartbeat_id = $2`
+
+	sessions := make([]*models.PlaySession, 0)
+	if err := findMany(ctx, tx, &sessions, query, hb.PlayerID, hb.ID); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, models.ErrNotFound
+	}
+
+	return sessions[0], nil
+}
+
+// expirePlaySessions ends the open sessions at their last heartbeat when it
+// is older than the timeout, and forgets the heartbeat IDs past retention.
+func expirePlaySessions(ctx context.Context, tx *sqlx.Tx, now time.Time, timeout time.Duration) (int, error) {
+	query := playSessionSelect + `
+	WHERE s.ended_at IS NULL AND s.last_heartbeat_at < $1
+	ORDER BY s.id
+	FOR UPDATE OF s, m SKIP LOCKED`
+
+	sessions := make([]*models.PlaySession, 0)
+	if err := findMany(ctx, tx, &sessions, query, now.Add(-timeout)); err != nil {
+		return 0, err
+	}
+
+	for _, session := range sessions {
+		if err := closePlaySession(ctx, tx, session, session.LastHeartbeatAt); err != nil {
+			return 0, err
+		}
+	}
+
+	query = "DELETE FROM play_heartbeats WHERE received_at < $1"
+	if err := execQuery(ctx, tx, query, now.Add(-models.HeartbeatRetention)); err != nil {
+		return 0, err
+	}
+
+	return len(sessions), nil
+}
+
+const playSessionSelect = `
+	SELECT s.*, m.player_id, m.played_game_id, g.slug AS game_slug
+	FROM play_sessions s
+	JOIN metadata m ON m.id = s.metadata_id
+	JOIN games g ON g.id = m.played_game_id`
+
+func findPlaySessions(ctx context.Context, tx *sqlx.Tx, filter models.PlaySessionFilter) ([]*models.PlaySession, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("s.id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.MetadataID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("s.metadata_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.PlayerID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("m.player_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.GameID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("m.played_game_id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Source; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("s.source = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Open; v != nil {
+		if *v {
+			where = append(where, "s.ended_at IS NULL")
+		} else {
+			where = append(where, "s.ended_at IS NOT NULL")
+		}
+	}
+
+	query := playSessionSelect + formatWhereClause(where) +
+		" ORDER BY s.started_at DESC, s.id DESC" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	sessions := make([]*models.PlaySession, 0)
+	if err := findMany(ctx, tx, &sessions, query, args...); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
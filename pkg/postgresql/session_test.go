@@ -0,0 +1,48 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUncoveredTime(t *testing.T) {
+	base := time.Date(2022, 3, 10, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		spans    []playSpan
+		want     time.Duration
+	}{
+		{"no spans", at(0), at(30), nil, 30 * time.Minute},
+		{"disjoint", at(0), at(30), []playSpan{{at(40), at(50)}, {at(-20), at(0)}}, 30 * time.Minute},
+		{"covered", at(0), at(30), []playSpan{{at(-10), at(40)}}, 0},
+		{"start covered", at(0), at(30), []playSpan{{at(-10), at(10)}}, 20 * time.Minute},
+		{"end covered", at(0), at(30), []playSpan{{at(25), at(35)}}, 25 * time.Minute},
+		{"overlapping spans", at(0), at(30), []playSpan{{at(5), at(15)}, {at(10), at(20)}}, 15 * time.Minute},
+		{"nested spans", at(0), at(30), []playSpan{{at(5), at(25)}, {at(10), at(15)}}, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uncoveredTime(tt.from, tt.to, tt.spans); got != tt.want {
+				t.Errorf("uncoveredTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ models.SimulatorService = (*SimulatorService)(nil)
+
+type SimulatorService struct {
+	db *DB
+}
+
+func NewSimulatorService(db *DB) *SimulatorService {
+	return &SimulatorService{db}
+}
+
+func (ss *SimulatorService) SimulatorControls(ctx context.Context) (*models.SimulatorControls, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	controls, err := findSimulatorControls(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return controls, tx.Commit()
+}
+
+func (ss *SimulatorService) SaveSimulatorControls(ctx context.Context, controls *models.SimulatorControls) error {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := saveSimulatorControls(ctx, tx, controls); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SimulatorService) TraceReplay(ctx context.Context, path, hash string, events int) (*models.TraceReplay, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	tr, err := findOrCreateTraceReplay(ctx, tx, path, hash, events)
+	if err != nil {
+		return nil, err
+	}
+
+	return tr, tx.Commit()
+}
+
+func (ss *SimulatorService) ApplyTraceReplay(ctx context.Context, tr *models.TraceReplay, offset int, increments []models.PlayTimeIncrement) (int, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	// moving the replay first locks its row until the increments are committed
+	query := `
+	UPDATE trace_replays
+	SET applied_offset = $1, completed_at = CASE WHEN $1 >= events THEN NOW() END, updated_at = NOW()
+	WHERE path = $2 AND hash = $3 AND applied_offset = $4
+	RETURNING completed_at, updated_at`
+
+	var completedAt sql.NullTime
+	var updatedAt time.Time
+	if err := tx.QueryRowxContext(ctx, query, offset, tr.Path, tr.Hash, tr.Offset).Scan(&completedAt, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrTraceReplayConflict
+		}
+		return 0, err
+	}
+
+	n, err := incrementPlayTimes(ctx, tx, increments)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	tr.Offset, tr.UpdatedAt = offset, updatedAt
+	if completedAt.Valid {
+		tr.CompletedAt = &completedAt.Time
+	}
+	return n, nil
+}
+
+func findSimulatorControls(ctx context.Context, tx *sqlx.Tx) (*models.SimulatorControls, error) {
+	query := `
+	SELECT paused, frequency, span, profile, seed, popularity, churn_rate, updated_at
+	FROM simulator_controls`
+
+	var (
+		controls        models.SimulatorControls
+		frequency, span sql.NullInt64
+		profile         sql.NullString
+		seed            sql.NullInt64
+		popularity      []byte
+		churnRate       sql.NullFloat64
+	)
+	err := tx.QueryRowxContext(ctx, query).Scan(&controls.Paused, &frequency, &span, &profile, &seed, &popularity, &churnRate, &controls.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if frequency.Valid {
+		d := time.Duration(frequency.Int64)
+		controls.Frequency = &d
+	}
+	if span.Valid {
+		d := time.Duration(span.Int64)
+		controls.Span = &d
+	}
+	if profile.Valid {
+		controls.Profile = &profile.String
+	}
+	if seed.Valid {
+		controls.Seed = &seed.Int64
+	}
+	if popularity != nil {
+		if err := json.Unmarshal(popularity, &controls.Popularity); err != nil {
+			return nil, err
+		}
+	}
+	if churnRate.Valid {
+		controls.ChurnRate = &churnRate.Float64
+	}
+
+	return &controls, nil
+}
+
+func saveSimulatorControls(ctx context.Context, tx *sqlx.Tx, controls *models.SimulatorControls) error {
+	var popularity *string // pq would send a []byte as bytea
+	if controls.Popularity != nil {
+		b, err := json.Marshal(controls.Popularity)
+		if err != nil {
+			return err
+		}
+		v := string(b)
+		popularity = &v
+	}
+
+	query := `
+	INSERT INTO simulator_controls (paused, frequency, span, profile, seed, popularity, churn_rate)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO UPDATE
+	SET paused = EXCLUDED.paused, frequency = EXCLUDED.frequency, span = EXCLUDED.span,
+		profile = EXCLUDED.profile, seed = EXCLUDED.seed, popularity = EXCLUDED.popularity,
+		churn_rate = EXCLUDED.churn_rate, updated_at = NOW()
+	RETURNING updated_at`
+
+	args := []interface{}{
+		controls.Paused,
+		nullDuration(controls.Frequency),
+		nullDuration(controls.Span),
+		controls.Profile,
+		controls.Seed,
+		popularity,
+		controls.ChurnRate,
+	}
+
+	return tx.QueryRowxContext(ctx, query, args...).Scan(&controls.UpdatedAt)
+}
+
+func findOrCreateTraceReplay(ctx context.Context, tx *sqlx.Tx, path, hash string, events int) (*models.TraceReplay, error) {
+	query := `
+	INSERT INTO trace_replays (path, hash, events)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (path, hash) DO NOTHING`
+
+	if err := execQuery(ctx, tx, query, path, hash, events); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT path, hash, events, applied_offset, completed_at, created_at, updated_at
+	FROM trace_replays WHERE path = $1 AND hash = $2`
+
+	tr := &models.TraceReplay{}
+	if err := tx.QueryRowxContext(ctx, query, path, hash).Scan(&tr.Path, &tr.Hash, &tr.Events, &tr.Offset, &tr.CompletedAt, &tr.CreatedAt, &tr.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+func nullDuration(d *time.Duration) *int64 {
+	if d == nil {
+		return nil
+	}
+	ns := int64(*d)
+	return &ns
+}
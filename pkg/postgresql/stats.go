@@ -0,0 +1,332 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var _ models.StatsService = (*StatsService)(nil)
+
+type StatsService struct {
+	db *DB
+}
+
+func NewStatsService(db *DB) *StatsService {
+	return &StatsService{db}
+}
+
+func (ss *StatsService) GameStats(ctx context.Context, filter models.StatsFilter) ([]*models.GameStats, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	stats, err := findGameStats(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+func (ss *StatsService) PublisherStats(ctx context.Context, filter models.StatsFilter) ([]*models.PublisherStats, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	stats, err := findPublisherStats(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+func (ss *StatsService) PlayerStats(ctx context.Context, playerID uint) (*models.PlayerStats, error) {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	stats, err := findPlayerStats(ctx, tx, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, tx.Commit()
+}
+
+// statsGames returns a query selecting the games of the filter, to be used as
+// a CTE, with its arguments.
+func statsGames(filter models.StatsFilter) (string, []interface{}) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
+
+	if v := filter.Publisher; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("p.key = $%d", argPosition)), append(args, models.PublisherKey(*v))
+	}
+
+	if v := filter.AgeRating; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("g.age_rating = $%d", argPosition)), append(args, *v)
+	}
+
+	return `SELECT g.id, g.slug, g.title, COALESCE(p.name, '') AS publisher
+	FROM games g
+	LEFT JOIN publishers p ON p.id = g.publisher_id` + formatWhereClause(where), args
+}
+
+func findGameStats(ctx context.Context, tx *sqlx.Tx, filter models.StatsFilter) ([]*models.GameStats, error) {
+	games, args := statsGames(filter)
+
+	// a link is one player of the game, so the per player figures are per link
+	query := `
+	WITH filtered AS (` + games + `)
+	SELECT g.id, g.slug, g.title, g.publisher,
+		COUNT(m.id) AS players,
+		COALESCE(SUM(m.play_time), 0) AS total_play_time,
+		COALESCE(AVG(m.play_time), 0) AS average_play_time,
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY m.play_time), 0) AS median_play_time
+	FROM filtered g
+	LEFT JOIN metadata m ON m.played_game_id = g.id
+	GROUP BY g.id, g.slug, g.title, g.publisher
+	ORDER BY total_play_time DESC, g.title`
+
+	stats := []*models.GameStats{}
+	if err := tx.SelectContext(ctx, &stats, query, args...); err != nil {
+		return nil, err
+	}
+
+	weeks, since := statsWeeks(filter)
+	query = `
+	WITH filtered AS (` + games + `)
+	SELECT g.id::text AS key, date_trunc('week', m.created_at AT TIME ZONE 'UTC') AS week, COUNT(*) AS links
+	FROM filtered g
+	JOIN metadata m ON m.played_game_id = g.id
+	WHERE m.created_at >= ` + fmt.Sprintf("$%d", len(args)+1) + `
+	GROUP BY 1, 2`
+
+	links, err := findWeeklyLinks(ctx, tx, query, append(args, since)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stats {
+		s.NewLinksPerWeek = fillWeeks(links[fmt.Sprint(s.ID)], since, weeks)
+	}
+
+	return stats, nil
+}
+
+func findPublisherStats(ctx context.Context, tx *sqlx.Tx, filter models.StatsFilter) ([]*models.PublisherStats, error) {
+	games, args := statsGames(filter)
+
+	// a player of several games of a publisher counts once, with their play
+	// time summed over these games
+	query := `
+	WITH filtered AS (` + games + `),
+	per_player AS (
+		SELECT g.publisher, m.player_id, SUM(m.play_time) AS play_time
+		FROM filtered g
+		JOIN metadata m ON m.played_game_id = g.id
+		GROUP BY g.publisher, m.player_id
+	),
+	per_publisher AS (
+		SELECT publisher,
+			COUNT(*) AS players,
+			SUM(play_time) AS total_play_time,
+			AVG(play_time) AS average_play_time,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY play_time) AS median_play_time
+		FROM per_player
+		GROUP BY publisher
+	)
+	SELECT g.publisher, COUNT(*) AS games,
+		COALESCE(MAX(p.players), 0) AS players,
+		COALESCE(MAX(p.total_play_time), 0) AS total_play_time,
+		COALESCE(MAX(p.average_play_time), 0) AS average_play_time,
+		COALESCE(MAX(p.median_play_time), 0) AS median_play_time
+	FROM filtered g
+	LEFT JOIN per_publisher p ON p.publisher = g.publisher
+	GROUP BY g.publisher
+	ORDER BY total_play_time DESC, g.publisher`
+
+	stats := []*models.PublisherStats{}
+	if err := tx.SelectContext(ctx, &stats, query, args...); err != nil {
+		return nil, err
+	}
+
+	weeks, since := statsWeeks(filter)
+	query = `
+	WITH filtered AS (` + games + `)
+	SELECT g.publisher AS key, date_trunc('week', m.created_at AT TIME ZONE 'UTC') AS week, COUNT(*) AS links
+	FROM filtered g
+	JOIN metadata m ON m.played_game_id = g.id
+	WHERE m.created_at >= ` + fmt.Sprintf("$%d", len(args)+1) + `
+	GROUP BY 1, 2`
+
+	links, err := findWeeklyLinks(ctx, tx, query, append(args, since)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stats {
+		s.NewLinksPerWeek = fillWeeks(links[s.Publisher], since, weeks)
+	}
+
+	return stats, nil
+}
+
+func findPlayerStats(ctx context.Context, tx *sqlx.Tx, playerID uint) (*models.PlayerStats, error) {
+	// a session still open was last seen at its last heartbeat
+	query := `
+	SELECT g.slug, g.title, COALESCE(p.name, '') AS publisher, m.play_time,
+		(SELECT MAX(COALESCE(ps.ended_at, ps.last_heartbeat_at)) FROM play_sessions ps WHERE ps.metadata_id = m.id) AS last_played_at
+	FROM metadata m
+	JOIN games g ON g.id = m.played_game_id
+	LEFT JOIN publishers p ON p.id = g.publisher_id
+	WHERE m.player_id = $1
+	ORDER BY m.play_time DESC, last_played_at DESC NULLS LAST, g.title`
+
+	games := []*models.PlayerGameStats{}
+	if err := tx.SelectContext(ctx, &games, query, playerID); err != nil {
+		return nil, err
+	}
+
+	return playerStats(games), nil
+}
+
+// playerStats aggregates the games of a player, sorted by play time, per
+// publisher and overall.
+func playerStats(games []*models.PlayerGameStats) *models.PlayerStats {
+	stats := &models.PlayerStats{
+		GamesCount: uint(len(games)),
+		Games:      games,
+		Publishers: []*models.PlayerPublisherStats{},
+	}
+
+	publishers := map[string]*models.PlayerPublisherStats{}
+	for _, g := range games {
+		stats.TotalPlayTime += g.PlayTime
+
+		p, ok := publishers[g.Publisher]
+		if !ok {
+			p = &models.PlayerPublisherStats{Publisher: g.Publisher}
+			publishers[g.Publisher] = p
+			stats.Publishers = append(stats.Publishers, p)
+		}
+		p.Games++
+		p.PlayTime += g.PlayTime
+
+		if g.LastPlayedAt != nil && (stats.LastActivity == nil || g.LastPlayedAt.After(stats.LastActivity.At)) {
+			stats.LastActivity = &models.PlayerActivity{Game: g.Slug, Title: g.Title, At: *g.LastPlayedAt}
+		}
+	}
+
+	// games come sorted by play time, the first one is the favourite unless
+	// the player never played
+	if len(games) > 0 && games[0].PlayTime > 0 {
+		stats.FavouriteGame = games[0]
+	}
+
+	sort.SliceStable(stats.Publishers, func(i, j int) bool {
+		return stats.Publishers[i].PlayTime > stats.Publishers[j].PlayTime
+	})
+
+	if stats.TotalPlayTime > 0 {
+		for _, g := range games {
+			g.Share = share(g.PlayTime, stats.TotalPlayTime)
+		}
+		for _, p := range stats.Publishers {
+			p.Share = share(p.PlayTime, stats.TotalPlayTime)
+		}
+	}
+
+	return stats
+}
+
+// share returns the percentage of total that part is, rounded to a tenth.
+func share(part, total uint) float64 {
+	return math.Round(float64(part)*1000/float64(total)) / 10
+}
+
+// statsWeeks returns the number of weeks of new links and the Monday (UTC)
+// the first of them starts on.
+func statsWeeks(filter models.StatsFilter) (int, time.Time) {
+	weeks := filter.Weeks
+	if weeks <= 0 {
+		weeks = models.DefaultStatsWeeks
+	}
+
+	now := time.Now().UTC()
+	monday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monday = monday.AddDate(0, 0, -(int(monday.Weekday())+6)%7)
+
+	return weeks, monday.AddDate(0, 0, -7*(weeks-1))
+}
+
+// findWeeklyLinks runs a query selecting (key, week, links) rows and indexes
+// the counts by key and week.
+func findWeeklyLinks(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) (map[string]map[time.Time]uint, error) {
+	type row struct {
+		Key   string    `db:"key"`
+		Week  time.Time `db:"week"`
+		Links uint      `db:"links"`
+	}
+
+	rows := []row{}
+	if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	links := map[string]map[time.Time]uint{}
+	for _, r := range rows {
+		if links[r.Key] == nil {
+			links[r.Key] = map[time.Time]uint{}
+		}
+		week := r.Week.UTC()
+		links[r.Key][time.Date(week.Year(), week.Month(), week.Day(), 0, 0, 0, 0, time.UTC)] = r.Links
+	}
+
+	return links, nil
+}
+
+// fillWeeks lists the weeks from since on, the weeks without link included.
+func fillWeeks(links map[time.Time]uint, since time.Time, weeks int) []models.WeeklyLinks {
+	filled := make([]models.WeeklyLinks, 0, weeks)
+	for i := 0; i < weeks; i++ {
+		week := since.AddDate(0, 0, 7*i)
+		filled = append(filled, models.WeeklyLinks{Week: week, Links: links[week]})
+	}
+	return filled
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+func TestStatsWeeks(t *testing.T) {
+	tests := []struct {
+		name  string
+		weeks int
+		want  int
+	}{
+		{"default", 0, models.DefaultStatsWeeks},
+		{"negative", -3, models.DefaultStatsWeeks},
+		{"current week only", 1, 1},
+		{"a quarter", 13, 13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UTC()
+			weeks, since := statsWeeks(models.StatsFilter{Weeks: tt.weeks})
+			if weeks != tt.want {
+				t.Errorf("weeks = %d, want %d", weeks, tt.want)
+			}
+			if since.Weekday() != time.Monday || since.Location() != time.UTC || !since.Equal(since.Truncate(24*time.Hour)) {
+				t.Errorf("since = %s, want a Monday at midnight UTC", since)
+			}
+			// the last week is the current one
+			if end := since.AddDate(0, 0, 7*weeks); !since.AddDate(0, 0, 7*(weeks-1)).Before(now) || !end.After(now) {
+				t.Errorf("weeks from %s do not end with the current one", since)
+			}
+		})
+	}
+}
+
+func TestFillWeeks(t *testing.T) {
+	since := time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC)
+	week := func(i int) time.Time { return since.AddDate(0, 0, 7*i) }
+
+	tests := []struct {
+		name  string
+		links map[time.Time]uint
+		weeks int
+		want  []models.WeeklyLinks
+	}{
+		{"no links", nil, 2, []models.WeeklyLinks{{Week: week(0)}, {Week: week(1)}}},
+		{"gaps are zero", map[time.Time]uint{week(0): 4, week(2): 1}, 3, []models.WeeklyLinks{{Week: week(0), Links: 4}, {Week: week(1)}, {Week: week(2), Links: 1}}},
+		{"weeks out of range", map[time.Time]uint{week(-1): 9, week(1): 2}, 2, []models.WeeklyLinks{{Week: week(0)}, {Week: week(1), Links: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fillWeeks(tt.links, since, tt.weeks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fillWeeks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayerStats(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2022, 3, 16, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		games      []*models.PlayerGameStats
+		total      uint
+		favourite  string
+		last       string
+		publishers []models.PlayerPublisherStats
+		shares     []float64
+	}{
+		{
+			name:       "no game",
+			publishers: []models.PlayerPublisherStats{},
+		},
+		{
+			name: "never played",
+			games: []*models.PlayerGameStats{
+				{Slug: "chess", Publisher: "Acme"},
+			},
+			publishers: []models.PlayerPublisherStats{{Publisher: "Acme", Games: 1}},
+			shares:     []float64{0},
+		},
+		{
+			name: "publishers by play time",
+			games: []*models.PlayerGameStats{
+				{Slug: "kart", Publisher: "Zeta", PlayTime: 120, LastPlayedAt: at(9)},
+				{Slug: "go", Publisher: "Acme", PlayTime: 90},
+				{Slug: "chess", Publisher: "Acme", PlayTime: 60, LastPlayedAt: at(11)},
+				{Slug: "tetris", Publisher: "", PlayTime: 30, LastPlayedAt: at(10)},
+			},
+			total:     300,
+			favourite: "kart",
+			last:      "chess",
+			publishers: []models.PlayerPublisherStats{
+				{Publisher: "Acme", Games: 2, PlayTime: 150, Share: 50},
+				{Publisher: "Zeta", Games: 1, PlayTime: 120, Share: 40},
+				{Publisher: "", Games: 1, PlayTime: 30, Share: 10},
+			},
+			shares: []float64{40, 30, 20, 10},
+		},
+		{
+			name: "shares rounded to a tenth",
+			games: []*models.PlayerGameStats{
+				{Slug: "kart", Publisher: "Zeta", PlayTime: 2},
+				{Slug: "chess", Publisher: "Zeta", PlayTime: 1},
+			},
+			total:      3,
+			favourite:  "kart",
+			publishers: []models.PlayerPublisherStats{{Publisher: "Zeta", Games: 2, PlayTime: 3, Share: 100}},
+			shares:     []float64{66.7, 33.3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := playerStats(tt.games)
+			if stats.TotalPlayTime != tt.total || stats.GamesCount != uint(len(tt.games)) {
+				t.Errorf("total = %d over %d games, want %d over %d", stats.TotalPlayTime, stats.GamesCount, tt.total, len(tt.games))
+			}
+
+			favourite := ""
+			if stats.FavouriteGame != nil {
+				favourite = stats.FavouriteGame.Slug
+			}
+			if favourite != tt.favourite {
+				t.Errorf("favourite game = %q, want %q", favourite, tt.favourite)
+			}
+
+			last := ""
+			if stats.LastActivity != nil {
+				last = stats.LastActivity.Game
+			}
+			if last != tt.last {
+				t.Errorf("last activity = %q, want %q", last, tt.last)
+			}
+
+			publishers := []models.PlayerPublisherStats{}
+			for _, p := range stats.Publishers {
+				publishers = append(publishers, *p)
+			}
+			if !reflect.DeepEqual(publishers, tt.publishers) {
+				t.Errorf("publishers = %+v, want %+v", publishers, tt.publishers)
+			}
+
+			for i, g := range stats.Games {
+				if g.Share != tt.shares[i] {
+					t.Errorf("share of %s = %g, want %g", g.Slug, g.Share, tt.shares[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStatsGames(t *testing.T) {
+	publisher := func(v string) *string { return &v }
+	rating := func(v uint) *uint { return &v }
+
+	tests := []struct {
+		name   string
+		filter models.StatsFilter
+		where  string
+		args   []interface{}
+	}{
+		{"all games", models.StatsFilter{}, "", []interface{}{}},
+		{"publisher in any spelling", models.StatsFilter{Publisher: publisher("Riot-Games")}, " WHERE p.key = $1", []interface{}{"riotgames"}},
+		{"publisher and age rating", models.StatsFilter{Publisher: publisher("riot games"), AgeRating: rating(12)}, " WHERE p.key = $1 AND g.age_rating = $2", []interface{}{"riotgames", uint(12)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := statsGames(tt.filter)
+			if !strings.HasSuffix(query, "LEFT JOIN publishers p ON p.id = g.publisher_id"+tt.where) {
+				t.Errorf("query does not filter with %q:\n%s", tt.where, query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresql
+
+import (
+	"anbox_mgmt/pkg/models"
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ models.TagService = (*TagService)(nil)
+
+type TagService struct {
+	db *DB
+}
+
+func NewTagService(db *DB) *TagService {
+	return &TagService{db}
+}
+
+func (ts *TagService) CreateTag(ctx context.Context, tag *models.Tag) error {
+	tx, err := ts.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := createTag(ctx, tx, tag); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ts *TagService) Tags(ctx context.Context, filter models.TagFilter) ([]*models.Tag, error) {
+	tx, err := ts.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	tags, err := findTags(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, tx.Commit()
+}
+
+func (ts *TagService) UpdateTag(ctx context.Context, tag *models.Tag, patch models.TagPatch) error {
+	tx, err := ts.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := updateTag(ctx, tx, tag, patch); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ts *TagService) DeleteTag(ctx context.Context, id uint) error {
+	tx, err := ts.db.BeginTxx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := execQuery(ctx, tx, "DELETE FROM tags WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func createTag(ctx context.Context, tx *sqlx.Tx, tag *models.Tag) error {
+	query := `
+	INSERT INTO tags (name)
+	VALUES ($1) RETURNING id, created_at, updated_at`
+
+	err := tx.QueryRowxContext(ctx, query, tag.Name).Scan(&tag.ID, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "tags_name_key"` {
+			return models.ErrDuplicateTag
+		}
+		return err
+	}
+
+	return nil
+}
+
+func findTags(ctx context.Context, tx *sqlx.Tx, filter models.TagFilter) ([]*models.Tag, error) {
+	where, args := []string{}, []interface{}{}
+	argPosition := 0 // used to set correct postgres argument enums i.e $1, $2
+
+	if v := filter.ID; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("id = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Name; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("name = $%d", argPosition)), append(args, *v)
+	}
+
+	if v := filter.Search; v != nil {
+		argPosition++
+		where, args = append(where, fmt.Sprintf("name LIKE $%d", argPosition)), append(args, *v+"%")
+	}
+
+	query := `
+	SELECT *, (SELECT COUNT(*) FROM game_tags gt WHERE gt.tag_id = tags.id) AS games_count
+	FROM tags` + formatWhereClause(where) +
+		" ORDER BY name" + formatLimitOffset(filter.Limit, filter.Offset)
+
+	tags := []*models.Tag{}
+	if err := findMany(ctx, tx, &tags, query, args...); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func updateTag(ctx context.Context, tx *sqlx.Tx, tag *models.Tag, patch models.TagPatch) error {
+	if v := patch.Name; v != nil {
+		tag.Name = *v
+	}
+
+	query := `
+	UPDATE tags
+	SET name = $1, updated_at = NOW() WHERE id = $2
+	RETURNING updated_at`
+
+	if err := tx.QueryRowxContext(ctx, query, tag.Name, tag.ID).Scan(&tag.UpdatedAt); err != nil {
+		if err.Error() == `pq: duplicate key value violates unique constraint "tags_name_key"` {
+			return models.ErrDuplicateTag
+		}
+		return err
+	}
+
+	return nil
+}
+
+// attachGameTags loads the tags of all the games in one query.
+func attachGameTags(ctx context.Context, tx *sqlx.Tx, games []*models.Game) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(games))
+	byID := make(map[uint]*models.Game, len(games))
+	for _, g := range games {
+		ids = append(ids, int64(g.ID))
+		byID[g.ID] = g
+		g.Tags = []string{}
+	}
+
+	rows := []struct {
+		GameID uint   `db:"game_id"`
+		Name   string `db:"name"`
+	}{}
+	query := `
+	SELECT gt.game_id, t.name
+	FROM game_tags gt
+	JOIN tags t ON t.id = gt.tag_id
+	WHERE gt.game_id = ANY($1)
+	ORDER BY t.name`
+	if err := tx.SelectContext(ctx, &rows, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		g := byID[r.GameID]
+		g.Tags = append(g.Tags, r.Name)
+	}
+
+	return nil
+}
+
+// replaceGameTags tags the game with its tags only, creating the ones that
+// do not exist yet.
+func replaceGameTags(ctx context.Context, tx *sqlx.Tx, game *models.Game) error {
+	if game.Tags == nil {
+		game.Tags = []string{}
+	}
+
+	if err := execQuery(ctx, tx, "DELETE FROM game_tags WHERE game_id = $1", game.ID); err != nil {
+		return err
+	}
+
+	if len(game.Tags) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO tags (name)
+	SELECT unnest($1::text[])
+	ON CONFLICT (name) DO NOTHING`
+	if err := execQuery(ctx, tx, query, pq.Array(game.Tags)); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO game_tags (game_id, tag_id)
+	SELECT $1, id FROM tags WHERE name = ANY($2)`
+	return execQuery(ctx, tx, query, game.ID, pq.Array(game.Tags))
+}
@@ -193,10 +193,13 @@ func deleteUser(ctx context.Context, tx *sqlx.Tx, id uint) error {
 
 func createUser(ctx context.Context, tx *sqlx.Tx, user *models.User) error {
 	query := `
-	INSERT INTO users (email, username, age, password_hash)
-	VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+	INSERT INTO users (email, username, birthdate, timezone, region, password_hash)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at
 	`
-	args := []interface{}{user.Email, user.Username, user.Age, user.PasswordHash}
+	if user.Timezone == "" {
+		user.Timezone = models.DefaultTimezone
+	}
+	args := []interface{}{user.Email, user.Username, user.Birthdate, user.Timezone, user.Region, user.PasswordHash}
 	err := tx.QueryRowxContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -210,6 +213,8 @@ func createUser(ctx context.Context, tx *sqlx.Tx, user *models.User) error {
 		}
 	}
 
+	user.RefreshAge()
+
 	return nil
 }
 
@@ -249,8 +254,9 @@ func findUsers(ctx context.Context, tx *sqlx.Tx, filter models.UserFilter) ([]*m
 	}
 
 	if v := filter.Age; v != nil {
+		// age is derived from the birthdate, as of today in the user's time zone
 		argPosition++
-		where, args = append(where, fmt.Sprintf("age = $%d", argPosition)), append(args, *v)
+		where, args = append(where, fmt.Sprintf("EXTRACT(YEAR FROM age((NOW() AT TIME ZONE timezone)::date, birthdate)) = $%d", argPosition)), append(args, *v)
 	}
 
 	query := "SELECT * from users" + formatWhereClause(where) +
@@ -278,22 +284,32 @@ func updateUser(ctx context.Context, tx *sqlx.Tx, user *models.User, patch model
 		user.Username = *v
 	}
 
-	if v := patch.Age; v != nil {
-		user.Age = *v
+	if v := patch.Birthdate; v != nil {
+		user.Birthdate = *v
+	}
+
+	if v := patch.Timezone; v != nil {
+		user.Timezone = *v
+	}
+
+	if v := patch.Region; v != nil {
+		user.Region = *v
 	}
 
 	args := []interface{}{
 		user.Username,
 		user.Email,
-		user.Age,
+		user.Birthdate,
+		user.Timezone,
+		user.Region,
 		user.PasswordHash,
 		user.ID,
 	}
 
 	query := `
 	UPDATE users 
-	SET username = $1, email = $2, age = $3, password_hash = $4, updated_at = NOW()
-	WHERE id = $5
+	SET username = $1, email = $2, birthdate = $3, timezone = $4, region = $5, password_hash = $6, updated_at = NOW()
+	WHERE id = $7
 	RETURNING updated_at`
 
 	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&user.UpdatedAt); err != nil {
@@ -301,6 +317,8 @@ func updateUser(ctx context.Context, tx *sqlx.Tx, user *models.User, patch model
 		return models.ErrInternal
 	}
 
+	user.RefreshAge()
+
 	return nil
 }
 
@@ -311,5 +329,9 @@ func queryUsers(ctx context.Context, tx *sqlx.Tx, query string, args ...interfac
 		return users, err
 	}
 
+	for _, u := range users {
+		u.RefreshAge()
+	}
+
 	return users, nil
 }
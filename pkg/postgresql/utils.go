@@ -26,11 +26,11 @@ import (
 
 func formatLimitOffset(limit, offset int) string {
 	if limit > 0 && offset > 0 {
-		return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
 	} else if limit > 0 {
-		return fmt.Sprintf("LIMIT %d", limit)
+		return fmt.Sprintf(" LIMIT %d", limit)
 	} else if offset > 0 {
-		return fmt.Sprintf("OFFSET %d", offset)
+		return fmt.Sprintf(" OFFSET %d", offset)
 	}
 	return ""
 }
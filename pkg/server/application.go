@@ -0,0 +1,471 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"anbox_mgmt/pkg/apk"
+	"anbox_mgmt/pkg/blob"
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxAPKBytes    = 1 << 30
+	apkTransfer    = 30 * time.Minute // instead of the server timeouts
+	maxAPKMemory   = 32 << 20         // larger uploads are spooled to a temporary file
+	maxPermissions = 200
+	apkContentType = "application/vnd.android.package-archive"
+	apkUploadField = "apk"
+)
+
+func (s *Server) getApplication() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, app, ok := s.applicationFromSlug(w, r, false)
+		if !ok {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"application": app})
+	}
+}
+
+// createApplication gives the game its Android application, for the ones
+// managing the games of its publisher.
+func (s *Server) createApplication() http.HandlerFunc {
+	type Input struct {
+		Application struct {
+			PackageName string `json:"packageName" validate:"required"`
+		} `json:"application"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Application); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		packageName := strings.TrimSpace(input.Application.PackageName)
+		if !models.ValidPackageName(packageName) {
+			validationError(w, ErrorM{"packageName": []string{fmt.Sprintf("%q is not an Android package name, e.g. com.example.game", packageName)}})
+			return
+		}
+
+		game, ok := s.gameFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		app := models.Application{GameID: game.ID, PackageName: packageName}
+		if err := s.applicationService.CreateApplication(r.Context(), &app); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateApplication):
+				errorResponse(w, http.StatusConflict, ErrorM{"application": []string{"the game already has an application"}})
+			case errors.Is(err, models.ErrDuplicatePackageName):
+				errorResponse(w, http.StatusConflict, ErrorM{"packageName": []string{"this package name is used by another game"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"application": app})
+	}
+}
+
+func (s *Server) listApplicationVersions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, app, ok := s.applicationFromSlug(w, r, false)
+		if !ok {
+			return
+		}
+
+		versions, err := s.applicationService.ApplicationVersions(r.Context(), app)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"versions": versions, "versionsCount": len(versions)})
+	}
+}
+
+// createApplicationVersion records a version of the application of the game.
+// The first version becomes the active one, later ones have to be promoted.
+func (s *Server) createApplicationVersion() http.HandlerFunc {
+	type Input struct {
+		Version struct {
+			VersionCode uint     `json:"versionCode" validate:"required"`
+			VersionName string   `json:"versionName"`
+			MinSDK      uint     `json:"minSdk" validate:"required"`
+			TargetSDK   uint     `json:"targetSdk"`
+			ABIs        []string `json:"abis" validate:"required,min=1"`
+			Permissions []string `json:"permissions"`
+		} `json:"version"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Version); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		abis, err := normalizeABIs(input.Version.ABIs)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		permissions, err := normalizePermissions(input.Version.Permissions)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		_, app, ok := s.applicationFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		version := models.ApplicationVersion{
+			VersionCode: input.Version.VersionCode,
+			VersionName: strings.TrimSpace(input.Version.VersionName),
+			MinSDK:      input.Version.MinSDK,
+			TargetSDK:   input.Version.TargetSDK,
+			ABIs:        abis,
+			Permissions: permissions,
+		}
+		if err := s.applicationService.CreateApplicationVersion(r.Context(), app, &version); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateVersion):
+				duplicateVersionError(w, version.VersionCode)
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"version": version})
+	}
+}
+
+// uploadApplicationVersion adds a version from an APK uploaded as the `apk`
+// field of a multipart form, its metadata read from the manifest. The APK
+// must be the application of the game, i.e have its package name.
+func (s *Server) uploadApplicationVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		_, app, ok := s.applicationFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		extendDeadlines(r, apkTransfer)
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPKBytes)
+		if err := r.ParseMultipartForm(maxAPKMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				errorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("an APK is at most %d MB", maxAPKBytes>>20))
+				return
+			}
+			badRequestError(w)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile(apkUploadField)
+		if err != nil {
+			validationError(w, ErrorM{apkUploadField: []string{"an APK file is required"}})
+			return
+		}
+		defer file.Close()
+
+		manifest, err := apk.Parse(file, header.Size)
+		if err != nil {
+			validationError(w, ErrorM{apkUploadField: []string{err.Error()}})
+			return
+		}
+
+		if manifest.Package != app.PackageName {
+			validationError(w, ErrorM{apkUploadField: []string{fmt.Sprintf("the APK is %s, not %s, the application of the game", manifest.Package, app.PackageName)}})
+			return
+		}
+		if manifest.VersionCode == 0 {
+			validationError(w, ErrorM{apkUploadField: []string{"the APK has no version code"}})
+			return
+		}
+
+		// an APK without native code runs on every ABI
+		abis := models.ABIs
+		if len(manifest.ABIs) > 0 {
+			abis = knownABIs(manifest.ABIs)
+			if len(abis) == 0 {
+				validationError(w, ErrorM{apkUploadField: []string{fmt.Sprintf("the APK is built for %s, none of %s", strings.Join(manifest.ABIs, ", "), strings.Join(models.ABIs, ", "))}})
+				return
+			}
+		}
+
+		permissions, err := normalizePermissions(manifest.Permissions)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		versionCode := uint(manifest.VersionCode)
+		if _, err := s.applicationService.ApplicationVersion(ctx, app, versionCode); err == nil {
+			duplicateVersionError(w, versionCode)
+			return
+		} else if !errors.Is(err, models.ErrNotFound) {
+			serverError(w, err)
+			return
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(file, 0, header.Size)); err != nil {
+			serverError(w, err)
+			return
+		}
+		sum := hex.EncodeToString(hash.Sum(nil))
+
+		// the same version code and content always get the same key
+		key := fmt.Sprintf("apks/%s/%d-%s.apk", app.PackageName, versionCode, sum[:16])
+		size, err := s.blobStore.Put(ctx, key, io.NewSectionReader(file, 0, header.Size))
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		version := models.ApplicationVersion{
+			VersionCode: versionCode,
+			VersionName: manifest.VersionName,
+			MinSDK:      uint(manifest.MinSDK),
+			TargetSDK:   uint(manifest.TargetSDK),
+			ABIs:        abis,
+			Permissions: permissions,
+			APKKey:      key,
+			APKSize:     size,
+			APKSHA256:   sum,
+		}
+		if err := s.applicationService.CreateApplicationVersion(ctx, app, &version); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateVersion):
+				// raced with another upload of the version, whose APK may
+				// have the same key: the blob is kept
+				duplicateVersionError(w, versionCode)
+			default:
+				if err := s.blobStore.Delete(ctx, key); err != nil {
+					log.Printf("cannot delete blob %s: %v", key, err)
+				}
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"version": version})
+	}
+}
+
+// downloadApplicationVersion serves the uploaded APK of a version, for the
+// ones managing the games of its publisher.
+func (s *Server) downloadApplicationVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		code, ok := versionCodeFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		_, app, ok := s.applicationFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		version, err := s.applicationService.ApplicationVersion(ctx, app, code)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				notFoundError(w, ErrorM{"version": []string{"requested version not found"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+		if !version.HasAPK() {
+			notFoundError(w, ErrorM{"apk": []string{"the APK of this version was not uploaded"}})
+			return
+		}
+
+		rc, err := s.blobStore.Get(ctx, version.APKKey)
+		if err != nil {
+			switch {
+			case errors.Is(err, blob.ErrNotFound):
+				notFoundError(w, ErrorM{"apk": []string{"the APK of this version is missing from the store"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+		defer rc.Close()
+
+		extendDeadlines(r, apkTransfer)
+		w.Header().Set("Content-Type", apkContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(version.APKSize, 10))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%d.apk", app.PackageName, version.VersionCode)))
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, rc); err != nil {
+			log.Printf("cannot send blob %s: %v", version.APKKey, err)
+		}
+	}
+}
+
+// promoteApplicationVersion makes a version the active one, to roll out a new
+// version or to roll back to an older one.
+func (s *Server) promoteApplicationVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, ok := versionCodeFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		_, app, ok := s.applicationFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		if err := s.applicationService.PromoteApplicationVersion(r.Context(), app, code); err != nil {
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				notFoundError(w, ErrorM{"version": []string{"requested version not found"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"application": app})
+	}
+}
+
+// applicationFromSlug is gameFromSlug for the application of the game.
+func (s *Server) applicationFromSlug(w http.ResponseWriter, r *http.Request, manage bool) (*models.Game, *models.Application, bool) {
+	game, ok := s.gameFromSlug(w, r, manage)
+	if !ok {
+		return nil, nil, false
+	}
+
+	app, err := s.applicationService.GameApplication(r.Context(), game.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			notFoundError(w, ErrorM{"application": []string{"the game has no application"}})
+		default:
+			serverError(w, err)
+		}
+		return nil, nil, false
+	}
+
+	return game, app, true
+}
+
+func versionCodeFromPath(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	code, err := strconv.ParseUint(mux.Vars(r)["code"], 10, 32)
+	if err != nil || code == 0 {
+		validationError(w, ErrorM{"versionCode": []string{"version code must be a positive integer"}})
+		return 0, false
+	}
+	return uint(code), true
+}
+
+func duplicateVersionError(w http.ResponseWriter, versionCode uint) {
+	errorResponse(w, http.StatusConflict, ErrorM{"versionCode": []string{fmt.Sprintf("version %d already exists", versionCode)}})
+}
+
+// normalizeABIs validates the ABIs of a version against the ones Anbox Cloud
+// runs, dropping duplicates.
+func normalizeABIs(abis []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+
+	for _, abi := range abis {
+		abi = strings.ToLower(strings.TrimSpace(abi))
+		if len(knownABIs([]string{abi})) == 0 {
+			return nil, ErrorM{"abis": []string{fmt.Sprintf("%q is not one of %s", abi, strings.Join(models.ABIs, ", "))}}
+		}
+		if !seen[abi] {
+			seen[abi] = true
+			normalized = append(normalized, abi)
+		}
+	}
+
+	return normalized, nil
+}
+
+// knownABIs keeps the ABIs Anbox Cloud runs.
+func knownABIs(abis []string) []string {
+	known := []string{}
+	for _, abi := range abis {
+		for _, a := range models.ABIs {
+			if a == abi {
+				known = append(known, abi)
+				break
+			}
+		}
+	}
+	return known
+}
+
+// normalizePermissions drops the blank and duplicate permissions.
+func normalizePermissions(permissions []string) ([]string, error) {
+	if len(permissions) > maxPermissions {
+		return nil, ErrorM{"permissions": []string{fmt.Sprintf("at most %d permissions", maxPermissions)}}
+	}
+
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if p != "" && !seen[p] {
+			seen[p] = true
+			normalized = append(normalized, p)
+		}
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeABIs(t *testing.T) {
+	tests := []struct {
+		name    string
+		abis    []string
+		want    []string
+		invalid bool
+	}{
+		{"none", nil, []string{}, false},
+		{"known", []string{"arm64-v8a", "x86_64"}, []string{"arm64-v8a", "x86_64"}, false},
+		{"case and blanks", []string{" ARM64-v8a ", "arm64-v8a"}, []string{"arm64-v8a"}, false},
+		{"unknown", []string{"arm64-v8a", "mips"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeABIs(tt.abis)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("normalizeABIs() error = %v, want an error: %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeABIs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePermissions(t *testing.T) {
+	tooMany := []string{}
+	for i := 0; i <= maxPermissions; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("android.permission.P%d", i))
+	}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		want        []string
+		invalid     bool
+	}{
+		{"none", nil, []string{}, false},
+		{"blank and repeated", []string{"android.permission.INTERNET", " ", " android.permission.INTERNET"}, []string{"android.permission.INTERNET"}, false},
+		{"too many", tooMany, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePermissions(tt.permissions)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("normalizePermissions() error = %v, want an error: %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizePermissions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+// catalogMaxAge is how long (in seconds) shared caches may serve an anonymous catalog response.
+const catalogMaxAge = 60
+
+// catalogGame is a game as seen by the reader of the catalog. The link
+// status is only known for authenticated readers.
+type catalogGame struct {
+	*models.Game
+	Linked        *bool  `json:"linked,omitempty"`
+	PlayTime      *uint  `json:"playTime,omitempty"`
+	PlayTimeHuman string `json:"playTimeHuman,omitempty"`
+}
+
+// The catalog is public: anonymous readers browse every game localized for
+// the `region` query parameter, while authenticated readers only see the
+// games they are old enough to play, localized for their own region. Only
+// published games are listed.
+func (s *Server) listCatalogGames() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := models.GameFilter{Statuses: []models.GameStatus{models.GamePublished}}
+
+		if v := query.Get("q"); v != "" {
+			filter.Search = &v
+		}
+
+		if v := query.Get("publisher"); v != "" {
+			filter.Publisher = &v
+		}
+
+		if err := gameTaxonomyFromQuery(query, &filter); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		limit, offset, err := paginationFromQuery(query)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		filter.Limit, filter.Offset = limit, offset
+
+		// filtered before the pagination, for the pages to be full
+		if user := userFromContext(r.Context()); !user.IsAnonymous() {
+			filter.EligibleFor = &models.GameEligibility{Age: user.Age, Region: user.Region}
+		}
+
+		games, err := s.gameService.Games(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		catalog, err := s.catalogGames(r, games)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeCatalogJSON(w, r, M{"games": catalog, "gamesCount": len(catalog)})
+	}
+}
+
+func (s *Server) getCatalogGame() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := mux.Vars(r)["slug"]
+
+		// deprecated games are no longer listed but their players can still look them up
+		filter := models.GameFilter{Slug: &slug, Statuses: []models.GameStatus{models.GamePublished, models.GameDeprecated}}
+		games, err := s.gameService.Games(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		catalog, err := s.catalogGames(r, games)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		if len(catalog) == 0 {
+			notFoundError(w, ErrorM{"game": []string{"requested game not found"}})
+			return
+		}
+
+		writeCatalogJSON(w, r, M{"game": catalog[0]})
+	}
+}
+
+// catalogGames localizes the games for the reader, hides the ones an
+// authenticated reader is too young for and attaches its link status.
+func (s *Server) catalogGames(r *http.Request, games []*models.Game) ([]*catalogGame, error) {
+	user := userFromContext(r.Context())
+	catalog := []*catalogGame{}
+
+	if user.IsAnonymous() {
+		region := r.URL.Query().Get("region")
+		for _, game := range games {
+			game.Localize(region)
+			catalog = append(catalog, &catalogGame{Game: game})
+		}
+		return catalog, nil
+	}
+
+	md, err := s.metadataService.Metadata(r.Context(), models.MetadataFilter{PlayerID: &user.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	links := map[uint]*models.Metadata{}
+	for _, m := range md {
+		links[m.PlayedGameID] = m
+	}
+
+	for _, game := range games {
+		if !game.CheckEligibility(user) {
+			continue
+		}
+
+		linked := false
+		cg := &catalogGame{Game: game, Linked: &linked}
+		if m, ok := links[game.ID]; ok {
+			linked = true
+			cg.PlayTime = &m.PlayTime
+			cg.PlayTimeHuman = humanReadablePlayTime(m.PlayTime)
+		}
+		catalog = append(catalog, cg)
+	}
+
+	return catalog, nil
+}
+
+// writeCatalogJSON writes a catalog response with an ETag. Anonymous
+// responses can be stored by shared caches while authenticated ones are
+// private to the reader.
+func writeCatalogJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(jsonBytes))
+	w.Header().Set("ETag", etag)
+
+	if userFromContext(r.Context()).IsAnonymous() {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", catalogMaxAge))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(jsonBytes); err != nil {
+		log.Println(err)
+	}
+}
+
+func paginationFromQuery(query url.Values) (limit, offset int, err error) {
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return 0, 0, ErrorM{"limit": []string{"limit must be a positive integer"}}
+		}
+	}
+
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, ErrorM{"offset": []string{"offset must be a positive integer"}}
+		}
+	}
+
+	return limit, offset, nil
+}
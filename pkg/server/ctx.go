@@ -18,7 +18,9 @@ import (
 	"anbox_mgmt/pkg/models"
 
 	"context"
+	"net"
 	"net/http"
+	"time"
 )
 
 type contextKey string
@@ -26,6 +28,7 @@ type contextKey string
 const (
 	userKey  contextKey = "user"
 	tokenKey contextKey = "token"
+	connKey  contextKey = "conn"
 )
 
 func setContextUser(r *http.Request, u *models.User) *http.Request {
@@ -57,3 +60,23 @@ func userTokenFromContext(ctx context.Context) string {
 
 	return token
 }
+
+// setContextConn keeps the connection of the requests in their context, for
+// extendDeadlines. It is the ConnContext of the HTTP server.
+func setContextConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, c)
+}
+
+// extendDeadlines gives the request more time to be read and answered than
+// the server timeouts, e.g for a large upload or download. It does nothing
+// when the connection is unknown.
+func extendDeadlines(r *http.Request, timeout time.Duration) {
+	c, ok := r.Context().Value(connKey).(net.Conn)
+	if !ok {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	c.SetReadDeadline(deadline)
+	c.SetWriteDeadline(deadline)
+}
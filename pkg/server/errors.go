@@ -19,6 +19,8 @@ import (
 	"log"
 	"net/http"
 
+	"anbox_mgmt/pkg/models"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -40,6 +42,8 @@ func validationError(w http.ResponseWriter, _err error) {
 			msg := checkTagRules(e)
 			resp[field] = append(resp[field], msg)
 		}
+	case ErrorM:
+		resp = err
 	default:
 		resp["non_field_error"] = append(resp["non_field_error"], err.Error())
 	}
@@ -60,6 +64,28 @@ func invalidUserAgeError(w http.ResponseWriter) {
 	errorResponse(w, http.StatusUnauthorized, msg)
 }
 
+// gameNotLinkableError refuses to link a draft or a retired game.
+func gameNotLinkableError(w http.ResponseWriter, game *models.Game) {
+	err := ErrorM{"game": []string{fmt.Sprintf("%q is %s and cannot be linked", game.Title, game.Status)}}
+	errorResponse(w, http.StatusConflict, err)
+}
+
+// gameNotPlayableError refuses the play time of a draft or a retired game.
+func gameNotPlayableError(w http.ResponseWriter, game *models.Game) {
+	err := ErrorM{"game": []string{fmt.Sprintf("%q is %s and cannot be played", game.Title, game.Status)}}
+	errorResponse(w, http.StatusConflict, err)
+}
+
+// linkRequestDecidedError refuses to decide a link request twice.
+func linkRequestDecidedError(w http.ResponseWriter, lr *models.LinkRequest) {
+	err := ErrorM{"linkRequest": []string{fmt.Sprintf("the link request is already %s", lr.Status)}}
+	errorResponse(w, http.StatusConflict, err)
+}
+
+func forbiddenError(w http.ResponseWriter, msg string) {
+	errorResponse(w, http.StatusForbidden, msg)
+}
+
 func invalidAuthTokenError(w http.ResponseWriter) {
 	w.Header().Set("WWW-Authenticate", "Token")
 	msg := "invalid or missing authentication token"
@@ -97,5 +123,9 @@ func checkTagRules(e validator.FieldError) (errMsg string) {
 	if tag == "max" {
 		errMsg = fmt.Sprintf("%s must be less than %v", field, param)
 	}
+
+	if tag == "len" {
+		errMsg = fmt.Sprintf("%s must be exactly %v characters long", field, param)
+	}
 	return
 }
@@ -15,21 +15,30 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
 )
 
 func (s *Server) createGames() http.HandlerFunc {
 	type Input struct {
 		Game struct {
-			Title       string `json:"title" validate:"required"`
-			Description string `json:"description"`
-			URL         string `json:"url"`
-			AgeRating   uint   `json:"ageRating"`
-			Publisher   string `json:"publisher"`
+			Title       string              `json:"title" validate:"required"`
+			Description string              `json:"description"`
+			URL         string              `json:"url"`
+			AgeRating   uint                `json:"ageRating"`
+			Ratings     []models.GameRating `json:"ratings"`
+			Publisher   string              `json:"publisher"`
+			Genres      []string            `json:"genres"`
+			Tags        []string            `json:"tags"`
 		} `json:"game"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -45,12 +54,27 @@ func (s *Server) createGames() http.HandlerFunc {
 			return
 		}
 
+		ratings, err := normalizeRatings(input.Game.Ratings)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		tags, err := normalizeTags(input.Game.Tags)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
 		game := models.Game{
 			Title:       input.Game.Title,
 			Description: input.Game.Description,
 			URL:         input.Game.URL,
 			AgeRating:   input.Game.AgeRating,
+			Ratings:     ratings,
 			Publisher:   input.Game.Publisher,
+			Genres:      normalizeGenres(input.Game.Genres),
+			Tags:        tags,
 		}
 
 		user := userFromContext(r.Context())
@@ -60,19 +84,71 @@ func (s *Server) createGames() http.HandlerFunc {
 			return
 		}
 
-		if err := s.gameService.CreateGame(r.Context(), &game); err != nil {
+		// publisher accounts publish under their own publisher by default
+		if game.Publisher == "" {
+			name, err := s.ownPublisherName(r.Context(), user)
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			game.Publisher = name
+		}
+
+		allowed, err := s.canPublishAs(r.Context(), user, game.Publisher)
+		if err != nil {
 			serverError(w, err)
 			return
 		}
+		if !allowed {
+			forbiddenError(w, "you cannot publish games for this publisher")
+			return
+		}
+
+		if err := s.gameService.CreateGame(r.Context(), &game); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateSlug):
+				err := ErrorM{"title": []string{"a game with this title already exists"}}
+				errorResponse(w, http.StatusConflict, err)
+			case errors.Is(err, models.ErrUnknownGenre):
+				validationError(w, ErrorM{"genres": []string{"unknown genre, genres are created by admins"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
 
+		game.Localize(user.Region)
 		writeJSON(w, http.StatusOK, M{"game": game})
 	}
 }
 
+const (
+	hideIneligibleGames = "hide"
+	flagIneligibleGames = "flag"
+)
+
+// Games the caller is too young for are hidden by default. Admins can ask for
+// them with `ineligible=flag`, every game then carries its eligibility. Only
+// published games are listed unless `status` asks for others, drafts being
+// listed to the ones managing them only.
 func (s *Server) listGames() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query()
 		filter := models.GameFilter{}
+		user := userFromContext(r.Context())
+
+		ineligible := hideIneligibleGames
+		if v := query.Get("ineligible"); v != "" {
+			if v != hideIneligibleGames && v != flagIneligibleGames {
+				validationError(w, ErrorM{"ineligible": []string{"must be either 'hide' or 'flag'"}})
+				return
+			}
+			if v == flagIneligibleGames && !user.IsAdmin {
+				forbiddenError(w, "only admins can list the games they are not eligible to")
+				return
+			}
+			ineligible = v
+		}
 
 		if v := query.Get("title"); v != "" {
 			filter.Title = &v
@@ -86,6 +162,8 @@ func (s *Server) listGames() http.HandlerFunc {
 			filter.URL = &v
 		}
 
+		// the age filter applies to the minimum age in the region of the caller
+		var minimumAge *uint
 		if v := query.Get("age"); v != "" {
 			age, err := strconv.Atoi(v)
 			if err != nil {
@@ -93,13 +171,25 @@ func (s *Server) listGames() http.HandlerFunc {
 				return
 			}
 			uage := uint(age)
-			filter.AgeRating = &uage
+			minimumAge = &uage
 		}
 
 		if v := query.Get("publisher"); v != "" {
 			filter.Publisher = &v
 		}
 
+		if err := gameTaxonomyFromQuery(query, &filter); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		statuses, err := gameStatusesFromQuery(query)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		filter.Statuses = statuses
+
 		games, err := s.gameService.Games(r.Context(), filter)
 
 		if err != nil {
@@ -107,18 +197,39 @@ func (s *Server) listGames() http.HandlerFunc {
 			return
 		}
 
-		writeJSON(w, http.StatusOK, M{"games": games, "gamesCount": len(games)})
+		games, err = s.visibleDrafts(r.Context(), user, games)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		regionalGames := []*models.Game{}
+		for _, game := range games {
+			eligible := game.CheckEligibility(user)
+			if minimumAge != nil && game.MinimumAge != *minimumAge {
+				continue
+			}
+			if !eligible && ineligible == hideIneligibleGames {
+				continue
+			}
+			regionalGames = append(regionalGames, game)
+		}
+
+		writeJSON(w, http.StatusOK, M{"games": regionalGames, "gamesCount": len(regionalGames)})
 	}
 }
 
 func (s *Server) updateGames() http.HandlerFunc {
 	type Input struct {
 		Game struct {
-			Title       *string `json:"title,omitempty"`
-			Description *string `json:"description,omitempty"`
-			URL         *string `json:"url,omitempty"`
-			AgeRating   *uint   `json:"ageRating,omitempty"`
-			Publisher   *string `json:"publisher,omitempty"`
+			Title       *string              `json:"title,omitempty"`
+			Description *string              `json:"description,omitempty"`
+			URL         *string              `json:"url,omitempty"`
+			AgeRating   *uint                `json:"ageRating,omitempty"`
+			Ratings     *[]models.GameRating `json:"ratings,omitempty"`
+			Publisher   *string              `json:"publisher,omitempty"`
+			Genres      *[]string            `json:"genres,omitempty"`
+			Tags        *[]string            `json:"tags,omitempty"`
 		} `json:"game,omitempty"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -154,6 +265,19 @@ func (s *Server) updateGames() http.HandlerFunc {
 			return
 		}
 
+		allowed, err := s.canManageGames(r.Context(), user, game.PublisherID)
+		if err == nil && allowed && input.Game.Publisher != nil {
+			allowed, err = s.canPublishAs(r.Context(), user, *input.Game.Publisher)
+		}
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if !allowed {
+			forbiddenError(w, "you cannot edit the games of this publisher")
+			return
+		}
+
 		patch := models.GamePatch{
 			Title:       input.Game.Title,
 			Description: input.Game.Description,
@@ -162,11 +286,43 @@ func (s *Server) updateGames() http.HandlerFunc {
 			Publisher:   input.Game.Publisher,
 		}
 
+		if v := input.Game.Ratings; v != nil {
+			ratings, err := normalizeRatings(*v)
+			if err != nil {
+				validationError(w, err)
+				return
+			}
+			patch.Ratings = &ratings
+		}
+
+		if v := input.Game.Genres; v != nil {
+			genres := normalizeGenres(*v)
+			patch.Genres = &genres
+		}
+
+		if v := input.Game.Tags; v != nil {
+			tags, err := normalizeTags(*v)
+			if err != nil {
+				validationError(w, err)
+				return
+			}
+			patch.Tags = &tags
+		}
+
 		if err := s.gameService.UpdateGame(r.Context(), game, patch); err != nil {
-			serverError(w, err)
+			switch {
+			case errors.Is(err, models.ErrDuplicateSlug):
+				err := ErrorM{"title": []string{"a game with this title already exists"}}
+				errorResponse(w, http.StatusConflict, err)
+			case errors.Is(err, models.ErrUnknownGenre):
+				validationError(w, ErrorM{"genres": []string{"unknown genre, genres are created by admins"}})
+			default:
+				serverError(w, err)
+			}
 			return
 		}
 
+		game.Localize(user.Region)
 		writeJSON(w, http.StatusOK, M{"game": game})
 	}
 }
@@ -222,6 +378,19 @@ func (s *Server) deleteGames() http.HandlerFunc {
 			return
 		}
 
+		// nothing is deleted unless all the games can be
+		for _, game := range games {
+			allowed, err := s.canManageGames(r.Context(), user, game.PublisherID)
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			if !allowed {
+				forbiddenError(w, fmt.Sprintf("you cannot delete the game %q of this publisher", game.Title))
+				return
+			}
+		}
+
 		for _, game := range games {
 			if err := s.gameService.DeleteGame(r.Context(), game.ID); err != nil {
 				serverError(w, err)
@@ -299,19 +468,31 @@ func (s *Server) linkGames() http.HandlerFunc {
 		if len(users) > 0 && len(games) > 0 {
 			user := users[0]
 			game := games[0]
-			if user.Age >= game.AgeRating {
-				// 2) Create Metadata
-				md := &models.Metadata{
-					PlayerID:     user.ID,
-					Player:       user,
-					PlayedGameID: game.ID,
-					PlayedGame:   game,
-					PlayTime:     0, // initialize playtime at 0
-				}
-				if err = s.metadataService.CreateMetadata(r.Context(), md); err != nil {
+			if !game.Status.Linkable() {
+				gameNotLinkableError(w, game)
+				return
+			}
+			if user.Age >= game.MinimumAgeFor(user.Region) {
+				// 2) Check the parental controls of minors
+				lr, err := s.linkApproval(r.Context(), userFromContext(r.Context()), user, game)
+				if err != nil {
 					serverError(w, err)
 					return
 				}
+				if lr != nil {
+					writeJSON(w, http.StatusAccepted, M{"linkRequest": lr})
+					return
+				}
+				// 3) Create Metadata
+				if err = s.createLink(r.Context(), user, game); err != nil {
+					switch {
+					case errors.Is(err, models.ErrAlreadyLinked):
+						errorResponse(w, http.StatusConflict, ErrorM{"game": []string{fmt.Sprintf("%q is already linked to %s", game.Title, user.Username)}})
+					default:
+						serverError(w, err)
+					}
+					return
+				}
 				writeJSON(w, http.StatusNoContent, nil)
 			} else {
 				invalidUserAgeError(w)
@@ -323,3 +504,165 @@ func (s *Server) linkGames() http.HandlerFunc {
 		}
 	}
 }
+
+func (s *Server) createLink(ctx context.Context, user *models.User, game *models.Game) error {
+	if !game.Status.Linkable() {
+		return models.ErrGameNotLinkable
+	}
+
+	md := &models.Metadata{
+		PlayerID:     user.ID,
+		Player:       user,
+		PlayedGameID: game.ID,
+		PlayedGame:   game,
+		PlayTime:     0, // initialize playtime at 0
+	}
+	return s.metadataService.CreateMetadata(ctx, md)
+}
+
+// transitionGame moves the game to the status, for the ones managing the
+// games of its publisher.
+func (s *Server) transitionGame(status models.GameStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		game, ok := s.gameFromSlug(w, r, true)
+		if !ok {
+			return
+		}
+
+		from := game.Status
+		if err := s.gameService.SetGameStatus(ctx, game, status); err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidGameTransition):
+				errorResponse(w, http.StatusConflict, ErrorM{"status": []string{fmt.Sprintf("a %s game cannot become %s", from, status)}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		game.Localize(userFromContext(ctx).Region)
+		writeJSON(w, http.StatusOK, M{"game": game})
+	}
+}
+
+// gameFromSlug loads the game of the path. Drafts are only found by the ones
+// managing them, and manage requires the user to manage the game.
+func (s *Server) gameFromSlug(w http.ResponseWriter, r *http.Request, manage bool) (*models.Game, bool) {
+	return s.gameWithSlug(w, r, mux.Vars(r)["slug"], manage)
+}
+
+// gameWithSlug is gameFromSlug for a slug read elsewhere than in the path.
+func (s *Server) gameWithSlug(w http.ResponseWriter, r *http.Request, slug string, manage bool) (*models.Game, bool) {
+	ctx := r.Context()
+
+	games, err := s.gameService.Games(ctx, models.GameFilter{Slug: &slug})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(games) == 0 {
+		notFoundError(w, ErrorM{"game": []string{"requested game not found"}})
+		return nil, false
+	}
+	game := games[0]
+
+	if !manage && game.Status != models.GameDraft {
+		return game, true
+	}
+
+	allowed, err := s.canManageGames(ctx, userFromContext(ctx), game.PublisherID)
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	switch {
+	case allowed:
+		return game, true
+	case manage && game.Status != models.GameDraft:
+		forbiddenError(w, "you cannot manage the games of this publisher")
+	default:
+		notFoundError(w, ErrorM{"game": []string{"requested game not found"}})
+	}
+	return nil, false
+}
+
+// gameStatusesFromQuery reads the comma separated statuses of a game listing,
+// `all` for every status. Only published games are listed by default.
+func gameStatusesFromQuery(query url.Values) ([]models.GameStatus, error) {
+	v := query.Get("status")
+	switch v {
+	case "":
+		return []models.GameStatus{models.GamePublished}, nil
+	case "all":
+		return nil, nil
+	}
+
+	statuses := []models.GameStatus{}
+	for _, part := range strings.Split(v, ",") {
+		status := models.GameStatus(strings.TrimSpace(part))
+		if !status.Valid() {
+			return nil, ErrorM{"status": []string{fmt.Sprintf("%q is not draft, published, deprecated, retired or all", part)}}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// visibleDrafts drops the drafts the user cannot manage.
+func (s *Server) visibleDrafts(ctx context.Context, user *models.User, games []*models.Game) ([]*models.Game, error) {
+	visible := []*models.Game{}
+	canManage := map[uint]bool{} // by publisher, 0 for none
+
+	for _, game := range games {
+		if game.Status == models.GameDraft {
+			key := uint(0)
+			if game.PublisherID != nil {
+				key = *game.PublisherID
+			}
+			allowed, ok := canManage[key]
+			if !ok {
+				var err error
+				if allowed, err = s.canManageGames(ctx, user, game.PublisherID); err != nil {
+					return nil, err
+				}
+				canManage[key] = allowed
+			}
+			if !allowed {
+				continue
+			}
+		}
+		visible = append(visible, game)
+	}
+
+	return visible, nil
+}
+
+// normalizeRatings validates the regional ratings of a game against the
+// conversion table, allowing at most one rating per system.
+func normalizeRatings(ratings []models.GameRating) ([]models.GameRating, error) {
+	normalized := []models.GameRating{}
+	seen := map[models.RatingSystem]bool{}
+	errs := ErrorM{}
+
+	for _, r := range ratings {
+		r.System = models.RatingSystem(strings.ToUpper(string(r.System)))
+		r.Rating = strings.ToUpper(r.Rating)
+		if !r.Valid() {
+			errs["ratings"] = append(errs["ratings"], fmt.Sprintf("%q is not a valid %s rating", r.Rating, r.System))
+			continue
+		}
+		if seen[r.System] {
+			errs["ratings"] = append(errs["ratings"], fmt.Sprintf("%s is rated more than once", r.System))
+			continue
+		}
+		seen[r.System] = true
+		normalized = append(normalized, r)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
@@ -0,0 +1,394 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gosimple/slug"
+)
+
+const (
+	maxTagLength = 32
+	maxGameTags  = 20
+)
+
+func (s *Server) listGenres() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := paginationFromQuery(r.URL.Query())
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		genres, err := s.genreService.Genres(r.Context(), models.GenreFilter{Limit: limit, Offset: offset})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"genres": genres, "genresCount": len(genres)})
+	}
+}
+
+func (s *Server) createGenre() http.HandlerFunc {
+	type Input struct {
+		Genre struct {
+			Name string `json:"name" validate:"required"`
+		} `json:"genre"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Genre); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		genre := models.Genre{Name: strings.TrimSpace(input.Genre.Name)}
+		if slug.Make(genre.Name) == "" {
+			validationError(w, ErrorM{"name": []string{"name must contain letters or digits"}})
+			return
+		}
+
+		if err := s.genreService.CreateGenre(r.Context(), &genre); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateGenre):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"a genre with this name already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"genre": genre})
+	}
+}
+
+func (s *Server) updateGenre() http.HandlerFunc {
+	type Input struct {
+		Genre struct {
+			Name *string `json:"name,omitempty"`
+		} `json:"genre"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		genre, ok := s.genreFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		patch := models.GenrePatch{}
+		if v := input.Genre.Name; v != nil {
+			name := strings.TrimSpace(*v)
+			if slug.Make(name) == "" {
+				validationError(w, ErrorM{"name": []string{"name must contain letters or digits"}})
+				return
+			}
+			patch.Name = &name
+		}
+
+		if err := s.genreService.UpdateGenre(r.Context(), genre, patch); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateGenre):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"a genre with this name already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"genre": genre})
+	}
+}
+
+// deleteGenre deletes a genre, its games staying in their other genres.
+func (s *Server) deleteGenre() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		genre, ok := s.genreFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.genreService.DeleteGenre(r.Context(), genre.ID); err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+func (s *Server) genreFromSlug(w http.ResponseWriter, r *http.Request) (*models.Genre, bool) {
+	slug := mux.Vars(r)["slug"]
+
+	genres, err := s.genreService.Genres(r.Context(), models.GenreFilter{Slug: &slug})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(genres) == 0 {
+		notFoundError(w, ErrorM{"genre": []string{"requested genre not found"}})
+		return nil, false
+	}
+
+	return genres[0], true
+}
+
+// listTags lists the tags, the ones starting with q only when given.
+func (s *Server) listTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, offset, err := paginationFromQuery(query)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		filter := models.TagFilter{Limit: limit, Offset: offset}
+		if v := normalizeTag(query.Get("q")); v != "" {
+			filter.Search = &v
+		}
+
+		tags, err := s.tagService.Tags(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"tags": tags, "tagsCount": len(tags)})
+	}
+}
+
+func (s *Server) createTag() http.HandlerFunc {
+	type Input struct {
+		Tag struct {
+			Name string `json:"name" validate:"required"`
+		} `json:"tag"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		names, err := normalizeTags([]string{input.Tag.Name})
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		if len(names) == 0 {
+			validationError(w, ErrorM{"name": []string{"name is required"}})
+			return
+		}
+
+		tag := models.Tag{Name: names[0]}
+		if err := s.tagService.CreateTag(r.Context(), &tag); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateTag):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"this tag already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"tag": tag})
+	}
+}
+
+// updateTag renames a tag on all its games.
+func (s *Server) updateTag() http.HandlerFunc {
+	type Input struct {
+		Tag struct {
+			Name *string `json:"name,omitempty"`
+		} `json:"tag"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		tag, ok := s.tagFromName(w, r)
+		if !ok {
+			return
+		}
+
+		patch := models.TagPatch{}
+		if v := input.Tag.Name; v != nil {
+			names, err := normalizeTags([]string{*v})
+			if err != nil {
+				validationError(w, err)
+				return
+			}
+			if len(names) == 0 {
+				validationError(w, ErrorM{"name": []string{"name cannot be empty"}})
+				return
+			}
+			patch.Name = &names[0]
+		}
+
+		if err := s.tagService.UpdateTag(r.Context(), tag, patch); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateTag):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"this tag already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"tag": tag})
+	}
+}
+
+// deleteTag deletes a tag, untagging all its games.
+func (s *Server) deleteTag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, ok := s.tagFromName(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.tagService.DeleteTag(r.Context(), tag.ID); err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+func (s *Server) tagFromName(w http.ResponseWriter, r *http.Request) (*models.Tag, bool) {
+	name := normalizeTag(mux.Vars(r)["name"])
+
+	tags, err := s.tagService.Tags(r.Context(), models.TagFilter{Name: &name})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(tags) == 0 {
+		notFoundError(w, ErrorM{"tag": []string{"requested tag not found"}})
+		return nil, false
+	}
+
+	return tags[0], true
+}
+
+// normalizeGenres turns genre names or slugs into distinct slugs.
+func normalizeGenres(genres []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+
+	for _, g := range genres {
+		s := slug.Make(g)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		normalized = append(normalized, s)
+	}
+
+	return normalized
+}
+
+// normalizeTag lower cases a tag and collapses its blanks.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+// normalizeTags normalizes the tags and drops the empty and repeated ones.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	errs := ErrorM{}
+
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if len([]rune(t)) > maxTagLength {
+			errs["tags"] = append(errs["tags"], fmt.Sprintf("%q is longer than %d characters", t, maxTagLength))
+			continue
+		}
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+
+	if len(normalized) > maxGameTags {
+		errs["tags"] = append(errs["tags"], fmt.Sprintf("a game has at most %d tags", maxGameTags))
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
+
+// gameTaxonomyFromQuery reads the genre and tag filters of a game listing:
+// genre and tag are repeatable or comma separated, tags_match is any (the
+// default) or all.
+func gameTaxonomyFromQuery(query url.Values, filter *models.GameFilter) error {
+	split := func(values []string) []string {
+		parts := []string{}
+		for _, v := range values {
+			parts = append(parts, strings.Split(v, ",")...)
+		}
+		return parts
+	}
+
+	filter.Genres = normalizeGenres(split(query["genre"]))
+
+	tags, err := normalizeTags(split(query["tag"]))
+	if err != nil {
+		return err
+	}
+	filter.Tags = tags
+
+	switch query.Get("tags_match") {
+	case "", "any":
+	case "all":
+		filter.AllTags = true
+	default:
+		return ErrorM{"tags_match": []string{"tags_match must be any or all"}}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"anbox_mgmt/pkg/models"
+)
+
+func TestNormalizeGenres(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres []string
+		want   []string
+	}{
+		{"slugs", []string{"racing", "puzzle"}, []string{"racing", "puzzle"}},
+		{"names", []string{"Role Playing", "Beat 'em up"}, []string{"role-playing", "beat-em-up"}},
+		{"repeated", []string{"Racing", "racing", " RACING "}, []string{"racing"}},
+		{"empty", []string{"", "  ", "!"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeGenres(tt.genres); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeGenres() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tooMany := []string{}
+	for i := 0; i <= maxGameTags; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("tag %d", i))
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		invalid bool
+	}{
+		{"lower cased", []string{"Open World", "PVP"}, []string{"open world", "pvp"}, false},
+		{"blanks collapsed", []string{"  open \t world "}, []string{"open world"}, false},
+		{"repeated and empty", []string{"pvp", "PvP", "", "   "}, []string{"pvp"}, false},
+		{"too long", []string{strings.Repeat("a", maxTagLength+1)}, nil, true},
+		{"longest", []string{strings.Repeat("é", maxTagLength)}, []string{strings.Repeat("é", maxTagLength)}, false},
+		{"too many", tooMany, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.tags)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("normalizeTags() error = %v, want an error: %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGameTaxonomyFromQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.GameFilter
+		invalid bool
+	}{
+		{"none", "", models.GameFilter{Genres: []string{}, Tags: []string{}}, false},
+		{"repeated", "genre=racing&genre=Puzzle&tag=pvp&tag=co-op", models.GameFilter{Genres: []string{"racing", "puzzle"}, Tags: []string{"pvp", "co-op"}}, false},
+		{"comma separated", "genre=racing,puzzle&tag=pvp,Open%20World", models.GameFilter{Genres: []string{"racing", "puzzle"}, Tags: []string{"pvp", "open world"}}, false},
+		{"all tags", "tag=pvp&tags_match=all", models.GameFilter{Genres: []string{}, Tags: []string{"pvp"}, AllTags: true}, false},
+		{"any tag", "tag=pvp&tags_match=any", models.GameFilter{Genres: []string{}, Tags: []string{"pvp"}}, false},
+		{"unknown match", "tag=pvp&tags_match=some", models.GameFilter{Genres: []string{}, Tags: []string{"pvp"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter := models.GameFilter{}
+			err = gameTaxonomyFromQuery(query, &filter)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("gameTaxonomyFromQuery() error = %v, want an error: %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("filter = %+v, want %+v", filter, tt.want)
+			}
+		})
+	}
+}
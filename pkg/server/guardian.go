@@ -0,0 +1,363 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+type guardianshipWithMetadata struct {
+	*models.Guardianship
+	Metadata []*models.Metadata `json:"minorMetadata"`
+}
+
+type guardianControls struct {
+	ApprovalAgeThreshold      *uint `json:"approvalAgeThreshold,omitempty"`
+	DailyPlayTimeLimit        *uint `json:"dailyPlayTimeLimit,omitempty"`
+	WeeklyPlayTimeLimit       *uint `json:"weeklyPlayTimeLimit,omitempty"`
+	RemoveDailyPlayTimeLimit  bool  `json:"removeDailyPlayTimeLimit,omitempty"`
+	RemoveWeeklyPlayTimeLimit bool  `json:"removeWeeklyPlayTimeLimit,omitempty"`
+}
+
+// The guardian links a minor account by proving it knows the minor's credentials.
+func (s *Server) createGuardianship() http.HandlerFunc {
+	type Input struct {
+		Minor struct {
+			Email    string `json:"email" validate:"required,email"`
+			Password string `json:"password" validate:"required"`
+		} `json:"minor" validate:"required"`
+		Controls guardianControls `json:"controls"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Minor); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		guardian := userFromContext(r.Context())
+		if guardian.Age < models.AgeOfMajority {
+			forbiddenError(w, "only adults can be guardians")
+			return
+		}
+
+		minor, err := s.userService.Authenticate(r.Context(), input.Minor.Email, input.Minor.Password)
+		if err != nil || minor == nil {
+			invalidUserCredentialsError(w)
+			return
+		}
+
+		if minor.Age >= models.AgeOfMajority {
+			validationError(w, ErrorM{"minor": []string{"this user is not a minor"}})
+			return
+		}
+
+		g := models.Guardianship{
+			GuardianID:          guardian.ID,
+			Guardian:            guardian,
+			MinorID:             minor.ID,
+			Minor:               minor,
+			DailyPlayTimeLimit:  input.Controls.DailyPlayTimeLimit,
+			WeeklyPlayTimeLimit: input.Controls.WeeklyPlayTimeLimit,
+		}
+		if v := input.Controls.ApprovalAgeThreshold; v != nil {
+			g.ApprovalAgeThreshold = *v
+		}
+
+		if err := s.guardianService.CreateGuardianship(r.Context(), &g); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicateGuardianship):
+				err := ErrorM{"minor": []string{"you are already a guardian of this user"}}
+				errorResponse(w, http.StatusConflict, err)
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"guardianship": g})
+	}
+}
+
+func (s *Server) listGuardianships() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guardian := userFromContext(r.Context())
+
+		guardianships, err := s.guardianService.Guardianships(r.Context(), models.GuardianshipFilter{GuardianID: &guardian.ID})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		minors := []*guardianshipWithMetadata{}
+		for _, g := range guardianships {
+			gwm, err := guardianshipMetadata(r.Context(), g, s.metadataService)
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			minors = append(minors, gwm)
+		}
+
+		writeJSON(w, http.StatusOK, M{"minors": minors, "minorsCount": len(minors)})
+	}
+}
+
+func (s *Server) getGuardianship() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.guardianshipFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		gwm, err := guardianshipMetadata(r.Context(), g, s.metadataService)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"minor": gwm})
+	}
+}
+
+func (s *Server) updateGuardianship() http.HandlerFunc {
+	type Input struct {
+		Controls guardianControls `json:"controls"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		g, ok := s.guardianshipFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		patch := models.GuardianshipPatch{
+			ApprovalAgeThreshold:     input.Controls.ApprovalAgeThreshold,
+			DailyPlayTimeLimit:       input.Controls.DailyPlayTimeLimit,
+			WeeklyPlayTimeLimit:      input.Controls.WeeklyPlayTimeLimit,
+			UnsetDailyPlayTimeLimit:  input.Controls.RemoveDailyPlayTimeLimit,
+			UnsetWeeklyPlayTimeLimit: input.Controls.RemoveWeeklyPlayTimeLimit,
+		}
+
+		if err := s.guardianService.UpdateGuardianship(r.Context(), g, patch); err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"guardianship": g})
+	}
+}
+
+func (s *Server) deleteGuardianship() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		g, ok := s.guardianshipFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.guardianService.DeleteGuardianship(r.Context(), g.ID); err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+func (s *Server) listLinkRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guardian := userFromContext(r.Context())
+		filter := models.LinkRequestFilter{GuardianID: &guardian.ID}
+
+		if v := r.URL.Query().Get("status"); v != "" {
+			status := models.LinkRequestStatus(v)
+			filter.Status = &status
+		}
+
+		lrs, err := s.guardianService.LinkRequests(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"linkRequests": lrs, "linkRequestsCount": len(lrs)})
+	}
+}
+
+// decideLinkRequest approves or denies a pending link request, a decided one
+// conflicts. Approving it creates the link between the minor and the game.
+func (s *Server) decideLinkRequest(status models.LinkRequestStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		guardian := userFromContext(ctx)
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			badRequestError(w)
+			return
+		}
+		lrID := uint(id)
+
+		lrs, err := s.guardianService.LinkRequests(ctx, models.LinkRequestFilter{ID: &lrID, GuardianID: &guardian.ID})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if len(lrs) == 0 {
+			notFoundError(w, ErrorM{"linkRequest": []string{"requested link request not found"}})
+			return
+		}
+		lr := lrs[0]
+
+		if lr.Status != models.LinkRequestPending {
+			linkRequestDecidedError(w, lr)
+			return
+		}
+
+		if status == models.LinkRequestApproved {
+			if lr.Minor.Age < lr.Game.MinimumAgeFor(lr.Minor.Region) {
+				invalidUserAgeError(w)
+				return
+			}
+			if !lr.Game.Status.Linkable() {
+				gameNotLinkableError(w, lr.Game)
+				return
+			}
+		}
+
+		if err := s.guardianService.DecideLinkRequest(ctx, lr, status, guardian.ID); err != nil {
+			switch {
+			case errors.Is(err, models.ErrLinkRequestDecided):
+				linkRequestDecidedError(w, lr)
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"linkRequest": lr})
+	}
+}
+
+// guardianshipFromRequest finds the guardianship between the current user and
+// the minor named in the URL, writing a 404 when there is none.
+func (s *Server) guardianshipFromRequest(w http.ResponseWriter, r *http.Request) (*models.Guardianship, bool) {
+	ctx := r.Context()
+	guardian := userFromContext(ctx)
+
+	minor, err := s.userService.UserByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			notFoundError(w, ErrorM{"minor": []string{"requested minor not found"}})
+		default:
+			serverError(w, err)
+		}
+		return nil, false
+	}
+
+	guardianships, err := s.guardianService.Guardianships(ctx, models.GuardianshipFilter{GuardianID: &guardian.ID, MinorID: &minor.ID})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(guardianships) == 0 {
+		notFoundError(w, ErrorM{"minor": []string{"requested minor not found"}})
+		return nil, false
+	}
+
+	return guardianships[0], true
+}
+
+// linkApproval checks the parental controls of a player before linking it
+// to a game. It returns the pending link request when a guardian must decide first,
+// reopening a denied one.
+func (s *Server) linkApproval(ctx context.Context, caller, player *models.User, game *models.Game) (*models.LinkRequest, error) {
+	if player.Age >= models.AgeOfMajority {
+		return nil, nil
+	}
+
+	guardianships, err := s.guardianService.Guardianships(ctx, models.GuardianshipFilter{MinorID: &player.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	needsApproval := false
+	for _, g := range guardianships {
+		if g.GuardianID == caller.ID {
+			return nil, nil // guardians link games for their minors directly
+		}
+		if g.RequiresApproval(game.MinimumAgeFor(player.Region)) {
+			needsApproval = true
+		}
+	}
+
+	if !needsApproval {
+		return nil, nil
+	}
+
+	lrs, err := s.guardianService.LinkRequests(ctx, models.LinkRequestFilter{MinorID: &player.ID, GameID: &game.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lrs) > 0 {
+		switch lrs[0].Status {
+		case models.LinkRequestApproved:
+			return nil, nil
+		case models.LinkRequestPending:
+			return lrs[0], nil
+		}
+	}
+
+	lr := &models.LinkRequest{MinorID: player.ID, Minor: player, GameID: game.ID, Game: game}
+	if err := s.guardianService.CreateLinkRequest(ctx, lr); err != nil {
+		if errors.Is(err, models.ErrLinkRequestDecided) {
+			// decided concurrently, the next attempt sees the decision
+			return s.linkApproval(ctx, caller, player, game)
+		}
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+func guardianshipMetadata(ctx context.Context, g *models.Guardianship, metadataService models.MetadataService) (*guardianshipWithMetadata, error) {
+	minorWithMD, err := mergeUserWithGamingMetadata(ctx, g.Minor, metadataService)
+	if err != nil {
+		return nil, err
+	}
+
+	return &guardianshipWithMetadata{g, minorWithMD.Metadata}, nil
+}
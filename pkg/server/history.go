@@ -0,0 +1,203 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxSeriesDays  = 366
+	maxSeriesHours = 31 * 24
+)
+
+// userPlayTime returns the play time series of a user, optionally on a
+// single game. Only the user, their guardians and admins can read it.
+func (s *Server) userPlayTime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		player, ok := s.visiblePlayer(w, r)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		filter, err := seriesFilterFromQuery(query, player.Location())
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		filter.PlayerID = &player.ID
+
+		if v := query.Get("game"); v != "" {
+			game, ok := s.gameWithSlug(w, r, v, false)
+			if !ok {
+				return
+			}
+			filter.GameID = &game.ID
+		}
+
+		s.writePlayTimeSeries(w, r, filter)
+	}
+}
+
+// visiblePlayer returns the user of the username path variable if the
+// current user can see their play time: they are the user, one of their
+// guardians or an admin. Otherwise it writes the error response.
+func (s *Server) visiblePlayer(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	ctx := r.Context()
+	current := userFromContext(ctx)
+
+	player, err := s.userService.UserByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			notFoundError(w, ErrorM{"user": []string{"requested user not found"}})
+		default:
+			serverError(w, err)
+		}
+		return nil, false
+	}
+
+	if player.ID != current.ID && !current.IsAdmin {
+		guardianships, err := s.guardianService.Guardianships(ctx, models.GuardianshipFilter{GuardianID: &current.ID, MinorID: &player.ID})
+		if err != nil {
+			serverError(w, err)
+			return nil, false
+		}
+		if len(guardianships) == 0 {
+			// not telling whether the user exists
+			notFoundError(w, ErrorM{"user": []string{"requested user not found"}})
+			return nil, false
+		}
+	}
+
+	return player, true
+}
+
+// gamePlayTime returns the play time series of a game, all players included.
+func (s *Server) gamePlayTime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		game, ok := s.gameFromSlug(w, r, false)
+		if !ok {
+			return
+		}
+
+		filter, err := seriesFilterFromQuery(r.URL.Query(), time.UTC)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		filter.GameID = &game.ID
+
+		s.writePlayTimeSeries(w, r, filter)
+	}
+}
+
+func (s *Server) writePlayTimeSeries(w http.ResponseWriter, r *http.Request, filter models.PlayTimeSeriesFilter) {
+	points, err := s.historyService.PlayTimeSeries(r.Context(), filter)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	total := uint(0)
+	for _, p := range points {
+		total += p.PlayTime
+	}
+
+	writeJSON(w, http.StatusOK, M{
+		"granularity": filter.Granularity,
+		"timezone":    filter.Location.String(),
+		"from":        filter.From.Format(models.BirthdateLayout),
+		"to":          filter.To.AddDate(0, 0, -1).Format(models.BirthdateLayout),
+		"total":       total,
+		"series":      points,
+	})
+}
+
+// seriesFilterFromQuery reads the granularity (day or hour), the time zone
+// (tz, defaulting to location) and the inclusive range of dates (from and to,
+// YYYY-MM-DD) of a series. It defaults to the last 30 days, or today when hourly.
+func seriesFilterFromQuery(query url.Values, location *time.Location) (models.PlayTimeSeriesFilter, error) {
+	filter := models.PlayTimeSeriesFilter{Granularity: models.GranularityDay}
+	errs := ErrorM{}
+
+	switch v := models.Granularity(query.Get("granularity")); v {
+	case "":
+	case models.GranularityDay, models.GranularityHour:
+		filter.Granularity = v
+	default:
+		errs["granularity"] = []string{"granularity must be day or hour"}
+	}
+
+	if v := query.Get("tz"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			errs["tz"] = []string{fmt.Sprintf("%q is not a valid IANA time zone", v)}
+		} else {
+			location = loc
+		}
+	}
+	filter.Location = location
+
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if v := query.Get("to"); v != "" {
+		t, err := time.ParseInLocation(models.BirthdateLayout, v, location)
+		if err != nil {
+			errs["to"] = []string{"to must be a date formatted as YYYY-MM-DD"}
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if filter.Granularity == models.GranularityHour {
+		from = to
+	}
+	if v := query.Get("from"); v != "" {
+		t, err := time.ParseInLocation(models.BirthdateLayout, v, location)
+		if err != nil {
+			errs["from"] = []string{"from must be a date formatted as YYYY-MM-DD"}
+		}
+		from = t
+	}
+
+	if len(errs) > 0 {
+		return filter, errs
+	}
+
+	// to is inclusive, the series ends at the following midnight
+	filter.From, filter.To = from, to.AddDate(0, 0, 1)
+
+	if !filter.From.Before(filter.To) {
+		return filter, ErrorM{"from": []string{"from cannot be after to"}}
+	}
+	if filter.Granularity == models.GranularityHour && filter.To.Sub(filter.From) > maxSeriesHours*time.Hour {
+		return filter, ErrorM{"to": []string{fmt.Sprintf("an hourly series covers at most %d days", maxSeriesHours/24)}}
+	}
+	if filter.To.Sub(filter.From) > maxSeriesDays*24*time.Hour {
+		return filter, ErrorM{"to": []string{fmt.Sprintf("a daily series covers at most %d days", maxSeriesDays)}}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+const maxLeaderboardSize = 100
+
+// leaderboardWindows are the rolling windows a leaderboard can cover.
+var leaderboardWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+func (s *Server) gameLeaderboard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		game, ok := s.gameFromSlug(w, r, false)
+		if !ok {
+			return
+		}
+
+		filter := models.LeaderboardFilter{GameID: game.ID, Limit: models.DefaultLeaderboardSize}
+
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > maxLeaderboardSize {
+				validationError(w, ErrorM{"limit": []string{fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardSize)}})
+				return
+			}
+			filter.Limit = limit
+		}
+
+		window := query.Get("window")
+		switch d, ok := leaderboardWindows[window]; {
+		case window == "" || window == "all":
+			window = "all"
+		case ok:
+			since := time.Now().Add(-d)
+			filter.Since = &since
+		default:
+			validationError(w, ErrorM{"window": []string{"window must be all, day, week or month"}})
+			return
+		}
+
+		entries, err := s.leaderboardService.Leaderboard(ctx, filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"game": game.Slug, "window": window, "leaderboard": entries})
+	}
+}
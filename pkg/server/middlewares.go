@@ -68,3 +68,33 @@ func (s *Server) authenticate(mustAuth bool) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// requireAdmin must be used after authenticate(true).
+func requireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !userFromContext(r.Context()).IsAdmin {
+			forbiddenError(w, "admin privileges required")
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requireLeader refuses the request on a replica not running the background
+// jobs, e.g the simulator controls, which would act on an idle simulator or
+// write alongside the leader.
+func (s *Server) requireLeader(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isLeader() {
+			errorResponse(w, http.StatusServiceUnavailable, "this replica is not the leader running the background jobs, retry on another one")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isLeader tells whether this replica runs the background jobs.
+func (s *Server) isLeader() bool {
+	return s.elector != nil && s.elector.IsLeader()
+}
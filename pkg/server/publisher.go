@@ -0,0 +1,311 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) listPublishers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := paginationFromQuery(r.URL.Query())
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		publishers, err := s.publisherService.Publishers(r.Context(), models.PublisherFilter{Limit: limit, Offset: offset})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"publishers": publishers, "publishersCount": len(publishers)})
+	}
+}
+
+func (s *Server) getPublisher() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publisher, ok := s.publisherFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"publisher": publisher})
+	}
+}
+
+func (s *Server) createPublisher() http.HandlerFunc {
+	type Input struct {
+		Publisher struct {
+			Name        string `json:"name" validate:"required"`
+			Website     string `json:"website"`
+			Description string `json:"description"`
+		} `json:"publisher"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Publisher); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		publisher := models.Publisher{
+			Name:        strings.TrimSpace(input.Publisher.Name),
+			Website:     input.Publisher.Website,
+			Description: input.Publisher.Description,
+		}
+		if models.PublisherKey(publisher.Name) == "" {
+			validationError(w, ErrorM{"name": []string{"name must contain letters or digits"}})
+			return
+		}
+
+		if err := s.publisherService.CreatePublisher(r.Context(), &publisher); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicatePublisher):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"this publisher already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"publisher": publisher})
+	}
+}
+
+// updatePublisher edits the profile of a publisher. Admins and the accounts
+// of the publisher can.
+func (s *Server) updatePublisher() http.HandlerFunc {
+	type Input struct {
+		Publisher struct {
+			Name        *string `json:"name,omitempty"`
+			Website     *string `json:"website,omitempty"`
+			Description *string `json:"description,omitempty"`
+		} `json:"publisher"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		publisher, ok := s.publisherFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		user := userFromContext(r.Context())
+		if !user.IsAdmin && (user.PublisherID == nil || *user.PublisherID != publisher.ID) {
+			forbiddenError(w, "only admins and the accounts of the publisher can edit it")
+			return
+		}
+
+		patch := models.PublisherPatch{
+			Website:     input.Publisher.Website,
+			Description: input.Publisher.Description,
+		}
+		if v := input.Publisher.Name; v != nil {
+			name := strings.TrimSpace(*v)
+			if models.PublisherKey(name) == "" {
+				validationError(w, ErrorM{"name": []string{"name must contain letters or digits"}})
+				return
+			}
+			patch.Name = &name
+		}
+
+		if err := s.publisherService.UpdatePublisher(r.Context(), publisher, patch); err != nil {
+			switch {
+			case errors.Is(err, models.ErrDuplicatePublisher):
+				errorResponse(w, http.StatusConflict, ErrorM{"name": []string{"this publisher already exists"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"publisher": publisher})
+	}
+}
+
+// deletePublisher deletes a publisher without games, its accounts becoming
+// regular users.
+func (s *Server) deletePublisher() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publisher, ok := s.publisherFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.publisherService.DeletePublisher(r.Context(), publisher.ID); err != nil {
+			switch {
+			case errors.Is(err, models.ErrPublisherHasGames):
+				errorResponse(w, http.StatusConflict, ErrorM{"publisher": []string{"the publisher still has games"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+func (s *Server) listPublisherAccounts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		publisher, ok := s.publisherFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		users, err := s.publisherService.PublisherAccounts(r.Context(), publisher.ID)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"accounts": users, "accountsCount": len(users)})
+	}
+}
+
+// setPublisherAccount makes a user an account of the publisher when add is
+// true, a regular user again otherwise.
+func (s *Server) setPublisherAccount(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		publisher, ok := s.publisherFromSlug(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := s.userService.UserByUsername(ctx, mux.Vars(r)["username"])
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				notFoundError(w, ErrorM{"user": []string{"requested user not found"}})
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		var publisherID *uint
+		if add {
+			if user.PublisherID != nil && *user.PublisherID != publisher.ID {
+				errorResponse(w, http.StatusConflict, ErrorM{"user": []string{"the user is an account of another publisher"}})
+				return
+			}
+			publisherID = &publisher.ID
+		} else if user.PublisherID == nil || *user.PublisherID != publisher.ID {
+			notFoundError(w, ErrorM{"user": []string{"the user is not an account of the publisher"}})
+			return
+		}
+
+		if err := s.publisherService.SetPublisherAccount(ctx, user.ID, publisherID); err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+func (s *Server) publisherFromSlug(w http.ResponseWriter, r *http.Request) (*models.Publisher, bool) {
+	slug := mux.Vars(r)["slug"]
+
+	publishers, err := s.publisherService.Publishers(r.Context(), models.PublisherFilter{Slug: &slug})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(publishers) == 0 {
+		notFoundError(w, ErrorM{"publisher": []string{"requested publisher not found"}})
+		return nil, false
+	}
+
+	return publishers[0], true
+}
+
+// canManageGames tells whether the user can create, edit and delete the games
+// of a publisher (none when nil): admins manage all the games, publisher
+// accounts the games of their publisher only, and other users the games of
+// the publishers without account.
+func (s *Server) canManageGames(ctx context.Context, user *models.User, publisherID *uint) (bool, error) {
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	if user.PublisherID != nil {
+		return publisherID != nil && *publisherID == *user.PublisherID, nil
+	}
+
+	if publisherID == nil {
+		return true, nil
+	}
+
+	publishers, err := s.publisherService.Publishers(ctx, models.PublisherFilter{ID: publisherID})
+	if err != nil {
+		return false, err
+	}
+	return len(publishers) == 0 || publishers[0].AccountsCount == 0, nil
+}
+
+// canPublishAs is canManageGames for a publisher name, in any spelling. A new
+// publisher can be named by anyone but publisher accounts.
+func (s *Server) canPublishAs(ctx context.Context, user *models.User, name string) (bool, error) {
+	if models.PublisherKey(name) == "" {
+		return s.canManageGames(ctx, user, nil)
+	}
+
+	publishers, err := s.publisherService.Publishers(ctx, models.PublisherFilter{Name: &name})
+	if err != nil {
+		return false, err
+	}
+	if len(publishers) == 0 {
+		return user.IsAdmin || user.PublisherID == nil, nil
+	}
+
+	return s.canManageGames(ctx, user, &publishers[0].ID)
+}
+
+// ownPublisherName returns the name of the publisher of a publisher account,
+// an empty string for other users.
+func (s *Server) ownPublisherName(ctx context.Context, user *models.User) (string, error) {
+	if user.PublisherID == nil {
+		return "", nil
+	}
+
+	publishers, err := s.publisherService.Publishers(ctx, models.PublisherFilter{ID: user.PublisherID})
+	if err != nil || len(publishers) == 0 {
+		return "", err
+	}
+	return publishers[0].Name, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRecommendations = 10
+	maxRecommendations     = models.MaxSimilarGames
+	maxBecause             = 3
+)
+
+// userRecommendations returns the games played by the players of the games
+// of the current user, leaving out the ones they have or are too young for.
+func (s *Server) userRecommendations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+
+		limit, err := recommendationLimitFromQuery(r)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		recommendations, err := s.recommendationService.Recommendations(ctx, user.ID)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		recommendations = eligibleRecommendations(user, recommendations, limit)
+		for _, rec := range recommendations {
+			if len(rec.Because) > maxBecause {
+				rec.Because = rec.Because[:maxBecause]
+			}
+		}
+
+		writeJSON(w, http.StatusOK, M{"recommendations": recommendations, "recommendationsCount": len(recommendations)})
+	}
+}
+
+// similarGames returns the games the players of a game also played, leaving
+// out the ones the current user is too young for.
+func (s *Server) similarGames() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		slug := mux.Vars(r)["slug"]
+
+		limit, err := recommendationLimitFromQuery(r)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		game, ok := s.gameFromSlug(w, r, false)
+		if !ok {
+			return
+		}
+
+		similar, err := s.recommendationService.SimilarGames(ctx, game.ID)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		similar = eligibleRecommendations(userFromContext(ctx), similar, limit)
+
+		writeJSON(w, http.StatusOK, M{"game": slug, "similar": similar, "similarCount": len(similar)})
+	}
+}
+
+func recommendationLimitFromQuery(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultRecommendations, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxRecommendations {
+		return 0, ErrorM{"limit": []string{fmt.Sprintf("limit must be between 1 and %d", maxRecommendations)}}
+	}
+	return limit, nil
+}
+
+// eligibleRecommendations keeps the first limit recommendations of published
+// games the user is old enough for.
+func eligibleRecommendations(user *models.User, recommendations []*models.Recommendation, limit int) []*models.Recommendation {
+	eligible := []*models.Recommendation{}
+	for _, rec := range recommendations {
+		if len(eligible) == limit {
+			break
+		}
+		// deleted or unpublished since the similarities were computed
+		if rec.Game == nil || rec.Game.Status != models.GamePublished {
+			continue
+		}
+		if rec.Game.CheckEligibility(user) {
+			eligible = append(eligible, rec)
+		}
+	}
+	return eligible
+}
+
+// computeRecommendations recomputes the game similarities every
+// recommendationInterval, first right away, until stop is closed or receives
+// a value.
+func (s *Server) computeRecommendations(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.recommendationInterval)
+	defer ticker.Stop()
+
+	compute := func() {
+		start := time.Now()
+		n, err := s.recommendationService.ComputeSimilarities(context.Background())
+		if err != nil {
+			log.Printf("cannot compute game similarities: %v", err)
+			return
+		}
+		log.Printf("%d game similarities computed in %v", n, time.Since(start).Round(time.Millisecond))
+	}
+
+	compute()
+	for {
+		select {
+		case <-ticker.C:
+			compute()
+		case <-stop:
+			return
+		}
+	}
+}
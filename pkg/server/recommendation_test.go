@@ -0,0 +1,61 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"anbox_mgmt/pkg/models"
+)
+
+func TestEligibleRecommendations(t *testing.T) {
+	game := func(slug string, ageRating uint, status models.GameStatus) *models.Recommendation {
+		return &models.Recommendation{Game: &models.Game{Slug: slug, AgeRating: ageRating, Status: status}}
+	}
+	kart := game("kart", 3, models.GamePublished)
+	chess := game("chess", 7, models.GamePublished)
+	shooter := game("shooter", 18, models.GamePublished)
+	draft := game("draft", 3, models.GameDraft)
+	deleted := &models.Recommendation{}
+
+	tests := []struct {
+		name            string
+		age             uint
+		recommendations []*models.Recommendation
+		limit           int
+		want            []string
+	}{
+		{"all eligible", 30, []*models.Recommendation{kart, shooter, chess}, 10, []string{"kart", "shooter", "chess"}},
+		{"too young", 12, []*models.Recommendation{kart, shooter, chess}, 10, []string{"kart", "chess"}},
+		{"limit", 30, []*models.Recommendation{kart, shooter, chess}, 2, []string{"kart", "shooter"}},
+		{"limit counts eligible games only", 12, []*models.Recommendation{shooter, kart, chess}, 2, []string{"kart", "chess"}},
+		{"deleted or unpublished", 30, []*models.Recommendation{deleted, draft, chess}, 10, []string{"chess"}},
+		{"none", 30, nil, 10, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Age: tt.age}
+			got := []string{}
+			for _, rec := range eligibleRecommendations(user, tt.recommendations, tt.limit) {
+				got = append(got, rec.Game.Slug)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("eligibleRecommendations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ package server
 import (
 	"os"
 
+	"anbox_mgmt/pkg/models"
+
 	"github.com/rs/cors"
 )
 
@@ -32,12 +34,27 @@ func (s *Server) routes() {
 		noAuth.Handle("/users/login", s.loginUser()).Methods("POST")
 	}
 
+	// read-only routes open to anonymous users, authenticated users get a personalized view
+	optionalAuth := apiRouter.PathPrefix("/catalog").Subrouter()
+	optionalAuth.Use(s.authenticate(false))
+	{
+		optionalAuth.Handle("/games", s.listCatalogGames()).Methods("GET")
+		optionalAuth.Handle("/games/{slug}", s.getCatalogGame()).Methods("GET")
+		optionalAuth.Handle("/genres", s.listGenres()).Methods("GET")
+		optionalAuth.Handle("/tags", s.listTags()).Methods("GET")
+		optionalAuth.Handle("/publishers", s.listPublishers()).Methods("GET")
+		optionalAuth.Handle("/publishers/{slug}", s.getPublisher()).Methods("GET")
+	}
+
 	authApiRoutes := apiRouter.PathPrefix("").Subrouter()
 	authApiRoutes.Use(s.authenticate(true))
 	{
 		authApiRoutes.Handle("/users", s.listUsers()).Methods("GET")
 		authApiRoutes.Handle("/users", s.deleteUser()).Methods("DELETE")
 		authApiRoutes.Handle("/users", s.updateUser()).Methods("PUT", "PATCH")
+		authApiRoutes.Handle("/users/me/recommendations", s.userRecommendations()).Methods("GET")
+		authApiRoutes.Handle("/users/{username}/play-time", s.userPlayTime()).Methods("GET")
+		authApiRoutes.Handle("/users/{username}/stats", s.userStats()).Methods("GET")
 
 		authApiRoutes.Handle("/games", s.createGames()).Methods("POST")
 		authApiRoutes.Handle("/games", s.listGames()).Methods("GET")
@@ -45,5 +62,62 @@ func (s *Server) routes() {
 		authApiRoutes.Handle("/games", s.updateGames()).Methods("PUT", "PATCH")
 
 		authApiRoutes.Handle("/games/link", s.linkGames()).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/play-time", s.gamePlayTime()).Methods("GET")
+		authApiRoutes.Handle("/games/{slug}/leaderboard", s.gameLeaderboard()).Methods("GET")
+		authApiRoutes.Handle("/games/{slug}/similar", s.similarGames()).Methods("GET")
+		authApiRoutes.Handle("/games/{slug}/publish", s.transitionGame(models.GamePublished)).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/deprecate", s.transitionGame(models.GameDeprecated)).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/retire", s.transitionGame(models.GameRetired)).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/application", s.getApplication()).Methods("GET")
+		authApiRoutes.Handle("/games/{slug}/application", s.createApplication()).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/application/versions", s.listApplicationVersions()).Methods("GET")
+		authApiRoutes.Handle("/games/{slug}/application/versions", s.createApplicationVersion()).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/application/versions/upload", s.uploadApplicationVersion()).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/application/versions/{code}/promote", s.promoteApplicationVersion()).Methods("POST")
+		authApiRoutes.Handle("/games/{slug}/application/versions/{code}/apk", s.downloadApplicationVersion()).Methods("GET")
+
+		authApiRoutes.Handle("/publishers/{slug}", s.updatePublisher()).Methods("PUT", "PATCH")
+
+		authApiRoutes.Handle("/stats/games", s.gameStats()).Methods("GET")
+		authApiRoutes.Handle("/stats/publishers", s.publisherStats()).Methods("GET")
+
+		authApiRoutes.Handle("/sessions", s.startPlaySession()).Methods("POST")
+		authApiRoutes.Handle("/sessions", s.listPlaySessions()).Methods("GET")
+		authApiRoutes.Handle("/sessions/{id}/heartbeat", s.heartbeatPlaySession()).Methods("POST")
+		authApiRoutes.Handle("/sessions/{id}/end", s.endPlaySession()).Methods("POST")
+		authApiRoutes.Handle("/heartbeats", s.ingestHeartbeat()).Methods("POST")
+		authApiRoutes.Handle("/telemetry/play-events", s.ingestPlayEvents()).Methods("POST")
+
+		authApiRoutes.Handle("/guardians/minors", s.createGuardianship()).Methods("POST")
+		authApiRoutes.Handle("/guardians/minors", s.listGuardianships()).Methods("GET")
+		authApiRoutes.Handle("/guardians/minors/{username}", s.getGuardianship()).Methods("GET")
+		authApiRoutes.Handle("/guardians/minors/{username}", s.updateGuardianship()).Methods("PUT", "PATCH")
+		authApiRoutes.Handle("/guardians/minors/{username}", s.deleteGuardianship()).Methods("DELETE")
+		authApiRoutes.Handle("/guardians/requests", s.listLinkRequests()).Methods("GET")
+		authApiRoutes.Handle("/guardians/requests/{id}/approve", s.decideLinkRequest(models.LinkRequestApproved)).Methods("POST")
+		authApiRoutes.Handle("/guardians/requests/{id}/deny", s.decideLinkRequest(models.LinkRequestDenied)).Methods("POST")
+	}
+
+	adminApiRoutes := apiRouter.PathPrefix("/admin").Subrouter()
+	adminApiRoutes.Use(s.authenticate(true), requireAdmin)
+	{
+		adminApiRoutes.Handle("/simulator", s.simulatorStatus()).Methods("GET")
+		adminApiRoutes.Handle("/simulator", s.requireLeader(s.configureSimulator())).Methods("PUT", "PATCH")
+		adminApiRoutes.Handle("/simulator/pause", s.requireLeader(s.pauseSimulator())).Methods("POST")
+		adminApiRoutes.Handle("/simulator/resume", s.requireLeader(s.resumeSimulator())).Methods("POST")
+		adminApiRoutes.Handle("/simulator/step", s.requireLeader(s.stepSimulator())).Methods("POST")
+
+		adminApiRoutes.Handle("/genres", s.createGenre()).Methods("POST")
+		adminApiRoutes.Handle("/genres/{slug}", s.updateGenre()).Methods("PUT", "PATCH")
+		adminApiRoutes.Handle("/genres/{slug}", s.deleteGenre()).Methods("DELETE")
+		adminApiRoutes.Handle("/tags", s.createTag()).Methods("POST")
+		adminApiRoutes.Handle("/tags/{name}", s.updateTag()).Methods("PUT", "PATCH")
+		adminApiRoutes.Handle("/tags/{name}", s.deleteTag()).Methods("DELETE")
+
+		adminApiRoutes.Handle("/publishers", s.createPublisher()).Methods("POST")
+		adminApiRoutes.Handle("/publishers/{slug}", s.deletePublisher()).Methods("DELETE")
+		adminApiRoutes.Handle("/publishers/{slug}/accounts", s.listPublisherAccounts()).Methods("GET")
+		adminApiRoutes.Handle("/publishers/{slug}/accounts/{username}", s.setPublisherAccount(true)).Methods("PUT")
+		adminApiRoutes.Handle("/publishers/{slug}/accounts/{username}", s.setPublisherAccount(false)).Methods("DELETE")
 	}
 }
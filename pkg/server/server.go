@@ -15,35 +15,62 @@
 package server
 
 import (
-	"context"
 	"log"
-	"math/rand"
 	"net/http"
 	"strings"
 	"time"
 
+	"anbox_mgmt/pkg/blob"
+	"anbox_mgmt/pkg/leader"
 	"anbox_mgmt/pkg/models"
 	"anbox_mgmt/pkg/postgresql"
+	"anbox_mgmt/pkg/simulator"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	server          *http.Server
-	router          *mux.Router
-	userService     models.UserService
-	gameService     models.GameService
-	metadataService models.MetadataService
+	server                 *http.Server
+	router                 *mux.Router
+	userService            models.UserService
+	gameService            models.GameService
+	metadataService        models.MetadataService
+	guardianService        models.GuardianService
+	playSessionService     models.PlaySessionService
+	historyService         models.PlayTimeHistoryService
+	leaderboardService     models.LeaderboardService
+	statsService           models.StatsService
+	recommendationService  models.RecommendationService
+	genreService           models.GenreService
+	tagService             models.TagService
+	publisherService       models.PublisherService
+	applicationService     models.ApplicationService
+	simulatorService       models.SimulatorService
+	blobStore              blob.Store
+	heartbeatTimeout       time.Duration
+	recommendationInterval time.Duration
+	simulator              *simulator.Simulator
+	elector                *leader.Elector
 }
 
-func NewServer(db *postgresql.DB) *Server {
+func NewServer(db *postgresql.DB, blobs blob.Store, heartbeatTimeout, recommendationInterval time.Duration) *Server {
+	if heartbeatTimeout <= 0 {
+		heartbeatTimeout = models.DefaultHeartbeatTimeout
+	}
+	if recommendationInterval <= 0 {
+		recommendationInterval = models.DefaultRecommendationInterval
+	}
+
 	s := Server{
 		server: &http.Server{
 			WriteTimeout: 5 * time.Second,
 			ReadTimeout:  5 * time.Second,
 			IdleTimeout:  5 * time.Second,
+			ConnContext:  setContextConn,
 		},
-		router: mux.NewRouter().StrictSlash(true),
+		router:                 mux.NewRouter().StrictSlash(true),
+		heartbeatTimeout:       heartbeatTimeout,
+		recommendationInterval: recommendationInterval,
 	}
 
 	s.routes()
@@ -51,12 +78,26 @@ func NewServer(db *postgresql.DB) *Server {
 	s.userService = postgresql.NewUserService(db)
 	s.gameService = postgresql.NewGameService(db)
 	s.metadataService = postgresql.NewMetadataService(db)
+	s.guardianService = postgresql.NewGuardianService(db)
+	s.playSessionService = postgresql.NewPlaySessionService(db, heartbeatTimeout)
+	s.historyService = postgresql.NewPlayTimeHistoryService(db)
+	s.leaderboardService = postgresql.NewLeaderboardService(db)
+	s.statsService = postgresql.NewStatsService(db)
+	s.recommendationService = postgresql.NewRecommendationService(db)
+	s.genreService = postgresql.NewGenreService(db)
+	s.tagService = postgresql.NewTagService(db)
+	s.publisherService = postgresql.NewPublisherService(db)
+	s.applicationService = postgresql.NewApplicationService(db)
+	s.simulatorService = postgresql.NewSimulatorService(db)
+	s.blobStore = blobs
 	s.server.Handler = s.router
 
 	return &s
 }
 
-func (s *Server) Run(port string, gameTrafficFrequency time.Duration, gameTrafficLimitPlayTimePerFreq int32) error {
+// Run serves the API. Background jobs only run on the replica holding the
+// locker's lock.
+func (s *Server) Run(port string, simulatorConfig simulator.Config, locker leader.Locker) error {
 	sigHandler := make(chan struct{})
 	terminate := func() {
 		sigHandler <- struct{}{}
@@ -71,7 +112,14 @@ func (s *Server) Run(port string, gameTrafficFrequency time.Duration, gameTraffi
 	log.Printf("server starting on %s", port)
 
 	// generate artificial game traffic
-	go generateGameTraffic(gameTrafficFrequency, gameTrafficLimitPlayTimePerFreq, s.metadataService, sigHandler)
+	sim, err := simulator.New(simulatorConfig, s.metadataService, s.simulatorService)
+	if err != nil {
+		return err
+	}
+	s.simulator = sim
+
+	s.elector = leader.NewElector(locker, leader.DefaultRetryInterval)
+	go s.elector.Run(sigHandler, leader.All(sim.Run, s.expirePlaySessions, s.computeRecommendations))
 
 	return s.server.ListenAndServe()
 }
@@ -86,37 +134,3 @@ func healthCheck() http.Handler {
 		writeJSON(rw, http.StatusOK, resp)
 	})
 }
-
-func generateGameTraffic(gameTrafficFrequency time.Duration, gameTrafficLimitPlayTimePerFreq int32, metadataService models.MetadataService, sigHandler chan struct{}) {
-	ticker := time.NewTicker(gameTrafficFrequency)
-	ctx := context.Background()
-	mdFilter := models.MetadataFilter{} // This simulator assumes that there has been traffic for everyone.
-	for {
-		select {
-		case <-ticker.C:
-			start := time.Now()
-			allMetadata, err := metadataService.Metadata(ctx, mdFilter)
-			if err != nil {
-				ticker.Stop()
-				log.Printf("error fetching gaming metadata: %s", err)
-				return
-			}
-			for _, md := range allMetadata {
-				randomPlayTime := md.PlayTime + uint(rand.Int31n(gameTrafficLimitPlayTimePerFreq))
-				randomPatch := models.MetadataPatch{
-					PlayTime: &randomPlayTime,
-				}
-				// Every `gameTrafficFrequency` minute, all the game metadata (play time
-				// for a player/game pair) is incremented by a random limited number of minutes
-				// thus simulating traffic.
-				metadataService.UpdateMetadata(ctx, md, randomPatch)
-			}
-			elapsed := time.Since(start)
-			log.Printf("Gaming metadata updated in %s", elapsed)
-		case <-sigHandler:
-			ticker.Stop()
-			log.Print("game traffic generator stopped.")
-			return
-		}
-	}
-}
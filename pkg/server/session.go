@@ -0,0 +1,297 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) startPlaySession() http.HandlerFunc {
+	type Input struct {
+		Session struct {
+			Game string `json:"game" validate:"required"` // slug of a linked game
+		} `json:"session" validate:"required"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Session); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		md, ok := s.linkFromSlug(w, r, user, input.Session.Game)
+		if !ok {
+			return
+		}
+
+		if !md.PlayedGame.Status.Linkable() {
+			gameNotPlayableError(w, md.PlayedGame)
+			return
+		}
+
+		if !md.PlayedGame.CheckEligibility(user) {
+			forbiddenError(w, md.PlayedGame.EligibilityReason)
+			return
+		}
+
+		session := models.PlaySession{
+			MetadataID: md.ID,
+			PlayerID:   user.ID,
+			GameID:     md.PlayedGameID,
+			GameSlug:   md.PlayedGame.Slug,
+			Source:     models.PlaySessionClient,
+			StartedAt:  time.Now(),
+		}
+
+		if err := s.playSessionService.StartPlaySession(ctx, &session); err != nil {
+			switch {
+			case errors.Is(err, models.ErrPlaySessionInProgress):
+				err := ErrorM{"session": []string{"a session is already in progress for this game"}}
+				errorResponse(w, http.StatusConflict, err)
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, M{"session": session})
+	}
+}
+
+func (s *Server) listPlaySessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+		query := r.URL.Query()
+
+		filter := models.PlaySessionFilter{PlayerID: &user.ID}
+
+		if v := query.Get("game"); v != "" {
+			md, ok := s.linkFromSlug(w, r, user, v)
+			if !ok {
+				return
+			}
+			filter.MetadataID = &md.ID
+		}
+
+		if v := query.Get("open"); v != "" {
+			open, err := strconv.ParseBool(v)
+			if err != nil {
+				validationError(w, ErrorM{"open": []string{"open must be true or false"}})
+				return
+			}
+			filter.Open = &open
+		}
+
+		limit, offset, err := paginationFromQuery(query)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+		filter.Limit, filter.Offset = limit, offset
+
+		sessions, err := s.playSessionService.PlaySessions(ctx, filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"sessions": sessions, "sessionsCount": len(sessions)})
+	}
+}
+
+func (s *Server) heartbeatPlaySession() http.HandlerFunc {
+	return s.updatePlaySession(s.playSessionService.HeartbeatPlaySession, true)
+}
+
+func (s *Server) endPlaySession() http.HandlerFunc {
+	return s.updatePlaySession(s.playSessionService.EndPlaySession, false)
+}
+
+// updatePlaySession applies fn to the session of the current user named in the URL.
+// When playing, the session must be on a game that can still be played, while
+// any session can be ended.
+func (s *Server) updatePlaySession(fn func(ctx context.Context, id uint, at time.Time) (*models.PlaySession, error), playing bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			badRequestError(w)
+			return
+		}
+		sessionID := uint(id)
+
+		sessions, err := s.playSessionService.PlaySessions(ctx, models.PlaySessionFilter{ID: &sessionID, PlayerID: &user.ID})
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if len(sessions) == 0 {
+			notFoundError(w, ErrorM{"session": []string{"requested session not found"}})
+			return
+		}
+
+		if playing {
+			games, err := s.gameService.Games(ctx, models.GameFilter{ID: &sessions[0].GameID})
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			if len(games) > 0 && !games[0].Status.Linkable() {
+				gameNotPlayableError(w, games[0])
+				return
+			}
+		}
+
+		session, err := fn(ctx, sessionID, time.Now())
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrPlaySessionEnded):
+				err := ErrorM{"session": []string{"the session already ended"}}
+				errorResponse(w, http.StatusConflict, err)
+			case errors.Is(err, models.ErrPlaySessionExpired):
+				err := ErrorM{"session": []string{"the session ended after its heartbeat timeout"}}
+				errorResponse(w, http.StatusConflict, err)
+			default:
+				serverError(w, err)
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"session": session})
+	}
+}
+
+// ingestHeartbeat counts a heartbeat from a streaming client in the open
+// session of the user on the game, starting one when needed.
+func (s *Server) ingestHeartbeat() http.HandlerFunc {
+	type Input struct {
+		Heartbeat struct {
+			ID   string `json:"id" validate:"required,max=64"` // retries reuse the same ID
+			Game string `json:"game" validate:"required"`
+		} `json:"heartbeat" validate:"required"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		if err := validate.Struct(input.Heartbeat); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		md, ok := s.linkFromSlug(w, r, user, input.Heartbeat.Game)
+		if !ok {
+			return
+		}
+
+		if !md.PlayedGame.Status.Linkable() {
+			gameNotPlayableError(w, md.PlayedGame)
+			return
+		}
+
+		// a rating may have changed since the game was linked
+		if !md.PlayedGame.CheckEligibility(user) {
+			forbiddenError(w, md.PlayedGame.EligibilityReason)
+			return
+		}
+
+		hb := models.Heartbeat{
+			ID:         input.Heartbeat.ID,
+			PlayerID:   user.ID,
+			MetadataID: md.ID,
+			ReceivedAt: time.Now(),
+		}
+
+		session, duplicate, err := s.playSessionService.IngestHeartbeat(ctx, &hb)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"session": session, "duplicate": duplicate})
+	}
+}
+
+// expirePlaySessions ends the sessions that stopped heart-beating, until stop
+// is closed or receives a value.
+func (s *Server) expirePlaySessions(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.heartbeatTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			n, err := s.playSessionService.ExpirePlaySessions(context.Background(), now)
+			if err != nil {
+				log.Printf("cannot expire play sessions: %v", err)
+			} else if n > 0 {
+				log.Printf("%d play sessions expired", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// linkFromSlug finds the link between the user and the game with the given
+// slug, writing a 404 when there is none.
+func (s *Server) linkFromSlug(w http.ResponseWriter, r *http.Request, user *models.User, slug string) (*models.Metadata, bool) {
+	ctx := r.Context()
+
+	game, ok := s.gameWithSlug(w, r, slug, false)
+	if !ok {
+		return nil, false
+	}
+
+	mds, err := s.metadataService.Metadata(ctx, models.MetadataFilter{PlayerID: &user.ID, PlayedGameID: &game.ID})
+	if err != nil {
+		serverError(w, err)
+		return nil, false
+	}
+	if len(mds) == 0 {
+		notFoundError(w, ErrorM{"game": []string{"the game is not linked to the user"}})
+		return nil, false
+	}
+
+	return mds[0], true
+}
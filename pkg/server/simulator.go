@@ -0,0 +1,121 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"anbox_mgmt/pkg/simulator"
+)
+
+// simulatorStatus tells whether this replica is the leader, only the
+// simulator of the leader runs.
+func (s *Server) simulatorStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, M{"simulator": s.simulator.Status(), "leader": s.isLeader()})
+	}
+}
+
+func (s *Server) pauseSimulator() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.simulator.Pause(r.Context()); err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, M{"simulator": s.simulator.Status()})
+	}
+}
+
+func (s *Server) resumeSimulator() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.simulator.Resume(r.Context()); err != nil {
+			serverError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, M{"simulator": s.simulator.Status()})
+	}
+}
+
+// stepSimulator starts a single tick, which is mostly useful while the
+// simulator is paused. A tick can outlast the write timeout, so it runs in
+// the background and its metrics show in the status once done.
+func (s *Server) stepSimulator() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.simulator.Step(time.Now()); err != nil {
+			errorResponse(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, M{"simulator": s.simulator.Status()})
+	}
+}
+
+func (s *Server) configureSimulator() http.HandlerFunc {
+	type Input struct {
+		Simulator struct {
+			Frequency  *string            `json:"frequency,omitempty"` // e.g "20s"
+			Span       *string            `json:"span,omitempty"`      // e.g "2h"
+			Profile    *string            `json:"profile,omitempty"`
+			Seed       *int64             `json:"seed,omitempty"`
+			Popularity map[string]float64 `json:"popularity,omitempty"`
+			ChurnRate  *float64           `json:"churnRate,omitempty"`
+		} `json:"simulator"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		input := Input{}
+
+		if err := readJSON(r.Body, &input); err != nil {
+			badRequestError(w)
+			return
+		}
+
+		patch := simulator.ConfigPatch{
+			Profile:    input.Simulator.Profile,
+			Seed:       input.Simulator.Seed,
+			Popularity: input.Simulator.Popularity,
+			ChurnRate:  input.Simulator.ChurnRate,
+		}
+
+		if v := input.Simulator.Frequency; v != nil {
+			d, err := time.ParseDuration(*v)
+			if err != nil {
+				validationError(w, ErrorM{"frequency": []string{"frequency must be a duration such as 20s"}})
+				return
+			}
+			patch.Frequency = &d
+		}
+
+		if v := input.Simulator.Span; v != nil {
+			d, err := time.ParseDuration(*v)
+			if err != nil {
+				validationError(w, ErrorM{"span": []string{"span must be a duration such as 2h"}})
+				return
+			}
+			patch.Span = &d
+		}
+
+		if err := s.simulator.Configure(r.Context(), patch); err != nil {
+			if errors.Is(err, simulator.ErrInvalidConfig) {
+				validationError(w, ErrorM{"simulator": []string{err.Error()}})
+				return
+			}
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"simulator": s.simulator.Status()})
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"anbox_mgmt/pkg/models"
+)
+
+const maxStatsWeeks = 52
+
+func (s *Server) gameStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := statsFilterFromQuery(r.URL.Query())
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		stats, err := s.statsService.GameStats(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"games": stats, "gamesCount": len(stats)})
+	}
+}
+
+func (s *Server) publisherStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := statsFilterFromQuery(r.URL.Query())
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		stats, err := s.statsService.PublisherStats(r.Context(), filter)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{"publishers": stats, "publishersCount": len(stats)})
+	}
+}
+
+// userStats sums up the play time of a user. Only the user, their guardians
+// and admins can read it.
+func (s *Server) userStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := playTimeFormatFromRequest(r)
+		if err != nil {
+			validationError(w, err)
+			return
+		}
+
+		player, ok := s.visiblePlayer(w, r)
+		if !ok {
+			return
+		}
+
+		stats, err := s.statsService.PlayerStats(r.Context(), player.ID)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		stats.TotalPlayTimeHuman = format.format(stats.TotalPlayTime)
+		for _, g := range stats.Games {
+			g.PlayTimeHuman = format.format(g.PlayTime)
+		}
+		for _, p := range stats.Publishers {
+			p.PlayTimeHuman = format.format(p.PlayTime)
+		}
+
+		writeJSON(w, http.StatusOK, M{"username": player.Username, "stats": stats})
+	}
+}
+
+func statsFilterFromQuery(query url.Values) (models.StatsFilter, error) {
+	filter := models.StatsFilter{Weeks: models.DefaultStatsWeeks}
+	errs := ErrorM{}
+
+	if v := query.Get("publisher"); v != "" {
+		filter.Publisher = &v
+	}
+
+	if v := query.Get("age_rating"); v != "" {
+		ageRating, err := strconv.Atoi(v)
+		if err != nil || ageRating < 0 {
+			errs["age_rating"] = []string{"age_rating must be a positive integer"}
+		} else {
+			rating := uint(ageRating)
+			filter.AgeRating = &rating
+		}
+	}
+
+	if v := query.Get("weeks"); v != "" {
+		weeks, err := strconv.Atoi(v)
+		if err != nil || weeks < 1 || weeks > maxStatsWeeks {
+			errs["weeks"] = []string{"weeks must be between 1 and 52"}
+		} else {
+			filter.Weeks = weeks
+		}
+	}
+
+	if len(errs) > 0 {
+		return filter, errs
+	}
+
+	return filter, nil
+}
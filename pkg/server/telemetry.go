@@ -0,0 +1,206 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+const (
+	maxTelemetryBytes  = 32 << 20        // once decompressed
+	telemetryUpload    = 5 * time.Minute // instead of the server timeouts
+	maxTelemetryEvents = 10000
+	maxPlayEventLength = 24 * time.Hour
+	maxClockSkew       = 5 * time.Minute
+)
+
+// telemetryLineError explains why a line of an upload was rejected.
+type telemetryLineError struct {
+	Line   int      `json:"line"`
+	ID     string   `json:"id,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+// ingestPlayEvents accepts NDJSON uploads of play events, optionally gzipped,
+// one event per line. Valid events are written in a single transaction while
+// the invalid ones are reported line by line.
+func (s *Server) ingestPlayEvents() http.HandlerFunc {
+	type Event struct {
+		ID        string    `json:"id"`
+		Game      string    `json:"game"` // slug of a linked game
+		StartedAt time.Time `json:"startedAt"`
+		EndedAt   time.Time `json:"endedAt"`
+	}
+
+	// link is the resolution of a game slug for the current user
+	type link struct {
+		md     *models.Metadata
+		reason string // why the events of the game are rejected
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := userFromContext(ctx)
+		now := time.Now()
+
+		extendDeadlines(r, telemetryUpload)
+		var body io.Reader = http.MaxBytesReader(w, r.Body, maxTelemetryBytes)
+		if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				badRequestError(w)
+				return
+			}
+			defer gz.Close()
+			body = http.MaxBytesReader(w, gz, maxTelemetryBytes)
+		}
+
+		links := map[string]*link{}
+		resolve := func(slug string) (*link, error) {
+			if l, ok := links[slug]; ok {
+				return l, nil
+			}
+			l := &link{}
+			links[slug] = l
+
+			games, err := s.gameService.Games(ctx, models.GameFilter{Slug: &slug})
+			if err != nil {
+				return nil, err
+			}
+			// drafts are not told apart from unknown games
+			if len(games) == 0 || games[0].Status == models.GameDraft {
+				l.reason = "unknown game"
+				return l, nil
+			}
+			if !games[0].Status.Linkable() {
+				l.reason = fmt.Sprintf("%q is %s and cannot be played", games[0].Title, games[0].Status)
+				return l, nil
+			}
+			mds, err := s.metadataService.Metadata(ctx, models.MetadataFilter{PlayerID: &user.ID, PlayedGameID: &games[0].ID})
+			if err != nil {
+				return nil, err
+			}
+			if len(mds) == 0 {
+				l.reason = "the game is not linked to the user"
+				return l, nil
+			}
+			if !mds[0].PlayedGame.CheckEligibility(user) {
+				l.reason = mds[0].PlayedGame.EligibilityReason
+				return l, nil
+			}
+			l.md = mds[0]
+			return l, nil
+		}
+
+		events := []*models.PlayEvent{}
+		rejected := []telemetryLineError{}
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			if len(events)+len(rejected) >= maxTelemetryEvents {
+				errorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d events per upload", maxTelemetryEvents))
+				return
+			}
+
+			e := Event{}
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				rejected = append(rejected, telemetryLineError{Line: line, Errors: []string{"invalid JSON: " + err.Error()}})
+				continue
+			}
+
+			errs := []string{}
+			if e.ID == "" {
+				errs = append(errs, "id is required")
+			} else if len(e.ID) > 64 {
+				errs = append(errs, "id must be at most 64 characters")
+			}
+			if e.StartedAt.IsZero() || e.EndedAt.IsZero() {
+				errs = append(errs, "startedAt and endedAt are required")
+			} else if !e.EndedAt.After(e.StartedAt) {
+				errs = append(errs, "endedAt must be after startedAt")
+			} else if e.EndedAt.Sub(e.StartedAt) > maxPlayEventLength {
+				errs = append(errs, fmt.Sprintf("an event cannot last more than %s", maxPlayEventLength))
+			} else if e.EndedAt.After(now.Add(maxClockSkew)) {
+				errs = append(errs, "endedAt is in the future")
+			}
+
+			var l *link
+			if e.Game == "" {
+				errs = append(errs, "game is required")
+			} else {
+				var err error
+				if l, err = resolve(e.Game); err != nil {
+					serverError(w, err)
+					return
+				}
+				if l.reason != "" {
+					errs = append(errs, l.reason)
+				}
+			}
+
+			if len(errs) > 0 {
+				rejected = append(rejected, telemetryLineError{Line: line, ID: e.ID, Errors: errs})
+				continue
+			}
+
+			events = append(events, &models.PlayEvent{
+				ID:         e.ID,
+				PlayerID:   user.ID,
+				MetadataID: l.md.ID,
+				StartedAt:  e.StartedAt,
+				EndedAt:    e.EndedAt,
+			})
+		}
+
+		if err := scanner.Err(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				errorResponse(w, http.StatusRequestEntityTooLarge, "upload too large")
+				return
+			}
+			badRequestError(w)
+			return
+		}
+
+		duplicates, err := s.playSessionService.IngestPlayEvents(ctx, events)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, M{
+			"accepted":       len(events) - len(duplicates),
+			"duplicates":     len(duplicates),
+			"rejected":       len(rejected),
+			"rejectedEvents": rejected,
+		})
+	}
+}
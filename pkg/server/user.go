@@ -17,10 +17,12 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"anbox_mgmt/pkg/models"
 
@@ -65,10 +67,13 @@ func userResponse(user *models.User, _token ...string) M {
 func (s *Server) createUser() http.HandlerFunc {
 	type Input struct {
 		User struct {
-			Email    string `json:"email" validate:"required,email"`
-			Username string `json:"username" validate:"required,min=2"`
-			Age      uint   `json:"age" validate:"required,min=1"`
-			Password string `json:"password" validate:"required,min=8,max=72"`
+			Email     string `json:"email" validate:"required,email"`
+			Username  string `json:"username" validate:"required,min=2"`
+			Birthdate string `json:"birthdate"`
+			Age       *uint  `json:"age" validate:"omitempty,min=1"`
+			Timezone  string `json:"timezone"`
+			Region    string `json:"region" validate:"omitempty,len=2"`
+			Password  string `json:"password" validate:"required,min=8,max=72"`
 		} `json:"user" validate:"required"`
 	}
 
@@ -85,11 +90,29 @@ func (s *Server) createUser() http.HandlerFunc {
 			return
 		}
 
+		if input.User.Birthdate == "" && input.User.Age == nil {
+			validationError(w, ErrorM{"birthdate": []string{"either birthdate or age is required"}})
+			return
+		}
+
 		user := models.User{
 			Email:    input.User.Email,
 			Username: input.User.Username,
-			Age:      input.User.Age,
+			Timezone: input.User.Timezone,
+			Region:   strings.ToUpper(input.User.Region),
+		}
+
+		if err := validateTimezone(user.Timezone); err != nil {
+			validationError(w, err)
+			return
+		}
+
+		birthdate, err := resolveBirthdate(input.User.Birthdate, input.User.Age, user.Location())
+		if err != nil {
+			validationError(w, err)
+			return
 		}
+		user.Birthdate = *birthdate
 
 		user.SetPassword(input.User.Password)
 
@@ -204,8 +227,27 @@ func (s *Server) listUsers() http.HandlerFunc {
 			return
 		}
 
+		// only the users themselves, their guardians and admins see their
+		// birthdate and where they live
+		current := userFromContext(r.Context())
+		minors := map[uint]bool{}
+		if !current.IsAdmin {
+			guardianships, err := s.guardianService.Guardianships(r.Context(), models.GuardianshipFilter{GuardianID: &current.ID})
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+			for _, g := range guardianships {
+				minors[g.MinorID] = true
+			}
+		}
+
 		usersWithMd := []*mergedUserWithMetadata{}
 		for _, user := range users {
+			if !current.IsAdmin && user.ID != current.ID && !minors[user.ID] {
+				user.Birthdate, user.Region, user.Timezone = time.Time{}, "", ""
+			}
+
 			userWithMD, err := mergeUserWithGamingMetadata(r.Context(), user, s.metadataService)
 			if err != nil {
 				serverError(w, err)
@@ -220,10 +262,13 @@ func (s *Server) listUsers() http.HandlerFunc {
 func (s *Server) updateUser() http.HandlerFunc {
 	type Input struct {
 		User struct {
-			Email    *string `json:"email,omitempty"`
-			Username *string `json:"username,omitempty"`
-			Age      *uint   `json:"age,omitempty"`
-			Password *string `json:"password,omitempty"`
+			Email     *string `json:"email,omitempty"`
+			Username  *string `json:"username,omitempty"`
+			Birthdate *string `json:"birthdate,omitempty"`
+			Age       *uint   `json:"age,omitempty"`
+			Timezone  *string `json:"timezone,omitempty"`
+			Region    *string `json:"region,omitempty" validate:"omitempty,len=2"`
+			Password  *string `json:"password,omitempty"`
 		} `json:"user,omitempty" validate:"required"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -244,7 +289,34 @@ func (s *Server) updateUser() http.HandlerFunc {
 		patch := models.UserPatch{
 			Username: input.User.Username,
 			Email:    input.User.Email,
-			Age:      input.User.Age,
+			Timezone: input.User.Timezone,
+		}
+
+		if v := input.User.Region; v != nil {
+			region := strings.ToUpper(*v)
+			patch.Region = &region
+		}
+
+		loc := user.Location()
+		if v := input.User.Timezone; v != nil {
+			if err := validateTimezone(*v); err != nil {
+				validationError(w, err)
+				return
+			}
+			loc, _ = time.LoadLocation(*v)
+		}
+
+		if input.User.Birthdate != nil || input.User.Age != nil {
+			birthdate := ""
+			if v := input.User.Birthdate; v != nil {
+				birthdate = *v
+			}
+			bd, err := resolveBirthdate(birthdate, input.User.Age, loc)
+			if err != nil {
+				validationError(w, err)
+				return
+			}
+			patch.Birthdate = bd
 		}
 
 		if v := input.User.Password; v != nil {
@@ -322,6 +394,38 @@ func (s *Server) deleteUser() http.HandlerFunc {
 	}
 }
 
+// resolveBirthdate returns the birthdate given by the client, or the one
+// derived from its age (as of today in loc) when no birthdate is provided.
+func resolveBirthdate(birthdate string, age *uint, loc *time.Location) (*time.Time, error) {
+	if birthdate != "" {
+		bd, err := time.Parse(models.BirthdateLayout, birthdate)
+		if err != nil {
+			return nil, ErrorM{"birthdate": []string{"birthdate must be formatted as YYYY-MM-DD"}}
+		}
+		if bd.After(time.Now()) {
+			return nil, ErrorM{"birthdate": []string{"birthdate cannot be in the future"}}
+		}
+		return &bd, nil
+	}
+
+	if age == nil {
+		return nil, ErrorM{"birthdate": []string{"either birthdate or age is required"}}
+	}
+
+	bd := models.BirthdateFromAge(*age, time.Now().In(loc))
+	return &bd, nil
+}
+
+func validateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return ErrorM{"timezone": []string{fmt.Sprintf("%q is not a valid IANA time zone", tz)}}
+	}
+	return nil
+}
+
 func mergeUserWithGamingMetadata(ctx context.Context, user *models.User, metadataService models.MetadataService) (mergedUserWithMetadata, error) {
 	filterMd := models.MetadataFilter{
 		PlayerID: &user.ID,
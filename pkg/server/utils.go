@@ -20,6 +20,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 
 	"anbox_mgmt/pkg/models"
 
@@ -90,20 +92,107 @@ func parseUserToken(tokenStr string) (userClaims M, err error) {
 }
 
 func humanReadablePlayTime(playTime uint) string {
+	return defaultPlayTimeFormat.format(playTime)
+}
+
+// playTimeUnits are the units of a language, for one and several hours or
+// minutes, short ("h", "min") or long ("hour", "hours", "minute", "minutes").
+type playTimeUnits struct {
+	hour, hours, minute, minutes string
+	shortHour, shortMinute       string
+	noData                       string
+}
+
+var playTimeLanguages = map[string]playTimeUnits{
+	"en": {"hour", "hours", "minute", "minutes", "h", "min", "No data"},
+	"fr": {"heure", "heures", "minute", "minutes", "h", "min", "Aucune donnée"},
+	"de": {"Stunde", "Stunden", "Minute", "Minuten", "Std.", "Min.", "Keine Daten"},
+	"es": {"hora", "horas", "minuto", "minutos", "h", "min", "Sin datos"},
+}
+
+// playTimeFormat tells how to make a play time human readable: in which
+// language, with short or long units.
+type playTimeFormat struct {
+	lang string
+	long bool
+}
+
+var defaultPlayTimeFormat = playTimeFormat{lang: "en"}
+
+func (f playTimeFormat) format(playTime uint) string {
 	// playTime is in minute in DB
-	hours := playTime / 60
-	minutes := playTime % 60
-	if hours > 0 {
-		if minutes == 0 {
-			return fmt.Sprintf("%d h", hours)
-		} else {
-			return fmt.Sprintf("%d h %d min", hours, minutes)
+	units, ok := playTimeLanguages[f.lang]
+	if !ok {
+		units = playTimeLanguages[defaultPlayTimeFormat.lang]
+	}
+
+	hour, minute := units.shortHour, units.shortMinute
+	hours, minutes := playTime/60, playTime%60
+	if f.long {
+		hour, minute = units.hour, units.minute
+		if hours > 1 {
+			hour = units.hours
+		}
+		if minutes > 1 {
+			minute = units.minutes
 		}
+	}
+
+	switch {
+	case hours > 0 && minutes == 0:
+		return fmt.Sprintf("%d %s", hours, hour)
+	case hours > 0:
+		return fmt.Sprintf("%d %s %d %s", hours, hour, minutes, minute)
+	case minutes > 0:
+		return fmt.Sprintf("%d %s", minutes, minute)
+	default:
+		return units.noData // should not happen though
+	}
+}
+
+// playTimeFormatFromRequest reads the units (short or long) and the language
+// (lang, else the first supported one of Accept-Language, else English) to
+// make play times human readable with.
+func playTimeFormatFromRequest(r *http.Request) (playTimeFormat, error) {
+	f := defaultPlayTimeFormat
+	errs := ErrorM{}
+
+	query := r.URL.Query()
+	switch query.Get("units") {
+	case "", "short":
+	case "long":
+		f.long = true
+	default:
+		errs["units"] = []string{"units must be short or long"}
+	}
+
+	if v := query.Get("lang"); v != "" {
+		if _, ok := playTimeLanguages[strings.ToLower(v)]; !ok {
+			errs["lang"] = []string{fmt.Sprintf("lang must be one of %s", strings.Join(supportedLanguages(), ", "))}
+		}
+		f.lang = strings.ToLower(v)
 	} else {
-		if minutes > 0 {
-			return fmt.Sprintf("%d min", minutes)
-		} else {
-			return "No data" // should not happen though
+		// e.g. "fr-CH, fr;q=0.9, en;q=0.8", in order of preference
+		for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+			lang := strings.ToLower(strings.TrimSpace(strings.SplitN(strings.SplitN(tag, ";", 2)[0], "-", 2)[0]))
+			if _, ok := playTimeLanguages[lang]; ok {
+				f.lang = lang
+				break
+			}
 		}
 	}
+
+	if len(errs) > 0 {
+		return f, errs
+	}
+	return f, nil
+}
+
+func supportedLanguages() []string {
+	langs := make([]string, 0, len(playTimeLanguages))
+	for lang := range playTimeLanguages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
 }
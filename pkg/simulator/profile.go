@@ -0,0 +1,251 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+// Tick is the state shared by the profiles while the simulator runs one tick.
+type Tick struct {
+	Now  time.Time     // wall clock time of the tick
+	Span time.Duration // simulated time covered by the tick, the maximum play time of a player
+	Rand *rand.Rand    // seeded source, the only randomness profiles may use
+}
+
+// TrafficProfile decides how many minutes the player of a metadata row spent
+// on its game during a tick.
+type TrafficProfile interface {
+	PlayTime(t *Tick, md *models.Metadata) float64
+}
+
+// Modifier scales the play time computed by a TrafficProfile.
+type Modifier interface {
+	Weight(t *Tick, md *models.Metadata) float64
+}
+
+// Options tune the built-in profiles.
+type Options struct {
+	// poisson
+	SessionsPerHour    float64
+	MeanSessionMinutes float64
+	// diurnal
+	PeakHour int
+	// popularity, by game title. Games not listed weigh 1
+	Popularity map[string]float64
+	// weekend
+	WeekendBoost float64
+	// churn
+	ChurnRate float64
+	Seed      int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		SessionsPerHour:    0.5,
+		MeanSessionMinutes: 45,
+		PeakHour:           20,
+		Popularity:         map[string]float64{},
+		WeekendBoost:       1.5,
+		ChurnRate:          0.1,
+	}
+}
+
+// Uniform is the historical profile: every player plays between 0 and the
+// span of the tick, uniformly.
+type Uniform struct{}
+
+func (Uniform) PlayTime(t *Tick, md *models.Metadata) float64 {
+	span := int64(t.Span.Minutes())
+	if span <= 0 {
+		return 0
+	}
+	return float64(t.Rand.Int63n(span))
+}
+
+// Poisson makes sessions start as a Poisson process and last an
+// exponentially distributed number of minutes.
+type Poisson struct {
+	SessionsPerHour    float64
+	MeanSessionMinutes float64
+}
+
+func (p Poisson) PlayTime(t *Tick, md *models.Metadata) float64 {
+	sessions := poisson(t.Rand, p.SessionsPerHour*t.Span.Hours())
+	minutes := 0.0
+	for i := 0; i < sessions; i++ {
+		minutes += t.Rand.ExpFloat64() * p.MeanSessionMinutes
+	}
+	return minutes
+}
+
+// Diurnal follows a daily curve peaking at PeakHour in the player's time zone
+// and bottoming out twelve hours later.
+type Diurnal struct {
+	PeakHour int
+}
+
+func (d Diurnal) Weight(t *Tick, md *models.Metadata) float64 {
+	now := t.Now
+	if md.Player != nil {
+		now = now.In(md.Player.Location())
+	}
+	hour := float64(now.Hour()) + float64(now.Minute())/60
+	return 0.5 + 0.5*math.Cos(2*math.Pi*(hour-float64(d.PeakHour))/24)
+}
+
+// Popularity weighs games by title.
+type Popularity struct {
+	Weights map[string]float64
+}
+
+func (p Popularity) Weight(t *Tick, md *models.Metadata) float64 {
+	if md.PlayedGame == nil {
+		return 1
+	}
+	if w, ok := p.Weights[md.PlayedGame.Title]; ok {
+		return w
+	}
+	return 1
+}
+
+// Weekend boosts the play time on saturdays and sundays in the player's time zone.
+type Weekend struct {
+	Boost float64
+}
+
+func (w Weekend) Weight(t *Tick, md *models.Metadata) float64 {
+	now := t.Now
+	if md.Player != nil {
+		now = now.In(md.Player.Location())
+	}
+	if day := now.Weekday(); day == time.Saturday || day == time.Sunday {
+		return w.Boost
+	}
+	return 1
+}
+
+// Churn picks a stable fraction of the players, derived from the seed, who
+// stopped playing altogether.
+type Churn struct {
+	Rate float64
+	Seed int64
+}
+
+func (c Churn) Weight(t *Tick, md *models.Metadata) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d", c.Seed, md.PlayerID)
+	if float64(h.Sum64()%10000)/10000 < c.Rate {
+		return 0
+	}
+	return 1
+}
+
+// Composite applies modifiers on top of a base profile and caps the result
+// to the span of the tick.
+type Composite struct {
+	Base      TrafficProfile
+	Modifiers []Modifier
+}
+
+func (c Composite) PlayTime(t *Tick, md *models.Metadata) float64 {
+	minutes := c.Base.PlayTime(t, md)
+	for _, m := range c.Modifiers {
+		if minutes <= 0 {
+			return 0
+		}
+		minutes *= m.Weight(t, md)
+	}
+	return math.Min(minutes, t.Span.Minutes())
+}
+
+// ParseProfile builds a profile from a spec such as "poisson+diurnal+weekend".
+// The first element is the base profile (uniform or poisson), the others are
+// modifiers (diurnal, popularity, weekend, churn).
+func ParseProfile(spec string, opts Options) (TrafficProfile, error) {
+	parts := strings.Split(strings.ToLower(strings.ReplaceAll(spec, " ", "")), "+")
+
+	var base TrafficProfile
+	switch parts[0] {
+	case "", "uniform":
+		base = Uniform{}
+	case "poisson":
+		base = Poisson{SessionsPerHour: opts.SessionsPerHour, MeanSessionMinutes: opts.MeanSessionMinutes}
+	default:
+		return nil, fmt.Errorf("unknown base traffic profile %q (expected uniform or poisson)", parts[0])
+	}
+
+	composite := Composite{Base: base}
+	for _, name := range parts[1:] {
+		switch name {
+		case "diurnal":
+			composite.Modifiers = append(composite.Modifiers, Diurnal{PeakHour: opts.PeakHour})
+		case "popularity":
+			composite.Modifiers = append(composite.Modifiers, Popularity{Weights: opts.Popularity})
+		case "weekend":
+			composite.Modifiers = append(composite.Modifiers, Weekend{Boost: opts.WeekendBoost})
+		case "churn":
+			composite.Modifiers = append(composite.Modifiers, Churn{Rate: opts.ChurnRate, Seed: opts.Seed})
+		default:
+			return nil, fmt.Errorf("unknown traffic profile modifier %q", name)
+		}
+	}
+
+	return composite, nil
+}
+
+// ParsePopularity parses "title=weight,title=weight" game weights.
+func ParsePopularity(spec string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	if strings.TrimSpace(spec) == "" {
+		return weights, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid popularity %q, expected title=weight", pair)
+		}
+		var w float64
+		if _, err := fmt.Sscanf(kv[1], "%g", &w); err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid popularity weight %q", kv[1])
+		}
+		weights[strings.TrimSpace(kv[0])] = w
+	}
+
+	return weights, nil
+}
+
+// poisson draws from a Poisson distribution of mean lambda (Knuth).
+func poisson(r *rand.Rand, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	l, k, p := math.Exp(-lambda), 0, 1.0
+	for {
+		p *= r.Float64()
+		if p <= l {
+			return k
+		}
+		k++
+	}
+}
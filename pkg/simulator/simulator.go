@@ -0,0 +1,590 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+// DefaultBatchSize is the number of play time increments applied per statement.
+const DefaultBatchSize = 5000
+
+var (
+	// ErrTickInProgress is returned when a step is requested while a tick runs.
+	ErrTickInProgress = errors.New("a tick is already in progress")
+	// ErrInvalidConfig wraps the errors of a configuration patch.
+	ErrInvalidConfig = errors.New("invalid simulator configuration")
+)
+
+type Config struct {
+	Frequency time.Duration // wall clock time between two ticks
+	Span      time.Duration // simulated play time covered by a tick
+	Profile   string
+	Seed      int64
+	BatchSize int
+	Options   Options
+
+	// RecordPath appends every applied increment to an NDJSON trace.
+	RecordPath string
+	// ReplayPath replays a trace (NDJSON or CSV) instead of generating traffic.
+	ReplayPath string
+	// ReplaySpeed divides the delays of the trace, 0 replays as fast as possible.
+	ReplaySpeed float64
+}
+
+// ConfigPatch changes the configuration of a running simulator.
+type ConfigPatch struct {
+	Frequency  *time.Duration
+	Span       *time.Duration
+	Profile    *string
+	Seed       *int64 // also restarts the random source
+	Popularity map[string]float64
+	ChurnRate  *float64
+}
+
+// Status is a snapshot of the simulator state.
+type Status struct {
+	Running          bool      `json:"running"`
+	TickInProgress   bool      `json:"tickInProgress"`
+	Mode             string    `json:"mode"` // generate or replay
+	Paused           bool      `json:"paused"`
+	Profile          string    `json:"profile"`
+	Seed             int64     `json:"seed"`
+	Frequency        string    `json:"frequency"`
+	Span             string    `json:"span"`
+	BatchSize        int       `json:"batchSize"`
+	Ticks            uint64    `json:"ticks"`
+	SkippedTicks     uint64    `json:"skippedTicks"` // ticks dropped because the previous one was still running
+	LastTickAt       time.Time `json:"lastTickAt,omitempty"`
+	LastTickDuration string    `json:"lastTickDuration,omitempty"`
+	LastTick         TickStats `json:"lastTick"`
+	LastError        string    `json:"lastError,omitempty"` // of the last tick, or of the replay
+
+	RecordedEvents uint64       `json:"recordedEvents"`
+	Replay         *ReplayStats `json:"replay,omitempty"`
+}
+
+// TickStats are the metrics of a single tick.
+type TickStats struct {
+	RowsScanned   int    `json:"rowsScanned"`
+	RowsUpdated   int    `json:"rowsUpdated"`
+	MinutesAdded  uint64 `json:"minutesAdded"`
+	Batches       int    `json:"batches"`
+	Errors        int    `json:"errors"`
+	LoadDuration  string `json:"loadDuration"`
+	ApplyDuration string `json:"applyDuration"`
+}
+
+// Simulator generates artificial game traffic: every tick, the play time of
+// every metadata row is incremented according to a TrafficProfile. Pausing
+// and reconfiguring it is saved with the SimulatorService, and loaded again
+// each time Run starts, so that the controls survive a change of leader.
+type Simulator struct {
+	metadataService  models.MetadataService
+	simulatorService models.SimulatorService
+
+	controlMu sync.Mutex // serializes the changes of the controls and their saving
+
+	mu      sync.Mutex // guards the fields below
+	cfg     Config
+	profile TrafficProfile
+	rand    *rand.Rand
+	running bool
+	paused  bool
+	status  Status
+	ctx     context.Context // of the running loop, steps are cancelled with it
+
+	busy  int32         // set while a tick runs, ticks never overlap
+	reset chan struct{} // wakes the loop up when the frequency changes
+
+	recorder *Recorder // nil unless recording
+}
+
+func New(cfg Config, metadataService models.MetadataService, simulatorService models.SimulatorService) (*Simulator, error) {
+	cfg.Options.Seed = cfg.Seed
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+
+	profile, err := ParseProfile(cfg.Profile, cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		cfg:              cfg,
+		profile:          profile,
+		rand:             rand.New(rand.NewSource(cfg.Seed)),
+		metadataService:  metadataService,
+		simulatorService: simulatorService,
+		reset:            make(chan struct{}, 1),
+	}
+
+	if cfg.RecordPath != "" {
+		// the trace file stays open for the lifetime of the process
+		f, err := os.OpenFile(cfg.RecordPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		s.recorder = NewRecorder(f)
+	}
+
+	return s, nil
+}
+
+// Run ticks until stop is closed or receives a value. In replay mode, it
+// replays the trace instead, resuming where the previous leader stopped: the
+// elector calls Run each time a replica wins the leadership, and replaying
+// the trace again would count its play time twice.
+func (s *Simulator) Run(stop <-chan struct{}) {
+	if s.cfg.ReplayPath != "" {
+		s.replay(stop)
+		return
+	}
+
+	// in-flight ticks are cancelled when the simulator stops, e.g on a leader change
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := s.restore(ctx); err != nil {
+		log.Printf("error loading the game traffic controls, keeping the current ones: %v", err)
+	}
+
+	s.mu.Lock()
+	ticker := time.NewTicker(s.cfg.Frequency)
+	s.running = true
+	s.ctx = ctx
+	log.Printf("game traffic generator started with profile %q and seed %d", s.cfg.Profile, s.cfg.Seed)
+	s.mu.Unlock()
+
+	defer func() {
+		ticker.Stop()
+		s.mu.Lock()
+		s.running = false
+		s.ctx = nil
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if s.Paused() {
+				continue
+			}
+			if !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+				s.mu.Lock()
+				s.status.SkippedTicks++
+				s.mu.Unlock()
+				log.Print("previous game traffic tick still running, skipping this one")
+				continue
+			}
+			go func() {
+				defer atomic.StoreInt32(&s.busy, 0)
+				status := s.step(ctx, now)
+				if status.LastTick.Errors > 0 {
+					log.Printf("game traffic tick failed (%d errors): %s", status.LastTick.Errors, status.LastError)
+				}
+				log.Printf("Gaming metadata updated in %s (%d/%d rows)", status.LastTickDuration, status.LastTick.RowsUpdated, status.LastTick.RowsScanned)
+			}()
+		case <-s.reset:
+			s.mu.Lock()
+			ticker.Reset(s.cfg.Frequency)
+			s.mu.Unlock()
+		case <-stop:
+			log.Print("game traffic generator stopped.")
+			return
+		}
+	}
+}
+
+func (s *Simulator) Pause(ctx context.Context) error {
+	return s.setPaused(ctx, true)
+}
+
+func (s *Simulator) Resume(ctx context.Context) error {
+	return s.setPaused(ctx, false)
+}
+
+func (s *Simulator) setPaused(ctx context.Context, paused bool) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	s.mu.Lock()
+	controls := s.controls()
+	s.mu.Unlock()
+
+	controls.Paused = paused
+	if err := s.simulatorService.SaveSimulatorControls(ctx, controls); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.paused = paused
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Simulator) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *Simulator) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	status.Running = s.running
+	status.TickInProgress = atomic.LoadInt32(&s.busy) == 1
+	status.Mode = "generate"
+	if s.cfg.ReplayPath != "" {
+		status.Mode = "replay"
+	}
+	status.Paused = s.paused
+	status.Profile = s.cfg.Profile
+	status.Seed = s.cfg.Seed
+	status.Frequency = s.cfg.Frequency.String()
+	status.Span = s.cfg.Span.String()
+	status.BatchSize = s.cfg.BatchSize
+	return status
+}
+
+// Configure applies a patch to the running simulator once saved. A patch
+// the simulator cannot apply fails with ErrInvalidConfig.
+func (s *Simulator) Configure(ctx context.Context, patch ConfigPatch) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	s.mu.Lock()
+	cfg, profile, err := s.patched(patch)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	controls := s.controls()
+	s.mu.Unlock()
+
+	controls.Frequency, controls.Span, controls.Profile = &cfg.Frequency, &cfg.Span, &cfg.Profile
+	controls.Seed, controls.Popularity, controls.ChurnRate = &cfg.Seed, cfg.Options.Popularity, &cfg.Options.ChurnRate
+	if err := s.simulatorService.SaveSimulatorControls(ctx, controls); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.apply(cfg, profile, patch.Seed != nil)
+	s.mu.Unlock()
+	return nil
+}
+
+// restore applies the saved controls, if any.
+func (s *Simulator) restore(ctx context.Context) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	controls, err := s.simulatorService.SimulatorControls(ctx)
+	if err != nil || controls == nil {
+		return err
+	}
+
+	patch := ConfigPatch{
+		Frequency:  controls.Frequency,
+		Span:       controls.Span,
+		Profile:    controls.Profile,
+		Seed:       controls.Seed,
+		Popularity: controls.Popularity,
+		ChurnRate:  controls.ChurnRate,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, profile, err := s.patched(patch)
+	if err != nil {
+		return err
+	}
+	s.apply(cfg, profile, patch.Seed != nil)
+	s.paused = controls.Paused
+	log.Printf("game traffic controls of %s loaded", controls.UpdatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// controls returns the current controls. s.mu must be held.
+func (s *Simulator) controls() *models.SimulatorControls {
+	cfg := s.cfg
+	return &models.SimulatorControls{
+		Paused:     s.paused,
+		Frequency:  &cfg.Frequency,
+		Span:       &cfg.Span,
+		Profile:    &cfg.Profile,
+		Seed:       &cfg.Seed,
+		Popularity: cfg.Options.Popularity,
+		ChurnRate:  &cfg.Options.ChurnRate,
+	}
+}
+
+// patched returns the configuration and the profile of a patch applied to
+// the current configuration. s.mu must be held.
+func (s *Simulator) patched(patch ConfigPatch) (Config, TrafficProfile, error) {
+	cfg := s.cfg
+	if v := patch.Frequency; v != nil {
+		if *v <= 0 {
+			return cfg, nil, fmt.Errorf("%w: frequency must be positive", ErrInvalidConfig)
+		}
+		cfg.Frequency = *v
+	}
+	if v := patch.Span; v != nil {
+		if *v < 0 {
+			return cfg, nil, fmt.Errorf("%w: span cannot be negative", ErrInvalidConfig)
+		}
+		cfg.Span = *v
+	}
+	if v := patch.Profile; v != nil {
+		cfg.Profile = *v
+	}
+	if v := patch.Seed; v != nil {
+		cfg.Seed = *v
+		cfg.Options.Seed = *v
+	}
+	if v := patch.Popularity; v != nil {
+		cfg.Options.Popularity = v
+	}
+	if v := patch.ChurnRate; v != nil {
+		if *v < 0 || *v > 1 {
+			return cfg, nil, fmt.Errorf("%w: churn rate must be between 0 and 1", ErrInvalidConfig)
+		}
+		cfg.Options.ChurnRate = *v
+	}
+
+	profile, err := ParseProfile(cfg.Profile, cfg.Options)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return cfg, profile, nil
+}
+
+// apply replaces the configuration, restarting the random source when the
+// seed is set. s.mu must be held.
+func (s *Simulator) apply(cfg Config, profile TrafficProfile, reseed bool) {
+	if reseed {
+		s.rand = rand.New(rand.NewSource(cfg.Seed))
+	}
+	frequencyChanged := cfg.Frequency != s.cfg.Frequency
+	s.cfg = cfg
+	s.profile = profile
+
+	if frequencyChanged {
+		select {
+		case s.reset <- struct{}{}:
+		default: // a reset is already pending
+		}
+	}
+}
+
+// Step starts one tick right away, whether the simulator is paused or not,
+// without waiting for it: the status shows the tick in progress, then its
+// metrics. It fails when a tick is already running.
+func (s *Simulator) Step(now time.Time) error {
+	if !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+		return ErrTickInProgress
+	}
+
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&s.busy, 0)
+		status := s.step(ctx, now)
+		if status.LastTick.Errors > 0 {
+			log.Printf("game traffic step failed (%d errors): %s", status.LastTick.Errors, status.LastError)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Simulator) step(ctx context.Context, now time.Time) Status {
+	start := time.Now()
+	stats, lastErr := s.tick(ctx, now)
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	s.status.Ticks++
+	s.status.LastTickAt = now
+	s.status.LastTickDuration = elapsed.String()
+	s.status.LastTick = stats
+	s.status.LastError = ""
+	if lastErr != nil {
+		s.status.LastError = lastErr.Error()
+	}
+	s.mu.Unlock()
+
+	return s.Status()
+}
+
+// tick computes the play time of every metadata row in memory and applies
+// the increments with a few set-based statements.
+func (s *Simulator) tick(ctx context.Context, now time.Time) (stats TickStats, lastErr error) {
+	load := time.Now()
+	// This simulator assumes that there has been traffic for everyone. The
+	// targets are ordered by id, which keeps the draws of the seeded source
+	// reproducible.
+	allMetadata, err := s.metadataService.SimulationTargets(ctx)
+	stats.LoadDuration = time.Since(load).String()
+	if err != nil {
+		stats.Errors++
+		return stats, err
+	}
+	stats.RowsScanned = len(allMetadata)
+
+	s.mu.Lock()
+	profile := s.profile
+	batchSize := s.cfg.BatchSize
+	tick := &Tick{Now: now, Span: s.cfg.Span, Rand: s.rand}
+	s.mu.Unlock()
+
+	increments := make([]models.PlayTimeIncrement, 0, len(allMetadata))
+	events := make([]Event, 0, len(allMetadata))
+	for _, md := range allMetadata {
+		minutes := uint(math.Round(profile.PlayTime(tick, md)))
+		if minutes == 0 {
+			continue
+		}
+		increments = append(increments, models.PlayTimeIncrement{MetadataID: md.ID, Delta: minutes, Source: models.PlaySessionSimulator})
+		events = append(events, Event{Timestamp: now, PlayerID: md.PlayerID, GameID: md.PlayedGameID, Delta: minutes})
+	}
+
+	apply := time.Now()
+	for start := 0; start < len(increments); start += batchSize {
+		end := start + batchSize
+		if end > len(increments) {
+			end = len(increments)
+		}
+
+		// the increments are applied by the database, concurrent writes are never overwritten
+		n, err := s.metadataService.IncrementPlayTimes(ctx, increments[start:end])
+		stats.Batches++
+		if err != nil {
+			stats.Errors++
+			lastErr = err
+			continue
+		}
+		stats.RowsUpdated += n
+		if s.recorder != nil {
+			if err := s.recorder.Record(events[start:end]); err != nil {
+				stats.Errors++
+				lastErr = err
+			} else {
+				s.mu.Lock()
+				s.status.RecordedEvents += uint64(end - start)
+				s.mu.Unlock()
+			}
+		}
+		for _, inc := range increments[start:end] {
+			stats.MinutesAdded += uint64(inc.Delta)
+		}
+	}
+	stats.ApplyDuration = time.Since(apply).String()
+
+	return stats, lastErr
+}
+
+// replay applies the trace of the configuration from the offset saved with
+// the SimulatorService, which moves along with each applied batch.
+func (s *Simulator) replay(stop <-chan struct{}) {
+	s.mu.Lock()
+	s.running = true
+	path, speed, batchSize := s.cfg.ReplayPath, s.cfg.ReplaySpeed, s.cfg.BatchSize
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	stats, err := s.replayFile(ctx, path, speed, batchSize)
+
+	s.mu.Lock()
+	s.status.Replay = &stats
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("replay of %s stopped: %v", path, err)
+		return
+	}
+	log.Printf("replayed %s: %d events applied, %d skipped", path, stats.Applied, stats.Skipped)
+}
+
+func (s *Simulator) replayFile(ctx context.Context, path string, speed float64, batchSize int) (ReplayStats, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	sum := sha256.Sum256(content)
+
+	events, err := ReadEvents(bytes.NewReader(content), FormatFromPath(path))
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	SortEvents(events)
+
+	tr, err := s.simulatorService.TraceReplay(ctx, path, hex.EncodeToString(sum[:]), len(events))
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	if tr.CompletedAt != nil {
+		log.Printf("trace %s already replayed on %s, not replaying it again", path, tr.CompletedAt.Format(time.RFC3339))
+		return ReplayStats{Events: len(events), Resumed: tr.Offset}, nil
+	}
+	log.Printf("replaying %d events from %s at speed %g, from event %d", len(events), path, speed, tr.Offset)
+
+	apply := func(ctx context.Context, end int, increments []models.PlayTimeIncrement) (int, error) {
+		return s.simulatorService.ApplyTraceReplay(ctx, tr, end, increments)
+	}
+	return Replay(ctx, events, tr.Offset, s.metadataService, apply, speed, batchSize)
+}
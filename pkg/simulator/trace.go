@@ -0,0 +1,231 @@
+// Copyright 2022 gab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"anbox_mgmt/pkg/models"
+)
+
+// Event is a play time increment as recorded in a trace. Deltas are the ones
+// requested by the simulator, the play time limits are enforced again on replay.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	PlayerID  uint      `json:"player"`
+	GameID    uint      `json:"game"`
+	Delta     uint      `json:"delta"`
+}
+
+// Trace formats, NDJSON is the one written by the Recorder.
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// FormatFromPath guesses the trace format from the file extension.
+func FormatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatNDJSON
+}
+
+// Recorder appends events to a trace as NDJSON, one event per line.
+type Recorder struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	return &Recorder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// Record writes the events and flushes them, so a crash loses no applied batch.
+func (r *Recorder) Record(events []Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range events {
+		if err := r.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return r.w.Flush()
+}
+
+// ReadEvents parses a whole trace. CSV traces have the columns
+// timestamp (RFC 3339), player, game and delta, the header line is optional.
+func ReadEvents(r io.Reader, format string) ([]Event, error) {
+	switch format {
+	case FormatNDJSON:
+		return readNDJSON(r)
+	case FormatCSV:
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown trace format %q", format)
+	}
+}
+
+func readNDJSON(r io.Reader) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		e := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+func readCSV(r io.Reader) ([]Event, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	for i, record := range records {
+		if len(record) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 columns, got %d", i+1, len(record))
+		}
+		if i == 0 && record[0] == "timestamp" {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		values := [3]uint64{}
+		for j, v := range record[1:] {
+			if values[j], err = strconv.ParseUint(v, 10, 32); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+		events = append(events, Event{Timestamp: ts, PlayerID: uint(values[0]), GameID: uint(values[1]), Delta: uint(values[2])})
+	}
+	return events, nil
+}
+
+// ReplayStats sum up a replay.
+type ReplayStats struct {
+	Events      int `json:"events"`
+	Resumed     int `json:"resumed"` // events applied before, e.g by the previous leader
+	Applied     int `json:"applied"`
+	Skipped     int `json:"skipped"` // no metadata links the player and the game
+	RowsUpdated int `json:"rowsUpdated"`
+}
+
+// ApplyFunc applies the increments of the events before the end-th one and
+// returns the number of rows whose play time changed.
+type ApplyFunc func(ctx context.Context, end int, increments []models.PlayTimeIncrement) (int, error)
+
+// SortEvents orders events by timestamp, the order the offsets of Replay
+// refer to.
+func SortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+}
+
+// Replay applies sorted events from the offset-th one on, resolving the
+// links with any MetadataService. Events sharing a timestamp are applied
+// together, and the delays between timestamps are divided by speed: 1 is the
+// original pace, 10 is ten times faster and 0 applies everything as fast as
+// possible. The increments go through apply, IncrementPlayTimes when nil.
+func Replay(ctx context.Context, events []Event, offset int, metadataService models.MetadataService, apply ApplyFunc, speed float64, batchSize int) (ReplayStats, error) {
+	stats := ReplayStats{Events: len(events), Resumed: offset}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if apply == nil {
+		apply = func(ctx context.Context, _ int, increments []models.PlayTimeIncrement) (int, error) {
+			if len(increments) == 0 {
+				return 0, nil
+			}
+			return metadataService.IncrementPlayTimes(ctx, increments)
+		}
+	}
+	if offset >= len(events) {
+		return stats, nil
+	}
+
+	allMetadata, err := metadataService.SimulationTargets(ctx)
+	if err != nil {
+		return stats, err
+	}
+	type link struct{ player, game uint }
+	ids := make(map[link]uint, len(allMetadata))
+	for _, md := range allMetadata {
+		ids[link{md.PlayerID, md.PlayedGameID}] = md.ID
+	}
+
+	start := time.Now()
+	for i := offset; i < len(events); {
+		// the events of a single timestamp, at most batchSize of them
+		j := i + 1
+		for j < len(events) && j-i < batchSize && events[j].Timestamp.Equal(events[i].Timestamp) {
+			j++
+		}
+
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(events[i].Timestamp.Sub(events[offset].Timestamp)) / speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return stats, ctx.Err()
+			}
+		}
+
+		increments := make([]models.PlayTimeIncrement, 0, j-i)
+		for _, e := range events[i:j] {
+			id, ok := ids[link{e.PlayerID, e.GameID}]
+			if !ok {
+				stats.Skipped++
+				continue
+			}
+			increments = append(increments, models.PlayTimeIncrement{MetadataID: id, Delta: e.Delta, Source: models.PlaySessionSimulator, PlayedAt: e.Timestamp})
+		}
+		// skipped events move the offset too, so a replay completes
+		n, err := apply(ctx, j, increments)
+		if err != nil {
+			return stats, err
+		}
+		stats.Applied += len(increments)
+		stats.RowsUpdated += n
+		i = j
+	}
+
+	return stats, nil
+}
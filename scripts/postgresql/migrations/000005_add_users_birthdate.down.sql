@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS age INT;
+
+UPDATE users SET age = EXTRACT(YEAR FROM age((NOW() AT TIME ZONE timezone)::date, birthdate));
+
+ALTER TABLE users ALTER COLUMN age SET NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
+ALTER TABLE users DROP COLUMN IF EXISTS birthdate;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS birthdate DATE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Best effort backfill: users are considered to have turned `age` on the day they registered.
+UPDATE users SET birthdate = (created_at - make_interval(years => age))::date WHERE birthdate IS NULL;
+
+ALTER TABLE users ALTER COLUMN birthdate SET NOT NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS age;
+
+COMMIT;
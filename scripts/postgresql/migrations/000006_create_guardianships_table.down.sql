@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE metadata DROP CONSTRAINT IF EXISTS metadata_player_game_key;
+DROP TABLE IF EXISTS daily_play_time;
+DROP TABLE IF EXISTS link_requests;
+DROP TABLE IF EXISTS guardianships;
+
+COMMIT;
@@ -0,0 +1,88 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS guardianships (
+    id SERIAL PRIMARY KEY,
+    guardian_id INT NOT NULL,
+    minor_id INT NOT NULL,
+    approval_age_threshold INT NOT NULL DEFAULT 0,
+    daily_play_time_limit INT,
+    weekly_play_time_limit INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT guardianships_guardian_minor_key UNIQUE (guardian_id, minor_id),
+    CONSTRAINT fk_guardian
+        FOREIGN KEY(guardian_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_minor
+        FOREIGN KEY(minor_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS link_requests (
+    id SERIAL PRIMARY KEY,
+    minor_id INT NOT NULL,
+    game_id INT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    decided_by_id INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT link_requests_minor_game_key UNIQUE (minor_id, game_id),
+    CONSTRAINT fk_minor
+        FOREIGN KEY(minor_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_decided_by
+        FOREIGN KEY(decided_by_id)
+            REFERENCES users(id)
+            ON DELETE SET NULL
+);
+
+-- Play time per player, game and local calendar day of the player.
+-- Used to enforce the daily and weekly play time limits.
+CREATE TABLE IF NOT EXISTS daily_play_time (
+    player_id INT NOT NULL,
+    played_game_id INT NOT NULL,
+    day DATE NOT NULL,
+    play_time INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (player_id, played_game_id, day),
+    CONSTRAINT fk_player
+        FOREIGN KEY(player_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_game
+        FOREIGN KEY(played_game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE
+);
+
+-- Merge the duplicate links of a player and a game into the oldest one, its
+-- play time being the sum, so that a link is unique per player and game.
+CREATE TEMPORARY TABLE metadata_duplicates ON COMMIT DROP AS
+SELECT id, MIN(id) OVER (PARTITION BY player_id, played_game_id) AS kept_id
+FROM metadata;
+
+DELETE FROM metadata_duplicates WHERE id = kept_id;
+
+UPDATE metadata m
+SET play_time = m.play_time + d.play_time, updated_at = NOW()
+FROM (
+    SELECT d.kept_id, SUM(m.play_time) AS play_time
+    FROM metadata_duplicates d
+    JOIN metadata m ON m.id = d.id
+    GROUP BY d.kept_id
+) d
+WHERE m.id = d.kept_id;
+
+DELETE FROM metadata m
+USING metadata_duplicates d
+WHERE m.id = d.id;
+
+ALTER TABLE metadata ADD CONSTRAINT metadata_player_game_key UNIQUE (player_id, played_game_id);
+
+COMMIT;
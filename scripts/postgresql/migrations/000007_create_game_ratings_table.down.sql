@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS region;
+DROP TABLE IF EXISTS game_ratings;
+
+COMMIT;
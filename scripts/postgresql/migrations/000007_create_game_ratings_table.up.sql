@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS game_ratings (
+    game_id INT NOT NULL,
+    system TEXT NOT NULL,
+    rating TEXT NOT NULL,
+    PRIMARY KEY (game_id, system),
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS region TEXT NOT NULL DEFAULT '';
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE games DROP COLUMN IF EXISTS slug;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS slug TEXT;
+
+UPDATE games SET slug = trim(both '-' from lower(regexp_replace(title, '[^a-zA-Z0-9]+', '-', 'g')));
+-- keep the slugs unique when several games share a title
+UPDATE games g SET slug = g.slug || '-' || g.id
+WHERE EXISTS (SELECT 1 FROM games o WHERE o.slug = g.slug AND o.id < g.id);
+
+ALTER TABLE games ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE games ADD CONSTRAINT games_slug_key UNIQUE (slug);
+
+COMMIT;
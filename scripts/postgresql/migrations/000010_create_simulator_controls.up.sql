@@ -0,0 +1,17 @@
+BEGIN;
+
+-- The runtime controls of the game traffic simulator, a single row saved by
+-- the leader and loaded by the next one. NULL keeps the configured value.
+CREATE TABLE IF NOT EXISTS simulator_controls (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    frequency BIGINT, -- nanoseconds
+    span BIGINT, -- nanoseconds
+    profile TEXT,
+    seed BIGINT,
+    popularity JSONB,
+    churn_rate DOUBLE PRECISION,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- The progress of the trace replays of the game traffic simulator, so that a
+-- new leader resumes a replay instead of applying its events again.
+CREATE TABLE IF NOT EXISTS trace_replays (
+    path TEXT NOT NULL,
+    hash TEXT NOT NULL, -- SHA-256 of the trace content
+    events INT NOT NULL,
+    applied_offset INT NOT NULL DEFAULT 0,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (path, hash)
+);
+
+COMMIT;
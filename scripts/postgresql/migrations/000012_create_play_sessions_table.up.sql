@@ -0,0 +1,36 @@
+BEGIN;
+
+-- A play session of a player on a linked game. metadata.play_time is the sum
+-- of the durations (in minutes) credited to the ended sessions of the link.
+CREATE TABLE IF NOT EXISTS play_sessions (
+    id SERIAL PRIMARY KEY,
+    metadata_id INT NOT NULL,
+    source TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    duration INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT play_sessions_source_check CHECK (source IN ('simulator', 'client', 'import', 'api')),
+    CONSTRAINT fk_metadata
+        FOREIGN KEY(metadata_id)
+            REFERENCES metadata(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS play_sessions_metadata_started_at_idx ON play_sessions (metadata_id, started_at);
+
+-- at most one open session per player and game
+CREATE UNIQUE INDEX IF NOT EXISTS play_sessions_open_key ON play_sessions (metadata_id) WHERE ended_at IS NULL;
+
+-- the simulator traffic of a link accumulates in a single ended session
+CREATE UNIQUE INDEX IF NOT EXISTS play_sessions_simulator_key ON play_sessions (metadata_id) WHERE source = 'simulator';
+
+-- the play time accumulated so far becomes one imported session per link
+INSERT INTO play_sessions (metadata_id, source, started_at, last_heartbeat_at, ended_at, duration)
+SELECT id, 'import', created_at, updated_at, updated_at, play_time
+FROM metadata
+WHERE play_time > 0;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS play_heartbeats;
+DROP INDEX IF EXISTS play_sessions_open_last_heartbeat_at_idx;
+ALTER TABLE play_sessions DROP COLUMN IF EXISTS active_seconds;
+
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+
+-- seconds of play accumulated between the heartbeats of a session
+ALTER TABLE play_sessions ADD COLUMN IF NOT EXISTS active_seconds INT NOT NULL DEFAULT 0;
+UPDATE play_sessions SET active_seconds = duration * 60 WHERE ended_at IS NOT NULL;
+
+-- Heartbeats received from the clients, keyed by the client generated ID so
+-- that retries are only counted once.
+CREATE TABLE IF NOT EXISTS play_heartbeats (
+    player_id INT NOT NULL,
+    heartbeat_id TEXT NOT NULL,
+    session_id INT,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (player_id, heartbeat_id),
+    CONSTRAINT fk_player
+        FOREIGN KEY(player_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_session
+        FOREIGN KEY(session_id)
+            REFERENCES play_sessions(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS play_heartbeats_received_at_idx ON play_heartbeats (received_at);
+CREATE INDEX IF NOT EXISTS play_sessions_open_last_heartbeat_at_idx ON play_sessions (last_heartbeat_at) WHERE ended_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- Play events uploaded in bulk by the clients, keyed by the client generated
+-- ID so that uploading a batch again does not count its events twice.
+CREATE TABLE IF NOT EXISTS play_events (
+    player_id INT NOT NULL,
+    event_id TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (player_id, event_id),
+    CONSTRAINT fk_player
+        FOREIGN KEY(player_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE
+);
+
+COMMIT;
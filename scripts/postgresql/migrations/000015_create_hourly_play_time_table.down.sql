@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS hourly_play_time;
+
+COMMIT;
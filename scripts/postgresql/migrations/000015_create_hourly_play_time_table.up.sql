@@ -0,0 +1,31 @@
+BEGIN;
+
+-- Play time per player, game and hour (UTC), kept for trend analysis. Series
+-- in any time zone are computed from these buckets.
+CREATE TABLE IF NOT EXISTS hourly_play_time (
+    player_id INT NOT NULL,
+    played_game_id INT NOT NULL,
+    hour TIMESTAMPTZ NOT NULL,
+    play_time INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (player_id, played_game_id, hour),
+    CONSTRAINT fk_player
+        FOREIGN KEY(player_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_game
+        FOREIGN KEY(played_game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS hourly_play_time_player_hour_idx ON hourly_play_time (player_id, hour);
+CREATE INDEX IF NOT EXISTS hourly_play_time_game_hour_idx ON hourly_play_time (played_game_id, hour);
+
+-- the history known so far is the daily buckets, put at the local midnight of the player
+INSERT INTO hourly_play_time (player_id, played_game_id, hour, play_time)
+SELECT d.player_id, d.played_game_id, d.day::timestamp AT TIME ZONE u.timezone, d.play_time
+FROM daily_play_time d
+JOIN users u ON u.id = d.player_id
+ON CONFLICT DO NOTHING;
+
+COMMIT;
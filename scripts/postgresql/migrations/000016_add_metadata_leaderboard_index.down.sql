@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS metadata_played_game_play_time_idx;
+
+COMMIT;
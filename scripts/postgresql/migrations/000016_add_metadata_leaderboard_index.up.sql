@@ -0,0 +1,6 @@
+BEGIN;
+
+-- overall leaderboards read the top play times of a game
+CREATE INDEX IF NOT EXISTS metadata_played_game_play_time_idx ON metadata (played_game_id, play_time DESC);
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+-- Similarity of two games from the players they have in common, weighted by
+-- play time. Recomputed periodically, only the most similar games of each
+-- game are kept.
+CREATE TABLE IF NOT EXISTS game_similarities (
+    game_id INT NOT NULL,
+    similar_game_id INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    players INT NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (game_id, similar_game_id),
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_similar_game
+        FOREIGN KEY(similar_game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS game_similarities_game_score_idx ON game_similarities (game_id, score DESC);
+
+COMMIT;
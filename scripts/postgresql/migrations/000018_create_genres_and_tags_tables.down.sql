@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS game_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS game_genres;
+DROP TABLE IF EXISTS genres;
+
+COMMIT;
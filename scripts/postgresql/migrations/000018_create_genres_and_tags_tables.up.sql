@@ -0,0 +1,55 @@
+BEGIN;
+
+-- Genres are curated by admins, games are put in existing genres only.
+CREATE TABLE IF NOT EXISTS genres (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT genres_slug_key UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS game_genres (
+    game_id INT NOT NULL,
+    genre_id INT NOT NULL,
+    PRIMARY KEY (game_id, genre_id),
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_genre
+        FOREIGN KEY(genre_id)
+            REFERENCES genres(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS game_genres_genre_idx ON game_genres (genre_id);
+
+-- Tags are free-form and lower case, a tag is created the first time a game
+-- is tagged with it.
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT tags_name_key UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS game_tags (
+    game_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (game_id, tag_id),
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_tag
+        FOREIGN KEY(tag_id)
+            REFERENCES tags(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS game_tags_tag_idx ON game_tags (tag_id);
+
+COMMIT;
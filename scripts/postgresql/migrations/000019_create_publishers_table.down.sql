@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS publisher_id;
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS publisher TEXT;
+
+UPDATE games g
+SET publisher = p.name
+FROM publishers p
+WHERE p.id = g.publisher_id;
+
+ALTER TABLE games DROP COLUMN IF EXISTS publisher_id;
+
+DROP TABLE IF EXISTS publishers;
+
+COMMIT;
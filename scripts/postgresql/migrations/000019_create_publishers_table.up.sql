@@ -0,0 +1,53 @@
+BEGIN;
+
+-- key is the name lower cased without anything but letters and digits, so
+-- that "Riot Games" and "riotgames" are the same publisher.
+CREATE TABLE IF NOT EXISTS publishers (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    website TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT publishers_key_key UNIQUE (key),
+    CONSTRAINT publishers_slug_key UNIQUE (slug)
+);
+
+-- each publisher spelled on games becomes one publisher, named after its
+-- most used spelling
+INSERT INTO publishers (name, key, slug)
+SELECT name, key, btrim(lower(regexp_replace(name, '[^[:alnum:]]+', '-', 'g')), '-')
+FROM (
+    SELECT lower(regexp_replace(publisher, '[^[:alnum:]]+', '', 'g')) AS key,
+        mode() WITHIN GROUP (ORDER BY btrim(publisher)) AS name
+    FROM games
+    WHERE publisher IS NOT NULL
+    GROUP BY 1
+) spellings
+WHERE key <> '';
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS publisher_id INT;
+ALTER TABLE games ADD CONSTRAINT fk_publisher
+    FOREIGN KEY(publisher_id)
+        REFERENCES publishers(id)
+        ON DELETE RESTRICT;
+
+UPDATE games g
+SET publisher_id = p.id
+FROM publishers p
+WHERE p.key = lower(regexp_replace(g.publisher, '[^[:alnum:]]+', '', 'g'));
+
+ALTER TABLE games DROP COLUMN IF EXISTS publisher;
+
+CREATE INDEX IF NOT EXISTS games_publisher_idx ON games (publisher_id);
+
+-- a publisher account manages the games of its publisher only
+ALTER TABLE users ADD COLUMN IF NOT EXISTS publisher_id INT;
+ALTER TABLE users ADD CONSTRAINT fk_publisher
+    FOREIGN KEY(publisher_id)
+        REFERENCES publishers(id)
+        ON DELETE SET NULL;
+
+COMMIT;
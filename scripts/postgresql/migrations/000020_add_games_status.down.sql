@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS games_status_idx;
+
+ALTER TABLE games DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE games DROP COLUMN IF EXISTS deprecated_at;
+ALTER TABLE games DROP COLUMN IF EXISTS published_at;
+ALTER TABLE games DROP COLUMN IF EXISTS status;
+
+COMMIT;
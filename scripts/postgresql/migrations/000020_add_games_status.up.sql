@@ -0,0 +1,17 @@
+BEGIN;
+
+-- The games known so far are published, new ones start as drafts.
+ALTER TABLE games ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published';
+ALTER TABLE games ALTER COLUMN status SET DEFAULT 'draft';
+ALTER TABLE games ADD CONSTRAINT games_status_check CHECK (status IN ('draft', 'published', 'deprecated', 'retired'));
+
+-- when the game last entered each status
+ALTER TABLE games ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS deprecated_at TIMESTAMPTZ;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS retired_at TIMESTAMPTZ;
+
+UPDATE games SET published_at = created_at;
+
+CREATE INDEX IF NOT EXISTS games_status_idx ON games (status);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE IF EXISTS applications DROP CONSTRAINT IF EXISTS fk_active_version;
+
+DROP TABLE IF EXISTS application_versions;
+DROP TABLE IF EXISTS applications;
+
+COMMIT;
@@ -0,0 +1,39 @@
+BEGIN;
+
+-- The Android application of a game, at most one per game.
+CREATE TABLE IF NOT EXISTS applications (
+    id SERIAL PRIMARY KEY,
+    game_id INT NOT NULL,
+    package_name TEXT NOT NULL,
+    active_version_id INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT applications_game_id_key UNIQUE (game_id),
+    CONSTRAINT applications_package_name_key UNIQUE (package_name),
+    CONSTRAINT fk_game
+        FOREIGN KEY(game_id)
+            REFERENCES games(id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS application_versions (
+    id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL,
+    version_code INT NOT NULL,
+    version_name TEXT NOT NULL DEFAULT '',
+    min_sdk INT NOT NULL,
+    abis TEXT[] NOT NULL DEFAULT '{}',
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT application_versions_version_code_key UNIQUE (application_id, version_code),
+    CONSTRAINT fk_application
+        FOREIGN KEY(application_id)
+            REFERENCES applications(id)
+            ON DELETE CASCADE
+);
+
+ALTER TABLE applications ADD CONSTRAINT fk_active_version
+    FOREIGN KEY(active_version_id)
+        REFERENCES application_versions(id)
+        ON DELETE SET NULL;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE application_versions DROP COLUMN IF EXISTS apk_sha256;
+ALTER TABLE application_versions DROP COLUMN IF EXISTS apk_size;
+ALTER TABLE application_versions DROP COLUMN IF EXISTS apk_key;
+ALTER TABLE application_versions DROP COLUMN IF EXISTS permissions;
+ALTER TABLE application_versions DROP COLUMN IF EXISTS target_sdk;
+
+COMMIT;
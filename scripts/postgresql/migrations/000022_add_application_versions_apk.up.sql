@@ -0,0 +1,12 @@
+BEGIN;
+
+-- filled from the manifest of an uploaded APK, or given with the version
+ALTER TABLE application_versions ADD COLUMN IF NOT EXISTS target_sdk INT NOT NULL DEFAULT 0;
+ALTER TABLE application_versions ADD COLUMN IF NOT EXISTS permissions TEXT[] NOT NULL DEFAULT '{}';
+
+-- the uploaded APK in the blob store, none for the versions added by hand
+ALTER TABLE application_versions ADD COLUMN IF NOT EXISTS apk_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE application_versions ADD COLUMN IF NOT EXISTS apk_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE application_versions ADD COLUMN IF NOT EXISTS apk_sha256 TEXT NOT NULL DEFAULT '';
+
+COMMIT;